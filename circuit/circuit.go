@@ -0,0 +1,365 @@
+package circuit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/itsubaki/qasm/flatten"
+	"github.com/itsubaki/qasm/gen/parser"
+	xparser "github.com/itsubaki/qasm/parser"
+)
+
+// Version is the version of the schema.
+const Version = 1
+
+// Circuit is the versioned JSON interchange format of a circuit.
+// Qubits and bits of the ops are global indices in the order the registers are declared.
+// Wires are the qubits followed by the bits, and are derived from the registers.
+type Circuit struct {
+	Version  int        `json:"version"`
+	Includes []string   `json:"includes,omitempty"`
+	Gates    []string   `json:"gates,omitempty"`
+	Qubits   []Register `json:"qubits"`
+	Bits     []Register `json:"bits"`
+	Wires    []Wire     `json:"wires,omitempty"`
+	Ops      []Op       `json:"ops"`
+}
+
+// Register is a declared qubit or bit register.
+// A qubit register whose name starts with $ is a physical qubit and is not declared.
+type Register struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	Scalar bool   `json:"scalar,omitempty"`
+}
+
+// Wire is a qubit or a bit of the registers.
+type Wire struct {
+	Name      string `json:"name"`
+	Classical bool   `json:"classical,omitempty"`
+}
+
+// Op is a gate, measurement, reset or barrier as in the straight-line program of flatten.
+// Control is the operands of the ctrl modifier of U, and the user-defined gates take the controls as leading targets.
+// The negctrl, inv and pow modifiers are resolved into U and gphase.
+// Bit is the bits that the measurement is assigned to, and Cond is the classical condition of the op.
+type Op struct {
+	Name    string    `json:"name"`
+	Params  []float64 `json:"params,omitempty"`
+	Control []int     `json:"control,omitempty"`
+	Target  []int     `json:"target,omitempty"`
+	Bit     []int     `json:"bit,omitempty"`
+	Cond    string    `json:"cond,omitempty"`
+}
+
+// New returns the circuit of the program.
+func New(p *flatten.Program) *Circuit {
+	c := &Circuit{
+		Version: Version,
+		Gates:   slices.Clone(p.Gates),
+		Qubits:  make([]Register, len(p.Qubits)),
+		Bits:    make([]Register, len(p.Bits)),
+		Ops:     make([]Op, len(p.Ops)),
+	}
+
+	for i, r := range p.Qubits {
+		c.Qubits[i] = Register(r)
+	}
+
+	for i, r := range p.Bits {
+		c.Bits[i] = Register(r)
+	}
+
+	for i := range p.NumQubits() {
+		c.Wires = append(c.Wires, Wire{Name: p.QubitName(i)})
+	}
+
+	for i := range p.NumBits() {
+		c.Wires = append(c.Wires, Wire{Name: p.BitName(i), Classical: true})
+	}
+
+	for i, op := range p.Ops {
+		c.Ops[i] = Op{
+			Name:   op.Name,
+			Params: slices.Clone(op.Params),
+			Target: slices.Clone(op.Target),
+			Bit:    slices.Clone(op.Bit),
+			Cond:   op.Cond,
+		}
+
+		switch op.Name {
+		case flatten.U:
+			c.Ops[i].Control = slices.Clone(op.Control)
+		default:
+			// user-defined gates take the controls as leading operands. e.g. cx c, t;
+			c.Ops[i].Target = append(slices.Clone(op.Control), op.Target...)
+		}
+	}
+
+	return c
+}
+
+// Load returns the circuit of the JSON file.
+func Load(path string) (*Circuit, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %w", path, err)
+	}
+
+	return Parse(b)
+}
+
+// Parse returns the circuit of the JSON.
+// The circuit is validated, and the OpenQASM 3 program of it must be flattened,
+// where the names of the ops are defined in Gates, Includes or as the builtins.
+// The paths of Includes are read relative to the working directory as in the include statement.
+func Parse(b []byte) (*Circuit, error) {
+	var c Circuit
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("unmarshal circuit: %w", err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := flatten.Flatten(c.String()); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// Validate returns an error if the circuit is invalid.
+func (c *Circuit) Validate() error {
+	if c.Version != Version {
+		return fmt.Errorf("unsupported version %d", c.Version)
+	}
+
+	for _, r := range slices.Concat(c.Qubits, c.Bits) {
+		if r.Name == "" || r.Size < 1 || (r.Scalar && r.Size != 1) {
+			return fmt.Errorf("invalid register %q[%d]", r.Name, r.Size)
+		}
+	}
+
+	for i, g := range c.Gates {
+		s, ok := statement(g)
+		if !ok || s.GateStatement() == nil {
+			return fmt.Errorf("gates[%d] %q: not a gate definition", i, g)
+		}
+	}
+
+	nq, nb := size(c.Qubits), size(c.Bits)
+	if len(c.Wires) > 0 {
+		p := c.program()
+		if len(c.Wires) != nq+nb {
+			return fmt.Errorf("invalid wires: %d wires for %d qubits and %d bits", len(c.Wires), nq, nb)
+		}
+
+		for i, w := range c.Wires {
+			want := Wire{Name: p.QubitName(i)}
+			if i >= nq {
+				want = Wire{Name: p.BitName(i - nq), Classical: true}
+			}
+
+			if w != want {
+				return fmt.Errorf("invalid wire[%d] %q: want %q", i, w.Name, want.Name)
+			}
+		}
+	}
+
+	for i, op := range c.Ops {
+		if err := op.validate(nq, nb); err != nil {
+			return fmt.Errorf("op[%d] %q: %w", i, op.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (o Op) validate(nq, nb int) error {
+	qubits := o.Qubits()
+	for _, q := range qubits {
+		if q < 0 || q >= nq {
+			return fmt.Errorf("qubit %d out of range [0, %d)", q, nq)
+		}
+	}
+
+	for _, b := range o.Bit {
+		if b < 0 || b >= nb {
+			return fmt.Errorf("bit %d out of range [0, %d)", b, nb)
+		}
+	}
+
+	sorted := slices.Sorted(slices.Values(qubits))
+	if len(slices.Compact(sorted)) != len(qubits) {
+		return fmt.Errorf("duplicate qubits %v", qubits)
+	}
+
+	if o.Name != flatten.U && len(o.Control) > 0 {
+		return fmt.Errorf("controls are only allowed for U")
+	}
+
+	switch o.Name {
+	case "":
+		return fmt.Errorf("empty name")
+	case flatten.Measure, flatten.Reset, flatten.Barrier:
+		if len(o.Params) > 0 {
+			return fmt.Errorf("params are not allowed")
+		}
+
+		if o.Name == flatten.Measure && len(o.Bit) > 0 && len(o.Bit) != len(o.Target) {
+			return fmt.Errorf("%d bits for %d targets", len(o.Bit), len(o.Target))
+		}
+	case flatten.U:
+		if len(o.Params) != 3 {
+			return fmt.Errorf("%d params, want 3", len(o.Params))
+		}
+	case flatten.GPhase:
+		if len(o.Params) != 1 {
+			return fmt.Errorf("%d params, want 1", len(o.Params))
+		}
+	}
+
+	if o.Name != flatten.Measure && len(o.Bit) > 0 {
+		return fmt.Errorf("bits are only allowed for measure")
+	}
+
+	if o.Cond != "" && !expression(o.Cond) {
+		return fmt.Errorf("cond %q is not an expression", o.Cond)
+	}
+
+	return nil
+}
+
+// statement returns the statement if the text is a single statement.
+func statement(text string) (parser.IStatementContext, bool) {
+	program, err := xparser.Parse(text)
+	if err != nil {
+		return nil, false
+	}
+
+	list := program.AllStatementOrScope()
+	if len(list) != 1 || list[0].Statement() == nil {
+		return nil, false
+	}
+
+	return list[0].Statement(), true
+}
+
+// expression returns true if the text is a single expression,
+// so the condition of the if statement written with it has an empty body.
+func expression(text string) bool {
+	s, ok := statement(fmt.Sprintf("if (%s) {}", text))
+	if !ok || s.IfStatement() == nil {
+		return false
+	}
+
+	// if (true) if (c) {}
+	x := s.IfStatement()
+	body := x.GetIf_body().Scope()
+	return body != nil && len(body.AllStatementOrScope()) == 0 && x.GetElse_body() == nil
+}
+
+// Qubits returns the control and target qubits of the op.
+func (o Op) Qubits() []int {
+	return slices.Concat(o.Control, o.Target)
+}
+
+// String returns the circuit as an OpenQASM 3 program.
+func (c *Circuit) String() string {
+	var b strings.Builder
+	b.WriteString("OPENQASM 3.0;\n")
+
+	for _, path := range c.Includes {
+		b.WriteString(fmt.Sprintf("include %q;\n", path))
+	}
+
+	for _, g := range c.Gates {
+		b.WriteString(g + "\n")
+	}
+
+	p := c.program()
+	for _, r := range p.Qubits {
+		if strings.HasPrefix(r.Name, "$") {
+			// physical qubits are not declared.
+			continue
+		}
+
+		b.WriteString(flatten.Declaration("qubit", r) + "\n")
+	}
+
+	for _, r := range p.Bits {
+		b.WriteString(flatten.Declaration("bit", r) + "\n")
+	}
+
+	for _, op := range c.Ops {
+		for _, o := range op.ops() {
+			b.WriteString(p.Statement(o) + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+func (c *Circuit) program() *flatten.Program {
+	p := &flatten.Program{
+		Qubits: make([]flatten.Register, len(c.Qubits)),
+		Bits:   make([]flatten.Register, len(c.Bits)),
+	}
+
+	for i, r := range c.Qubits {
+		p.Qubits[i] = flatten.Register(r)
+	}
+
+	for i, r := range c.Bits {
+		p.Bits[i] = flatten.Register(r)
+	}
+
+	return p
+}
+
+// ops returns the ops of flatten of the op.
+// The measurement and the reset of the qubits are split into each qubit.
+func (o Op) ops() []flatten.Op {
+	if (o.Name != flatten.Measure && o.Name != flatten.Reset) || len(o.Target) < 2 {
+		return []flatten.Op{{
+			Name:    o.Name,
+			Params:  o.Params,
+			Control: o.Control,
+			Target:  o.Target,
+			Bit:     o.Bit,
+			Cond:    o.Cond,
+		}}
+	}
+
+	list := make([]flatten.Op, len(o.Target))
+	for i, q := range o.Target {
+		list[i] = flatten.Op{
+			Name:   o.Name,
+			Target: []int{q},
+			Cond:   o.Cond,
+		}
+
+		if len(o.Bit) > 0 {
+			list[i].Bit = []int{o.Bit[i]}
+		}
+	}
+
+	return list
+}
+
+func size(regs []Register) int {
+	var n int
+	for _, r := range regs {
+		n += r.Size
+	}
+
+	return n
+}
@@ -0,0 +1,241 @@
+package circuit_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/itsubaki/qasm/circuit"
+	"github.com/itsubaki/qasm/flatten"
+	"github.com/itsubaki/qasm/transpile"
+)
+
+func ExampleNew() {
+	p, err := flatten.Flatten(`
+	OPENQASM 3.0;
+	qubit[2] q;
+	bit c;
+	U(pi/2, 0, pi) q[0];
+	ctrl @ U(pi, 0, pi) q[0], q[1];
+	c = measure q[0];
+	if (c == 1) { U(pi, 0, pi) q[1]; }
+	`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	b, err := json.Marshal(circuit.New(p))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(string(b))
+
+	// Output:
+	// {"version":1,"qubits":[{"name":"q","size":2}],"bits":[{"name":"c","size":1,"scalar":true}],"wires":[{"name":"q[0]"},{"name":"q[1]"},{"name":"c","classical":true}],"ops":[{"name":"U","params":[1.5707963267948966,0,3.141592653589793],"target":[0]},{"name":"U","params":[3.141592653589793,0,3.141592653589793],"control":[0],"target":[1]},{"name":"measure","target":[0],"bit":[0]},{"name":"U","params":[3.141592653589793,0,3.141592653589793],"target":[1],"cond":"c == 1"}]}
+}
+
+func ExampleParse() {
+	c, err := circuit.Parse([]byte(`{
+		"version": 1,
+		"includes": ["../testdata/stdgates.qasm"],
+		"qubits": [{"name": "q", "size": 3}],
+		"bits": [{"name": "c", "size": 3}],
+		"ops": [
+			{"name": "h", "target": [0]},
+			{"name": "U", "params": [1, 2, 3], "control": [0, 1], "target": [2]},
+			{"name": "gphase", "params": [0.25]},
+			{"name": "barrier"},
+			{"name": "measure", "target": [0, 1], "bit": [0, 1]},
+			{"name": "reset", "target": [2], "cond": "c[0] == 1"}
+		]
+	}`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Print(c)
+
+	// Output:
+	// OPENQASM 3.0;
+	// include "../testdata/stdgates.qasm";
+	// qubit[3] q;
+	// bit[3] c;
+	// h q[0];
+	// ctrl(2) @ U(1, 2, 3) q[0], q[1], q[2];
+	// gphase(0.25);
+	// barrier;
+	// c[0] = measure q[0];
+	// c[1] = measure q[1];
+	// if (c[0] == 1) { reset q[2]; }
+}
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		text  string
+		basis []string
+	}{
+		{text: "../testdata/grover.qasm"},
+		{text: "../testdata/quantum_counting.qasm"},
+		{text: "qubit[2] q; bit[2] c; U(pi/2, 0, pi) q[0]; c[0] = measure q[0]; if (c[0] == 1) { ctrl @ U(pi, 0, pi) q[0], q[1]; } reset q; barrier q;"},
+		{text: "../testdata/qft.qasm", basis: []string{"rz", "sx", "x", "cx"}},
+		{text: "U(0.1, 0.2, 0.3) $1; ctrl @ U(pi, 0, pi) $1, $0;"},
+	}
+
+	for _, c := range cases {
+		text := c.text
+		if b, err := os.ReadFile(c.text); err == nil {
+			text = string(b)
+		}
+
+		p, err := flatten.Flatten(text)
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		if len(c.basis) > 0 {
+			p, err = transpile.Transpile(p, c.basis)
+			if err != nil {
+				t.Fatalf("%s: %v", c.text, err)
+			}
+		}
+
+		b, err := json.Marshal(circuit.New(p))
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		got, err := circuit.Parse(b)
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		if got.String() != p.String() {
+			t.Errorf("%s: got=%v, want=%v", c.text, got, p)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		json   string
+		errMsg string
+	}{
+		{
+			json:   `{"version": 2}`,
+			errMsg: `unsupported version 2`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 0}]}`,
+			errMsg: `invalid register "q"[0]`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "wires": [{"name": "q"}]}`,
+			errMsg: `invalid wire[0] "q": want "q[0]"`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "wires": []}`,
+			errMsg: ``,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "wires": [{"name": "q[0]"}, {"name": "c", "classical": true}]}`,
+			errMsg: `invalid wires: 2 wires for 1 qubits and 0 bits`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 2}], "ops": [{"name": "U", "params": [1, 2, 3], "target": [2]}]}`,
+			errMsg: `op[0] "U": qubit 2 out of range [0, 2)`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 2}], "ops": [{"name": "U", "params": [1, 2, 3], "control": [0], "target": [0]}]}`,
+			errMsg: `op[0] "U": duplicate qubits [0 0]`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "ops": [{"name": "U", "params": [1], "target": [0]}]}`,
+			errMsg: `op[0] "U": 1 params, want 3`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "ops": [{"name": "U", "params": [1, 2, 3], "modifiers": [{"name": "inv"}], "target": [0]}]}`,
+			errMsg: `unmarshal circuit: json: unknown field "modifiers"`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "bits": [{"name": "c", "size": 1}], "ops": [{"name": "measure", "target": [0], "bit": [1]}]}`,
+			errMsg: `op[0] "measure": bit 1 out of range [0, 1)`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "ops": [{"name": "reset", "control": [0]}]}`,
+			errMsg: `op[0] "reset": controls are only allowed for U`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "ops": [{"name": "reset", "params": [1], "target": [0]}]}`,
+			errMsg: `op[0] "reset": params are not allowed`,
+		},
+		{
+			json:   `{"version": 1, "gates": ["gate x q { U(pi, 0, pi) q; }"], "qubits": [{"name": "q", "size": 2}], "ops": [{"name": "x", "control": [0], "target": [1]}]}`,
+			errMsg: `op[0] "x": controls are only allowed for U`,
+		},
+		{
+			json:   `{"version": 1, "gates": ["gate x q { U(pi, 0, pi) q; }"], "qubits": [{"name": "q", "size": 1}], "ops": [{"name": "x", "target": [0]}, {"name": "h", "target": [0]}]}`,
+			errMsg: `undefined "h"`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "bits": [{"name": "c", "size": 1}], "ops": [{"name": "h", "target": [0], "bit": [0]}]}`,
+			errMsg: `op[0] "h": bits are only allowed for measure`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "bits": [{"name": "c", "size": 1}], "ops": [{"name": "measure", "target": [0], "bit": [0]}, {"name": "U", "params": [1, 2, 3], "target": [0], "cond": "c[0] == 1"}]}`,
+			errMsg: ``,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "ops": [{"name": "reset", "target": [0], "cond": "true) {} include \"x.qasm\"; if (true"}]}`,
+			errMsg: `op[0] "reset": cond "true) {} include \"x.qasm\"; if (true" is not an expression`,
+		},
+		{
+			json:   `{"version": 1, "qubits": [{"name": "q", "size": 1}], "ops": [{"name": "reset", "target": [0], "cond": "true) if (true"}]}`,
+			errMsg: `op[0] "reset": cond "true) if (true" is not an expression`,
+		},
+		{
+			json:   `{"version": 1, "gates": ["gate x q { U(pi, 0, pi) q; } include \"x.qasm\";"], "ops": []}`,
+			errMsg: `gates[0] "gate x q { U(pi, 0, pi) q; } include \"x.qasm\";": not a gate definition`,
+		},
+		{
+			json:   `{"version": 1, "ops": [{"name": ""}]}`,
+			errMsg: `op[0] "": empty name`,
+		},
+		{
+			json:   `{"version": "1"}`,
+			errMsg: `unmarshal circuit: json: cannot unmarshal string into Go struct field Circuit.version of type int`,
+		},
+	}
+
+	for _, c := range cases {
+		_, err := circuit.Parse([]byte(c.json))
+		if err == nil {
+			if c.errMsg != "" {
+				t.Errorf("got=nil, want=%v", c.errMsg)
+			}
+
+			continue
+		}
+
+		if err.Error() != c.errMsg {
+			t.Errorf("got=%v, want=%v", err, c.errMsg)
+		}
+	}
+}
+
+func TestParse_syntax(t *testing.T) {
+	_, err := circuit.Parse([]byte(`{"version": 1, "bits": [{"name": "c", "size": 1}], "ops": [{"name": "barrier", "cond": "c =="}]}`))
+	if err == nil {
+		t.Errorf("got=nil, want syntax error")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if _, err := circuit.Load("../testdata/notfound.json"); err == nil {
+		t.Errorf("got=nil, want error")
+	}
+}
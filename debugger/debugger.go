@@ -0,0 +1,293 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/itsubaki/q"
+	"github.com/itsubaki/qasm/environ"
+	"github.com/itsubaki/qasm/gen/parser"
+	xparser "github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+// ErrQuit is returned by the hook after the quit command, and no more statements are executed.
+var ErrQuit = errors.New("quit")
+
+const (
+	Step     = "step"
+	Next     = "next"
+	Continue = "continue"
+)
+
+// Debugger runs the program statement by statement with the commands read from the input.
+// It stops before the first statement.
+type Debugger struct {
+	lines       []string
+	in          <-chan string
+	out         io.Writer
+	qsim        *q.Q
+	env         *environ.Environ
+	breakpoints map[int]bool
+	mode        string
+	depth       int
+	line        int
+	quit        bool
+}
+
+// New returns a new debugger of the program text.
+func New(text string, in <-chan string, out io.Writer) *Debugger {
+	return &Debugger{
+		lines:       strings.Split(text, "\n"),
+		in:          in,
+		out:         out,
+		breakpoints: make(map[int]bool),
+		mode:        Step,
+	}
+}
+
+// Run runs the program until it finishes or the quit command.
+// The state is printed when the program finishes.
+func (d *Debugger) Run(opt ...visitor.Option) error {
+	program, err := xparser.Parse(strings.Join(d.lines, "\n"))
+	if err != nil {
+		return err
+	}
+
+	d.qsim, d.env = q.New(), environ.New()
+	v := visitor.New(d.qsim, d.env, slices.Concat(opt, []visitor.Option{visitor.WithHook(d.Hook)})...)
+	if err := v.Run(program); err != nil {
+		if errors.Is(err, ErrQuit) {
+			return nil
+		}
+
+		return err
+	}
+
+	fmt.Fprintln(d.out, "finished")
+	d.State()
+	return nil
+}
+
+// Hook stops before the statement and reads the commands until step, next or continue.
+func (d *Debugger) Hook(ctx *parser.StatementContext, env *environ.Environ, depth int) error {
+	if d.quit {
+		return ErrQuit
+	}
+
+	line := ctx.GetStart().GetLine()
+	if !d.Stop(line, depth) {
+		return nil
+	}
+
+	d.line = line
+	fmt.Fprintf(d.out, "%d: %s\n", line, d.Source(line))
+	for {
+		fmt.Fprint(d.out, "debug> ")
+		text, ok := <-d.in
+		if !ok {
+			// EOF
+			d.quit = true
+			return ErrQuit
+		}
+
+		resume, err := d.Command(text, env, depth)
+		if err != nil {
+			fmt.Fprintln(d.out, err)
+			continue
+		}
+
+		if d.quit {
+			return ErrQuit
+		}
+
+		if resume {
+			return nil
+		}
+	}
+}
+
+// Stop returns true if the debugger stops before the statement on the line in the depth of the calls.
+func (d *Debugger) Stop(line, depth int) bool {
+	if d.breakpoints[line] {
+		return true
+	}
+
+	switch d.mode {
+	case Step:
+		return true
+	case Next:
+		return depth <= d.depth
+	default:
+		return false
+	}
+}
+
+// Command runs the command, and returns true if the program resumes.
+func (d *Debugger) Command(text string, env *environ.Environ, depth int) (bool, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return false, nil
+	}
+
+	switch cmd, args := fields[0], fields[1:]; cmd {
+	case "step", "s":
+		d.mode = Step
+		return true, nil
+	case "next", "n":
+		d.mode, d.depth = Next, depth
+		return true, nil
+	case "continue", "c":
+		d.mode = Continue
+		return true, nil
+	case "break", "b":
+		if len(args) == 0 {
+			fmt.Fprintf(d.out, "breakpoints: %v\n", slices.Sorted(maps.Keys(d.breakpoints)))
+			return false, nil
+		}
+
+		for _, a := range args {
+			line, err := d.Line(a)
+			if err != nil {
+				return false, err
+			}
+
+			d.breakpoints[line] = true
+		}
+	case "delete", "d":
+		for _, a := range args {
+			line, err := d.Line(a)
+			if err != nil {
+				return false, err
+			}
+
+			delete(d.breakpoints, line)
+		}
+	case "print", "p":
+		if len(args) == 0 {
+			return false, fmt.Errorf("usage: print name")
+		}
+
+		for _, name := range args {
+			s, err := Print(env, name)
+			if err != nil {
+				return false, err
+			}
+
+			fmt.Fprintln(d.out, s)
+		}
+	case "state":
+		d.State()
+	case "list", "l":
+		d.List(2)
+	case "quit", "q":
+		d.quit = true
+		return true, nil
+	case "help", "h":
+		fmt.Fprintln(d.out, Help)
+	default:
+		return false, fmt.Errorf("unknown command %q", cmd)
+	}
+
+	return false, nil
+}
+
+// Help is the usage of the commands.
+const Help = `step (s)          run the statement, stepping into the gate and def calls
+next (n)          run the statement, stepping over the gate and def calls
+continue (c)      run until the next breakpoint
+break (b) [line]  set a breakpoint on the line, or list the breakpoints
+delete (d) line   delete the breakpoint on the line
+print (p) name    print the variable, constant, bit or qubit register
+state             print the state vector
+list (l)          print the lines around the current statement
+quit (q)          stop the program`
+
+// Line returns the line number of the argument.
+func (d *Debugger) Line(arg string) (int, error) {
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 || line > len(d.lines) {
+		return 0, fmt.Errorf("invalid line %q", arg)
+	}
+
+	return line, nil
+}
+
+// Source returns the line of the program text without the indentation.
+func (d *Debugger) Source(line int) string {
+	if line < 1 || line > len(d.lines) {
+		return ""
+	}
+
+	return strings.TrimSpace(d.lines[line-1])
+}
+
+// State prints the state vector in the order of env.Index().
+func (d *Debugger) State() {
+	for _, s := range d.qsim.Qubit().State(d.env.Index()...) {
+		fmt.Fprintln(d.out, s)
+	}
+}
+
+// List prints the lines around the current line.
+// The current line is marked with > and the breakpoints with *.
+func (d *Debugger) List(n int) {
+	for i := max(d.line-n, 1); i <= min(d.line+n, len(d.lines)); i++ {
+		mark := " "
+		if d.breakpoints[i] {
+			mark = "*"
+		}
+
+		if i == d.line {
+			mark += ">"
+		} else {
+			mark += " "
+		}
+
+		fmt.Fprintln(d.out, strings.TrimRight(fmt.Sprintf("%s %3d  %s", mark, i, d.lines[i-1]), " "))
+	}
+}
+
+// Print returns the value of the name in the environment through the outer ones.
+func Print(env *environ.Environ, name string) (string, error) {
+	if v, ok := env.GetConst(name); ok {
+		return fmt.Sprintf("%s = %v", name, v), nil
+	}
+
+	if v, ok := env.GetVariable(name); ok {
+		return fmt.Sprintf("%s = %v", name, v), nil
+	}
+
+	if v, ok := env.GetBit(name); ok {
+		return fmt.Sprintf("%s = %s", name, bits(v)), nil
+	}
+
+	if v, ok := env.GetBitArray(name); ok {
+		return fmt.Sprintf("%s = %s", name, bits(v...)), nil
+	}
+
+	if v, ok := env.GetQubit(name); ok {
+		return fmt.Sprintf("%s = qubit%v", name, q.Index(v...)), nil
+	}
+
+	return "", fmt.Errorf("undefined %q", name)
+}
+
+func bits(list ...bool) string {
+	var b strings.Builder
+	for _, v := range list {
+		if v {
+			b.WriteString("1")
+			continue
+		}
+
+		b.WriteString("0")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,141 @@
+package debugger_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/itsubaki/qasm/debugger"
+	"github.com/itsubaki/qasm/environ"
+)
+
+func input(commands ...string) <-chan string {
+	in := make(chan string, len(commands))
+	for _, c := range commands {
+		in <- c
+	}
+
+	close(in)
+	return in
+}
+
+func ExampleDebugger() {
+	text := `OPENQASM 3.0;
+gate h q { U(pi/2.0, 0, pi) q; }
+gate cx c, t { ctrl @ U(pi, 0, pi) c, t; }
+qubit[2] q;
+int n = 0;
+h q[0];
+cx q[0], q[1];
+n = n + 1;
+`
+
+	d := debugger.New(text, input("b 7", "c", "p n q", "state", "n", "s", "s", "p n"), os.Stdout)
+	if err := d.Run(); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// 2: gate h q { U(pi/2.0, 0, pi) q; }
+	// debug> debug> 7: cx q[0], q[1];
+	// debug> n = 0
+	// q = qubit[0 1]
+	// debug> [00][  0]( 0.7071 0.0000i): 0.5000
+	// [10][  2]( 0.7071 0.0000i): 0.5000
+	// debug> 8: n = n + 1;
+	// debug> finished
+	// [00][  0]( 0.7071 0.0000i): 0.5000
+	// [11][  3]( 0.7071 0.0000i): 0.5000
+}
+
+func ExampleDebugger_step() {
+	text := `gate x q { U(pi, 0, pi) q; }
+def f(qubit q) {
+  x q;
+}
+qubit q;
+f(q);
+U(0, 0, 0) q;
+`
+
+	d := debugger.New(text, input("b 6", "c", "s", "s", "s", "l", "q"), os.Stdout)
+	if err := d.Run(); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// 1: gate x q { U(pi, 0, pi) q; }
+	// debug> debug> 6: f(q);
+	// debug> 3: x q;
+	// debug> 1: gate x q { U(pi, 0, pi) q; }
+	// debug> 7: U(0, 0, 0) q;
+	// debug>      5  qubit q;
+	// *    6  f(q);
+	//  >   7  U(0, 0, 0) q;
+	//      8
+	// debug>
+}
+
+func ExamplePrint() {
+	env := environ.New()
+	env.Const["n"] = int64(3)
+	env.BitArray["c"] = []bool{true, false}
+
+	enclosed := env.NewEnclosed()
+	enclosed.Variable["theta"] = 0.5
+
+	for _, name := range []string{"n", "c", "theta"} {
+		s, err := debugger.Print(enclosed, name)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println(s)
+	}
+
+	// Output:
+	// n = 3
+	// c = 10
+	// theta = 0.5
+}
+
+func TestDebugger_Command(t *testing.T) {
+	cases := []struct {
+		command string
+		want    string
+	}{
+		{command: "b", want: "breakpoints: []\n"},
+		{command: "b x", want: "invalid line \"x\"\n"},
+		{command: "b 0", want: "invalid line \"0\"\n"},
+		{command: "d 9", want: "invalid line \"9\"\n"},
+		{command: "p", want: "usage: print name\n"},
+		{command: "p x", want: "undefined \"x\"\n"},
+		{command: "foo", want: "unknown command \"foo\"\n"},
+		{command: "", want: ""},
+	}
+
+	for _, c := range cases {
+		var buf bytes.Buffer
+		d := debugger.New("qubit q;", input(c.command), &buf)
+		if err := d.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "1: qubit q;\ndebug> " + c.want + "debug> "
+		if buf.String() != want {
+			t.Errorf("%q: got=%q, want=%q", c.command, buf.String(), want)
+		}
+	}
+}
+
+func TestDebugger_Run(t *testing.T) {
+	var buf bytes.Buffer
+	if err := debugger.New("qubit q; x q;", input("c"), &buf).Run(); err == nil {
+		t.Errorf("got=nil, want error")
+	}
+
+	if err := debugger.New("qubit q", input(), &buf).Run(); err == nil {
+		t.Errorf("got=nil, want error")
+	}
+}
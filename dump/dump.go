@@ -0,0 +1,222 @@
+package dump
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/itsubaki/qasm/session"
+)
+
+// Qubits returns the qubits of the simulator from the least significant bit of the index of the dumped state.
+// The qubits are in the order of env.Index(), that is, the first qubit of the first register is the least significant bit.
+// The qubits not in any register follow them in the order of the simulator.
+func Qubits(snapshot *session.Snapshot) []int {
+	n := size(snapshot)
+	seen := make([]bool, n)
+
+	var qubits []int
+	for _, reg := range snapshot.Env.Index() {
+		for _, k := range reg {
+			if k < 0 || k >= n || seen[k] {
+				continue
+			}
+
+			seen[k] = true
+			qubits = append(qubits, k)
+		}
+	}
+
+	for k := range n {
+		if !seen[k] {
+			qubits = append(qubits, k)
+		}
+	}
+
+	return qubits
+}
+
+// Amplitudes returns the state vector in the little-endian order of Qubits.
+// The bit j of the index is the value of the qubit Qubits()[j].
+// The state of no qubits is the single amplitude 1.
+func Amplitudes(snapshot *session.Snapshot) []complex128 {
+	if len(snapshot.State) == 0 {
+		return []complex128{1}
+	}
+
+	n := size(snapshot)
+	qubits := Qubits(snapshot)
+
+	out := make([]complex128, len(snapshot.State))
+	for i, a := range snapshot.State {
+		var j int
+		for p, k := range qubits {
+			// the qubit k is the bit n-1-k of the index of the simulator
+			j |= (i >> (n - 1 - k) & 1) << p
+		}
+
+		out[j] = a
+	}
+
+	return out
+}
+
+// WriteNPY writes the amplitudes as a NumPy .npy file of complex128 (<c16) with the shape (len,).
+func WriteNPY(w io.Writer, amplitudes []complex128) error {
+	header := fmt.Sprintf("{'descr': '<c16', 'fortran_order': False, 'shape': (%d,), }", len(amplitudes))
+
+	// the magic, the version and the length of the header are 10 bytes,
+	// and the total is padded with spaces to a multiple of 64 ending with a newline.
+	pad := 64 - (10+len(header)+1)%64
+	if pad == 64 {
+		pad = 0
+	}
+	header += strings.Repeat(" ", pad) + "\n"
+
+	buf := make([]byte, 0, 10+len(header)+16*len(amplitudes))
+	buf = append(buf, "\x93NUMPY\x01\x00"...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(header)))
+	buf = append(buf, header...)
+	for _, a := range amplitudes {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(real(a)))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(imag(a)))
+	}
+
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("write npy: %w", err)
+	}
+
+	return nil
+}
+
+// WriteProbabilities writes the probability of each basis state as CSV.
+// The columns are the index in the order of Amplitudes, the value of each register and the probability.
+// The value of the register is the integer of its qubits, and the first qubit is the least significant bit.
+func WriteProbabilities(w io.Writer, snapshot *session.Snapshot) error {
+	names := snapshot.Env.QubitOrder
+	index := snapshot.Env.Index()
+	pos := positions(snapshot)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(slices.Concat([]string{"index"}, names, []string{"probability"})); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+
+	for i, a := range Amplitudes(snapshot) {
+		record := []string{strconv.Itoa(i)}
+		for _, reg := range index {
+			record = append(record, strconv.Itoa(value(i, pos, reg)))
+		}
+
+		record = append(record, format(probability(a)))
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("write csv: %w", err)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+
+	return nil
+}
+
+// Marginal is the marginal probabilities of the register.
+// Probabilities are indexed by the value of the register, and the first qubit is the least significant bit.
+type Marginal struct {
+	Register      string
+	Probabilities []float64
+}
+
+// Marginals returns the marginal probabilities of each register in the order of env.Index().
+func Marginals(snapshot *session.Snapshot) []Marginal {
+	index := snapshot.Env.Index()
+	pos := positions(snapshot)
+
+	marginals := make([]Marginal, len(index))
+	for r, reg := range index {
+		marginals[r] = Marginal{
+			Register:      snapshot.Env.QubitOrder[r],
+			Probabilities: make([]float64, 1<<len(reg)),
+		}
+	}
+
+	for i, a := range Amplitudes(snapshot) {
+		p := probability(a)
+		for r, reg := range index {
+			marginals[r].Probabilities[value(i, pos, reg)] += p
+		}
+	}
+
+	return marginals
+}
+
+// WriteMarginals writes the marginal probabilities of each register as CSV.
+// The columns are the register, its value and the probability.
+func WriteMarginals(w io.Writer, snapshot *session.Snapshot) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"register", "value", "probability"}); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+
+	for _, m := range Marginals(snapshot) {
+		for v, p := range m.Probabilities {
+			if err := cw.Write([]string{m.Register, strconv.Itoa(v), format(p)}); err != nil {
+				return fmt.Errorf("write csv: %w", err)
+			}
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+
+	return nil
+}
+
+// size returns the number of the qubits of the state.
+func size(snapshot *session.Snapshot) int {
+	if len(snapshot.State) == 0 {
+		return 0
+	}
+
+	return bits.Len(uint(len(snapshot.State))) - 1
+}
+
+// positions returns the bit of the index of Amplitudes for each qubit of the simulator.
+func positions(snapshot *session.Snapshot) []int {
+	qubits := Qubits(snapshot)
+	pos := make([]int, len(qubits))
+	for p, k := range qubits {
+		pos[k] = p
+	}
+
+	return pos
+}
+
+// value returns the value of the register in the index of Amplitudes.
+func value(i int, pos []int, reg []int) int {
+	var v int
+	for b, k := range reg {
+		v |= (i >> pos[k] & 1) << b
+	}
+
+	return v
+}
+
+func probability(a complex128) float64 {
+	return real(a)*real(a) + imag(a)*imag(a)
+}
+
+// format returns the shortest representation that round-trips.
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
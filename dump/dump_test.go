@@ -0,0 +1,179 @@
+package dump_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/itsubaki/qasm/dump"
+	xparser "github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/session"
+)
+
+func snapshot(text string) *session.Snapshot {
+	program, err := xparser.Parse(text)
+	if err != nil {
+		panic(err)
+	}
+
+	s := session.New()
+	if err := s.Visitor().Run(program); err != nil {
+		panic(err)
+	}
+
+	return s.Snapshot()
+}
+
+func ExampleAmplitudes() {
+	// q[0] and r[0] are 1
+	s := snapshot(`
+		qubit[2] q;
+		qubit r;
+		U(pi, 0, pi) q[0];
+		U(pi, 0, pi) r[0];
+	`)
+
+	fmt.Println(dump.Qubits(s))
+	for i, a := range dump.Amplitudes(s) {
+		if math.Abs(real(a)) > 0.5 {
+			fmt.Printf("%03b\n", i)
+		}
+	}
+
+	// Output:
+	// [0 1 2]
+	// 101
+}
+
+func ExampleWriteProbabilities() {
+	// q[1] is 1
+	s := snapshot("qubit[2] q; qubit r;")
+	s.State = []complex128{0, 0, 1, 0, 0, 0, 0, 0}
+
+	if err := dump.WriteProbabilities(os.Stdout, s); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// index,q,r,probability
+	// 0,0,0,0
+	// 1,1,0,0
+	// 2,2,0,1
+	// 3,3,0,0
+	// 4,0,1,0
+	// 5,1,1,0
+	// 6,2,1,0
+	// 7,3,1,0
+}
+
+func ExampleWriteMarginals() {
+	// q[1] and r[0] are 1
+	s := snapshot("qubit[2] q; qubit r;")
+	s.State = []complex128{0, 0, 0, 1, 0, 0, 0, 0}
+
+	if err := dump.WriteMarginals(os.Stdout, s); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// register,value,probability
+	// q,0,0
+	// q,1,0
+	// q,2,1
+	// q,3,0
+	// r,0,0
+	// r,1,1
+}
+
+func Example_noQubits() {
+	s := snapshot("int n = 3; bit c;")
+
+	fmt.Println(dump.Qubits(s))
+	fmt.Println(dump.Amplitudes(s))
+	if err := dump.WriteProbabilities(os.Stdout, s); err != nil {
+		panic(err)
+	}
+
+	if err := dump.WriteMarginals(os.Stdout, s); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// []
+	// [(1+0i)]
+	// index,probability
+	// 0,1
+	// register,value,probability
+}
+
+func TestWriteNPY(t *testing.T) {
+	cases := [][]complex128{
+		{},
+		{complex(0.5, -0.5), complex(0, math.Sqrt2/2)},
+		make([]complex128, 1<<10),
+	}
+
+	for _, amplitudes := range cases {
+		var buf bytes.Buffer
+		if err := dump.WriteNPY(&buf, amplitudes); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+
+		b := buf.Bytes()
+		if string(b[:8]) != "\x93NUMPY\x01\x00" {
+			t.Fatalf("magic=%q", b[:8])
+		}
+
+		n := int(binary.LittleEndian.Uint16(b[8:10]))
+		if (10+n)%64 != 0 || b[10+n-1] != '\n' {
+			t.Errorf("header length=%d", n)
+		}
+
+		want := fmt.Sprintf("{'descr': '<c16', 'fortran_order': False, 'shape': (%d,), }", len(amplitudes))
+		if string(b[10:10+len(want)]) != want {
+			t.Errorf("got=%q, want=%q", b[10:10+len(want)], want)
+		}
+
+		data := b[10+n:]
+		if len(data) != 16*len(amplitudes) {
+			t.Fatalf("got=%d, want=%d", len(data), 16*len(amplitudes))
+		}
+
+		for i, a := range amplitudes {
+			re := math.Float64frombits(binary.LittleEndian.Uint64(data[16*i:]))
+			im := math.Float64frombits(binary.LittleEndian.Uint64(data[16*i+8:]))
+			if complex(re, im) != a {
+				t.Errorf("got=%v, want=%v", complex(re, im), a)
+			}
+		}
+	}
+}
+
+func TestMarginals(t *testing.T) {
+	s := snapshot(`
+		qubit[2] q;
+		qubit r;
+		U(pi/2.0, 0, pi) q[0];
+		ctrl @ U(pi, 0, pi) q[0], r;
+	`)
+
+	want := map[string][]float64{
+		"q": {0.5, 0.5, 0, 0},
+		"r": {0.5, 0.5},
+	}
+
+	for _, m := range dump.Marginals(s) {
+		if len(m.Probabilities) != len(want[m.Register]) {
+			t.Fatalf("%s: got=%v, want=%v", m.Register, m.Probabilities, want[m.Register])
+		}
+
+		for i, p := range m.Probabilities {
+			if math.Abs(p-want[m.Register][i]) > 1e-13 {
+				t.Errorf("%s: got=%v, want=%v", m.Register, m.Probabilities, want[m.Register])
+			}
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package environ
 
 import (
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
 	"github.com/itsubaki/q"
 	"github.com/itsubaki/qasm/gen/parser"
 )
@@ -25,6 +30,16 @@ type Gate struct {
 	Body   parser.IScopeContext
 }
 
+// String returns the signature of the gate such as gate cu(theta) c, t.
+func (g *Gate) String() string {
+	s := "gate " + g.Name
+	if len(g.Params) > 0 {
+		s += "(" + strings.Join(g.Params, ", ") + ")"
+	}
+
+	return s + " " + strings.Join(g.QArgs, ", ")
+}
+
 type Subroutine struct {
 	Name       string
 	QArgs      []string
@@ -172,6 +187,84 @@ func (e *Environ) GetSubroutine(name string) (*Subroutine, bool) {
 	return nil, false
 }
 
+// Clone returns a deep copy of the environment and the outer ones.
+// The values of the variables and the constants are copied including the arrays and the angles.
+// The gates and the subroutines are shared since their definitions are not modified.
+func (e *Environ) Clone() *Environ {
+	if e == nil {
+		return nil
+	}
+
+	c := &Environ{
+		Version:    e.Version,
+		Const:      make(map[string]any, len(e.Const)),
+		Variable:   make(map[string]any, len(e.Variable)),
+		QubitOrder: slices.Clone(e.QubitOrder),
+		Qubit:      make(map[string][]q.Qubit, len(e.Qubit)),
+		BitArray:   make(map[string][]bool, len(e.BitArray)),
+		Bit:        maps.Clone(e.Bit),
+		Gate:       maps.Clone(e.Gate),
+		Subroutine: maps.Clone(e.Subroutine),
+		Outer:      e.Outer.Clone(),
+	}
+
+	for k, v := range e.Const {
+		c.Const[k] = clone(v)
+	}
+
+	for k, v := range e.Variable {
+		c.Variable[k] = clone(v)
+	}
+
+	for k, v := range e.Qubit {
+		c.Qubit[k] = slices.Clone(v)
+	}
+
+	for k, v := range e.BitArray {
+		c.BitArray[k] = slices.Clone(v)
+	}
+
+	return c
+}
+
+// clone returns a deep copy of the slices and the pointers to the structs in the value.
+func clone(v any) any {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := range rv.Len() {
+			e := rv.Index(i)
+			switch e.Kind() {
+			case reflect.Interface, reflect.Slice, reflect.Pointer:
+				if e.IsNil() {
+					continue
+				}
+
+				c.Index(i).Set(reflect.ValueOf(clone(e.Interface())))
+			default:
+				c.Index(i).Set(e)
+			}
+		}
+
+		return c.Interface()
+	case reflect.Pointer:
+		if rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+			return v
+		}
+
+		c := reflect.New(rv.Elem().Type())
+		c.Elem().Set(rv.Elem())
+		return c.Interface()
+	default:
+		return v
+	}
+}
+
 // Index returns the index of all qubits in the order they were declared.
 func (e *Environ) Index() [][]int {
 	var index [][]int
@@ -204,6 +204,15 @@ func ExampleEnviron_GetGate() {
 	// y true
 }
 
+func ExampleGate_String() {
+	fmt.Println(&environ.Gate{Name: "x", QArgs: []string{"q"}})
+	fmt.Println(&environ.Gate{Name: "cu", Params: []string{"theta", "phi"}, QArgs: []string{"c", "t"}})
+
+	// Output:
+	// gate x q
+	// gate cu(theta, phi) c, t
+}
+
 func ExampleEnviron_GetSubroutine() {
 	env := environ.New()
 	env.Subroutine["qft"] = &environ.Subroutine{
@@ -239,3 +248,28 @@ func ExampleEnviron_Index() {
 	// Output:
 	// [[0 1] [2 3 4]]
 }
+
+func ExampleEnviron_Clone() {
+	env := environ.New()
+	env.Variable["a"] = []any{int64(1), []int8{2}}
+	env.BitArray["c"] = []bool{false, true}
+	env.QubitOrder = []string{"q"}
+	env.Qubit["q"] = []q.Qubit{0, 1}
+
+	enclosed := env.NewEnclosed()
+	enclosed.Bit["b"] = true
+
+	c := enclosed.Clone()
+	c.Outer.Variable["a"].([]any)[1].([]int8)[0] = 3
+	c.Outer.BitArray["c"][0] = true
+	c.Outer.Qubit["q"][0] = 2
+	c.Outer.QubitOrder[0] = "r"
+	c.Bit["b"] = false
+
+	fmt.Println(env.Variable, env.BitArray, env.Qubit, env.QubitOrder, enclosed.Bit)
+	fmt.Println(c.Outer.Variable, c.Outer.BitArray, c.Outer.Qubit, c.Outer.QubitOrder, c.Bit)
+
+	// Output:
+	// map[a:[1 [2]]] map[c:[false true]] map[q:[0 1]] [q] map[b:true]
+	// map[a:[1 [3]]] map[c:[true true]] map[q:[2 1]] [r] map[b:false]
+}
@@ -0,0 +1,278 @@
+package flatten
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/antlr4-go/antlr/v4"
+	"github.com/itsubaki/qasm/environ"
+	xparser "github.com/itsubaki/qasm/parser"
+)
+
+const (
+	U       = "U"
+	GPhase  = "gphase"
+	Measure = "measure"
+	Reset   = "reset"
+	Barrier = "barrier"
+)
+
+// Program is a straight-line quantum program.
+type Program struct {
+	Qubits []Register `json:"qubits"`
+	Bits   []Register `json:"bits"`
+	Gates  []string   `json:"gates,omitempty"`
+	Ops    []Op       `json:"ops"`
+	calls  int
+}
+
+// Register is a declared qubit or bit register.
+type Register struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	Scalar bool   `json:"scalar,omitempty"`
+}
+
+// Op is an operation of the program.
+// Qubits and bits are global indices in the order they were declared.
+// Gate is the name of the innermost user-defined gate that the op is expanded from,
+// and Call is the id of the call of it, which is different for each qubit of the broadcast over registers.
+type Op struct {
+	Name    string    `json:"name"`
+	Params  []float64 `json:"params,omitempty"`
+	Control []int     `json:"control,omitempty"`
+	Target  []int     `json:"target,omitempty"`
+	Bit     []int     `json:"bit,omitempty"`
+	Cond    string    `json:"cond,omitempty"`
+	Gate    string    `json:"gate,omitempty"`
+	Call    int       `json:"call,omitempty"`
+}
+
+// Qubits returns the control and target qubits of the op.
+func (o Op) Qubits() []int {
+	var qubits []int
+	qubits = append(qubits, o.Control...)
+	qubits = append(qubits, o.Target...)
+	return qubits
+}
+
+// Flatten returns the straight-line program of the input text.
+func Flatten(text string) (*Program, error) {
+	program, err := xparser.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return Build(program)
+}
+
+// Build returns the straight-line program of the tree.
+func Build(tree antlr.ParseTree) (*Program, error) {
+	return NewVisitor(environ.New()).Build(tree)
+}
+
+// NumQubits returns the number of qubits.
+func (p *Program) NumQubits() int {
+	var n int
+	for _, r := range p.Qubits {
+		n += r.Size
+	}
+
+	return n
+}
+
+// NumBits returns the number of bits.
+func (p *Program) NumBits() int {
+	var n int
+	for _, r := range p.Bits {
+		n += r.Size
+	}
+
+	return n
+}
+
+// IsGate returns true if the op is a gate acting on qubits.
+func (o Op) IsGate() bool {
+	switch o.Name {
+	case Measure, Reset, Barrier, GPhase:
+		return false
+	default:
+		return true
+	}
+}
+
+// NumGates returns the number of gates.
+func (p *Program) NumGates() int {
+	var n int
+	for _, op := range p.Ops {
+		if op.IsGate() {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Depth returns the number of layers of the program.
+// A barrier aligns its qubits without adding a layer.
+func (p *Program) Depth() int {
+	return Depth(p.Ops, func(Op) bool { return true })
+}
+
+// Depth returns the number of layers of the ops that satisfy the filter.
+func Depth(ops []Op, filter func(op Op) bool) int {
+	var depth int
+	layer := make(map[int]int)
+	for _, op := range ops {
+		qubits := op.Qubits()
+
+		var d int
+		for _, q := range qubits {
+			d = max(d, layer[q])
+		}
+
+		if op.Name != Barrier && op.Name != GPhase && filter(op) {
+			d++
+		}
+
+		for _, q := range qubits {
+			layer[q] = d
+		}
+
+		depth = max(depth, d)
+	}
+
+	return depth
+}
+
+// QubitName returns the name of the i-th qubit.
+// A qubit that is not covered by any register is a physical qubit such as $0.
+func (p *Program) QubitName(i int) string {
+	return name(p.Qubits, i)
+}
+
+// BitName returns the name of the i-th bit.
+func (p *Program) BitName(i int) string {
+	return name(p.Bits, i)
+}
+
+// Statement returns the OpenQASM 3 statement of the op.
+func (p *Program) Statement(op Op) string {
+	qubits := func(list []int) string {
+		names := make([]string, len(list))
+		for i, q := range list {
+			names[i] = p.QubitName(q)
+		}
+
+		return strings.Join(names, ", ")
+	}
+
+	var s string
+	switch op.Name {
+	case Measure:
+		s = fmt.Sprintf("measure %s;", qubits(op.Target))
+		if len(op.Bit) > 0 {
+			s = fmt.Sprintf("%s = %s", p.BitName(op.Bit[0]), s)
+		}
+	case Reset:
+		s = fmt.Sprintf("reset %s;", qubits(op.Target))
+	case Barrier:
+		s = "barrier;"
+		if len(op.Target) > 0 {
+			s = fmt.Sprintf("barrier %s;", qubits(op.Target))
+		}
+	case GPhase:
+		s = fmt.Sprintf("gphase(%s);", params(op.Params))
+	case U:
+		var mod string
+		switch len(op.Control) {
+		case 0:
+		case 1:
+			mod = "ctrl @ "
+		default:
+			mod = fmt.Sprintf("ctrl(%d) @ ", len(op.Control))
+		}
+
+		s = fmt.Sprintf("%sU(%s) %s;", mod, params(op.Params), qubits(op.Qubits()))
+	default:
+		// user-defined gates take the controls as leading operands. e.g. cx c, t;
+		if len(op.Params) > 0 {
+			s = fmt.Sprintf("%s(%s) %s;", op.Name, params(op.Params), qubits(op.Qubits()))
+			break
+		}
+
+		s = fmt.Sprintf("%s %s;", op.Name, qubits(op.Qubits()))
+	}
+
+	if op.Cond != "" {
+		return fmt.Sprintf("if (%s) { %s }", op.Cond, s)
+	}
+
+	return s
+}
+
+// String returns the program as OpenQASM 3.
+func (p *Program) String() string {
+	var b strings.Builder
+	b.WriteString("OPENQASM 3.0;\n")
+
+	for _, g := range p.Gates {
+		b.WriteString(g + "\n")
+	}
+
+	for _, r := range p.Qubits {
+		if strings.HasPrefix(r.Name, "$") {
+			// physical qubits are not declared.
+			continue
+		}
+
+		b.WriteString(Declaration("qubit", r) + "\n")
+	}
+
+	for _, r := range p.Bits {
+		b.WriteString(Declaration("bit", r) + "\n")
+	}
+
+	for _, op := range p.Ops {
+		b.WriteString(p.Statement(op) + "\n")
+	}
+
+	return b.String()
+}
+
+func name(regs []Register, i int) string {
+	for _, r := range regs {
+		if i >= r.Size {
+			i -= r.Size
+			continue
+		}
+
+		if r.Scalar {
+			return r.Name
+		}
+
+		return fmt.Sprintf("%s[%d]", r.Name, i)
+	}
+
+	return fmt.Sprintf("$%d", i)
+}
+
+// Declaration returns the declaration of the register of the type such as qubit and bit.
+func Declaration(typ string, r Register) string {
+	if r.Scalar {
+		return fmt.Sprintf("%s %s;", typ, r.Name)
+	}
+
+	return fmt.Sprintf("%s[%d] %s;", typ, r.Size, r.Name)
+}
+
+func params(p []float64) string {
+	list := make([]string, len(p))
+	for i := range p {
+		// +0 instead of -0
+		list[i] = strconv.FormatFloat(p[i]+0, 'g', -1, 64)
+	}
+
+	return strings.Join(list, ", ")
+}
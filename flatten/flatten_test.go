@@ -0,0 +1,334 @@
+package flatten_test
+
+import (
+	"errors"
+	"fmt"
+	"math/cmplx"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/itsubaki/q/math/epsilon"
+	"github.com/itsubaki/q/quantum/gate"
+	"github.com/itsubaki/qasm/flatten"
+	xparser "github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+func ExampleFlatten() {
+	text := `
+	OPENQASM 3.0;
+	gate h q { U(pi/2.0, 0, pi) q; }
+	gate cx c, t { ctrl @ U(pi, 0, pi) c, t; }
+
+	const int n = 3;
+	qubit[n] q;
+	bit[n] c;
+
+	h q[0];
+	for int i in [0:n-2] {
+		cx q[i], q[i+1];
+	}
+
+	c = measure q;
+	if (c[0]) { inv @ h q[0]; }
+	`
+
+	p, err := flatten.Flatten(text)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(p)
+
+	// Output:
+	// OPENQASM 3.0;
+	// qubit[3] q;
+	// bit[3] c;
+	// U(1.5707963267948966, 0, 3.141592653589793) q[0];
+	// ctrl @ U(3.141592653589793, 0, 3.141592653589793) q[0], q[1];
+	// ctrl @ U(3.141592653589793, 0, 3.141592653589793) q[1], q[2];
+	// c[0] = measure q[0];
+	// c[1] = measure q[1];
+	// c[2] = measure q[2];
+	// if (c[0]) { U(-1.5707963267948966, -3.141592653589793, 0) q[0]; }
+}
+
+func ExampleProgram_QubitName() {
+	p := &flatten.Program{
+		Qubits: []flatten.Register{
+			{Name: "q", Size: 2},
+			{Name: "a", Size: 1, Scalar: true},
+		},
+	}
+
+	fmt.Println(p.QubitName(0), p.QubitName(1), p.QubitName(2), p.QubitName(3))
+
+	// Output:
+	// q[0] q[1] a $0
+}
+
+func ExampleEuler() {
+	theta, phi, lambda, gamma := flatten.Euler(visitor.Pow2x2(gate.X(), 0.5))
+	fmt.Printf("%.4f %.4f %.4f %.4f\n", theta, phi, lambda, gamma)
+
+	// Output:
+	// 1.5708 -1.5708 1.5708 0.7854
+}
+
+func TestFlatten(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		{text: "../testdata/deutsch_jozsa_balanced.qasm"},
+		{text: "../testdata/grover.qasm"},
+		{text: "../testdata/qft.qasm"},
+		{text: "../testdata/qsp.qasm"},
+		{text: "../testdata/quantum_counting.qasm"},
+		{
+			text: `
+			gate x q { U(pi, 0, pi) q; }
+			gate h q { U(pi/2.0, 0, pi) q; }
+			gate cx c, t { ctrl @ x c, t; }
+			gate bell a, b { h a; cx a, b; }
+			qubit[3] q;
+			U(0.1, 0.2, 0.3) q;
+			inv @ bell q[0], q[1];
+			pow(2) @ bell q[1], q[2];
+			pow(-1) @ bell q[1], q[2];
+			pow(0.5) @ x q[0];
+			pow(0.3) @ U(1.1, 0.2, -0.7) q[1];
+			ctrl @ bell q[2], q[0], q[1];
+			negctrl(2) @ U(0.4, 0.5, 0.6) q[0], q[1], q[2];
+			ctrl @ gphase(pi/3) q[1];
+			gphase(0.25);
+			pow(0.5) @ cx q[2], q[0];
+			`,
+			want: `
+			qubit[3] q;
+			U(0.1, 0.2, 0.3) q;
+			ctrl @ inv @ U(pi, 0, pi) q[0], q[1];
+			inv @ U(pi/2.0, 0, pi) q[0];
+			U(pi/2.0, 0, pi) q[1];
+			ctrl @ U(pi, 0, pi) q[1], q[2];
+			U(pi/2.0, 0, pi) q[1];
+			ctrl @ U(pi, 0, pi) q[1], q[2];
+			ctrl @ inv @ U(pi, 0, pi) q[1], q[2];
+			inv @ U(pi/2.0, 0, pi) q[1];
+			pow(0.5) @ U(pi, 0, pi) q[0];
+			pow(0.3) @ U(1.1, 0.2, -0.7) q[1];
+			ctrl @ U(pi/2.0, 0, pi) q[2], q[0];
+			ctrl(2) @ U(pi, 0, pi) q[2], q[0], q[1];
+			negctrl(2) @ U(0.4, 0.5, 0.6) q[0], q[1], q[2];
+			U(0, 0, pi/3) q[1];
+			ctrl @ pow(0.5) @ U(pi, 0, pi) q[2], q[0];
+			`,
+		},
+		{
+			text: `
+			gate rz(theta) q { U(0, 0, theta) q; }
+			qubit q;
+			int n = 0;
+			while (n < 3) { rz(n * pi / 4) q; n = n + 1; }
+			switch (n) { case 3 { U(1, 2, 3) q; } default { U(3, 2, 1) q; } }
+			for int i in [1:4] { if (i == 3) { continue; } rz(i) q; }
+			end;
+			U(1, 1, 1) q;
+			`,
+		},
+		{
+			text: `
+			U(0.1, 0.2, 0.3) $1;
+			ctrl @ U(pi, 0, pi) $1, $0;
+			U(0.4, 0.5, 0.6) $2;
+			`,
+		},
+	}
+
+	for _, c := range cases {
+		text := c.text
+		if b, err := os.ReadFile(c.text); err == nil {
+			text = string(b)
+		}
+
+		p, err := flatten.Flatten(text)
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		ref := text
+		if c.want != "" {
+			// the visitor does not support modifiers on user-defined gates.
+			ref = c.want
+		}
+
+		want, _, err := visitor.Run(ref)
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		got, _, err := visitor.Run(p.String())
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+
+		// equal up to global phase
+		var inner complex128
+		for i, a := range want.Amplitude() {
+			inner += cmplx.Conj(a) * got.Amplitude()[i]
+		}
+
+		if !epsilon.IsZeroF64(cmplx.Abs(inner)-1, 1e-8) {
+			t.Errorf("%s: |<want|got>|=%v", c.text, cmplx.Abs(inner))
+		}
+	}
+}
+
+func TestFlatten_condition(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{
+			text: `
+			qubit[2] q;
+			bit[2] c;
+			c = measure q;
+			for int i in [0:1] { if (c[i] == 1) { U(pi, 0, pi) q[1 - i]; } }
+			`,
+			want: []string{
+				"if (c[0] == 1) { U(3.141592653589793, 0, 3.141592653589793) q[1]; }",
+				"if (c[1] == 1) { U(3.141592653589793, 0, 3.141592653589793) q[0]; }",
+			},
+		},
+		{
+			text: `
+			qubit[2] q;
+			bit[2] c;
+			def f(qubit a, int k) { if (c[k] == k) { U(pi, 0, pi) a; } else { U(0, 0, pi) a; } }
+			c = measure q;
+			f(q[0], 1);
+			`,
+			want: []string{
+				"if (c[1] == 1) { U(3.141592653589793, 0, 3.141592653589793) q[0]; }",
+				"if (!(c[1] == 1)) { U(0, 0, 3.141592653589793) q[0]; }",
+			},
+		},
+		{
+			text: `
+			qubit q;
+			bit c;
+			const int n = 2;
+			c = measure q;
+			if (!c && (n > 1)) { U(pi, 0, pi) q; }
+			`,
+			want: []string{
+				"if (!c && true) { U(3.141592653589793, 0, 3.141592653589793) q; }",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		p, err := flatten.Flatten(c.text)
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		var got []string
+		for _, op := range p.Ops {
+			if op.Cond != "" {
+				got = append(got, p.Statement(op))
+			}
+		}
+
+		if !slices.Equal(got, c.want) {
+			t.Errorf("got=%q, want=%q", got, c.want)
+		}
+
+		if _, err := xparser.Parse(p.String()); err != nil {
+			t.Errorf("%s: %v", p, err)
+		}
+	}
+}
+
+func TestFlatten_error(t *testing.T) {
+	cases := []struct {
+		text   string
+		errMsg string
+		target error
+	}{
+		{
+			text:   `qubit q; x q;`,
+			errMsg: `undefined "x"`,
+		},
+		{
+			text:   `qubit q; qubit q;`,
+			errMsg: `"q" redeclared`,
+		},
+		{
+			text:   `qubit q; bit c = measure q; while (c) { U(0, 0, 0) q; }`,
+			target: visitor.ErrNotImplemented,
+		},
+		{
+			text:   `while (true) { }`,
+			target: visitor.ErrTooManyIterations,
+		},
+		{
+			text:   `int n = 1; while (n) { }`,
+			errMsg: `condition must be a bool "n"`,
+		},
+		{
+			text:   `qubit q; bit c = measure q; for int i in [0:1] { if (c) { break; } U(0, 0, 0) q; }`,
+			target: visitor.ErrNotImplemented,
+		},
+		{
+			text:   `qubit q; bit c = measure q; while (true) { if (c) { break; } }`,
+			target: visitor.ErrNotImplemented,
+		},
+		{
+			text:   `qubit q; bit c = measure q; int n = c + 1;`,
+			target: visitor.ErrNotImplemented,
+		},
+		{
+			text:   `qubit[2] q; pow(0.5) @ ctrl @ U(pi, 0, pi) q[0], q[1];`,
+			target: visitor.ErrNotImplemented,
+		},
+		{
+			text:   `gate bell a, b { U(pi/2.0, 0, pi) a; ctrl @ U(pi, 0, pi) a, b; } qubit[2] q; pow(0.5) @ bell q[0], q[1];`,
+			target: visitor.ErrNotImplemented,
+		},
+		{
+			text:   `qubit[2] q; bit c; c = measure q;`,
+			errMsg: "assign 2 measured qubits to 1 bits",
+		},
+		{
+			text:   `qubit q; U(1, 2) q;`,
+			errMsg: "U: need 3 params, got 2",
+		},
+		{
+			text:   `qubit[ q;`,
+			errMsg: "1:8: mismatched input ';' expecting ']'",
+		},
+	}
+
+	for _, c := range cases {
+		_, err := flatten.Flatten(c.text)
+		if err == nil {
+			t.Errorf("%s: expected error", c.text)
+			continue
+		}
+
+		if c.target != nil {
+			if !errors.Is(err, c.target) {
+				t.Errorf("got=%v, want=%v", err, c.target)
+			}
+
+			continue
+		}
+
+		if err.Error() != c.errMsg {
+			t.Errorf("got=%v, want=%v", err, c.errMsg)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package flatten
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"slices"
+
+	"github.com/itsubaki/q/math/epsilon"
+	"github.com/itsubaki/q/math/matrix"
+	"github.com/itsubaki/q/quantum/gate"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+// X returns the ops that flip the qubits.
+func X(qubits ...int) []Op {
+	ops := make([]Op, len(qubits))
+	for i, q := range qubits {
+		ops[i] = Op{
+			Name:   U,
+			Params: []float64{math.Pi, 0, math.Pi},
+			Target: []int{q},
+		}
+	}
+
+	return ops
+}
+
+// Inverse returns the inverse of the ops.
+func Inverse(ops []Op) []Op {
+	inv := make([]Op, 0, len(ops))
+	for _, op := range slices.Backward(ops) {
+		switch op.Name {
+		case U:
+			// U(theta, phi, lambda)^dagger = U(-theta, -lambda, -phi)
+			op.Params = []float64{-op.Params[0], -op.Params[2], -op.Params[1]}
+		case GPhase:
+			op.Params = []float64{-op.Params[0]}
+		}
+
+		inv = append(inv, op)
+	}
+
+	return inv
+}
+
+// Controlled returns the ops controlled by the qubits.
+func Controlled(ops []Op, ctrl []int) []Op {
+	if len(ctrl) == 0 {
+		return ops
+	}
+
+	out := make([]Op, 0, len(ops))
+	for _, op := range ops {
+		switch op.Name {
+		case GPhase:
+			// ctrl(n) @ gphase(a) is ctrl(n-1) @ U(0, 0, a) on the last control.
+			last := len(ctrl) - 1
+			out = append(out, Op{
+				Name:    U,
+				Params:  []float64{0, 0, op.Params[0]},
+				Control: slices.Clone(ctrl[:last]),
+				Target:  []int{ctrl[last]},
+			})
+		default:
+			op.Control = append(slices.Clone(ctrl), op.Control...)
+			out = append(out, op)
+		}
+	}
+
+	return out
+}
+
+// NegControlled returns the ops controlled by the qubits being in the zero state.
+func NegControlled(ops []Op, ctrl []int) []Op {
+	if len(ctrl) == 0 {
+		return ops
+	}
+
+	var out []Op
+	out = append(out, X(ctrl...)...)
+	out = append(out, Controlled(ops, ctrl)...)
+	out = append(out, X(ctrl...)...)
+	return out
+}
+
+// Pow returns the ops raised to the power of p.
+// A non-integer power is supported only for ops acting on a single target with the same controls.
+func Pow(ops []Op, p float64) ([]Op, error) {
+	if p == math.Trunc(p) {
+		base, n := ops, int(p)
+		if n < 0 {
+			base, n = Inverse(ops), -n
+		}
+
+		var out []Op
+		for range n {
+			out = append(out, base...)
+		}
+
+		return out, nil
+	}
+
+	var phase float64
+	var ctrl, target []int
+	u := matrix.Identity(2)
+	for _, op := range ops {
+		switch op.Name {
+		case U:
+			if target != nil && (!slices.Equal(target, op.Target) || !slices.Equal(ctrl, op.Control)) {
+				return nil, fmt.Errorf("pow(%v) of multi-qubit gate: %w", p, visitor.ErrNotImplemented)
+			}
+
+			ctrl, target = op.Control, op.Target
+			u = gate.U(op.Params[0], op.Params[1], op.Params[2]).MatMul(u)
+		case GPhase:
+			phase += op.Params[0]
+		default:
+			return nil, fmt.Errorf("pow(%v) of %s: %w", p, op.Name, visitor.ErrNotImplemented)
+		}
+	}
+
+	if len(ctrl) == 0 {
+		// the global phase is a part of the 2x2 unitary.
+		u, phase = u.Mul(cmplx.Exp(complex(0, phase))), 0
+	}
+
+	theta, phi, lambda, gamma := Euler(visitor.Pow2x2(u, p))
+
+	var out []Op
+	if !epsilon.IsZeroF64(phase) {
+		out = append(out, Op{
+			Name:   GPhase,
+			Params: []float64{Wrap(phase * p)},
+		})
+	}
+
+	var pow []Op
+	if !epsilon.IsZeroF64(gamma) {
+		pow = append(pow, Op{
+			Name:   GPhase,
+			Params: []float64{gamma},
+		})
+	}
+
+	if target != nil {
+		pow = append(pow, Op{
+			Name:   U,
+			Params: []float64{theta, phi, lambda},
+			Target: target,
+		})
+	}
+
+	return append(out, Controlled(pow, ctrl)...), nil
+}
+
+// Euler returns theta, phi, lambda and gamma such that u = exp(i*gamma) * U(theta, phi, lambda).
+func Euler(u *matrix.Matrix, tol ...float64) (theta, phi, lambda, gamma float64) {
+	a, b, c, d := u.At(0, 0), u.At(0, 1), u.At(1, 0), u.At(1, 1)
+	theta = 2 * math.Atan2(cmplx.Abs(c), cmplx.Abs(a))
+
+	switch {
+	case epsilon.IsZeroF64(cmplx.Abs(a), tol...):
+		// theta = pi. phi is not unique, so phi = 0.
+		gamma = cmplx.Phase(c)
+		lambda = cmplx.Phase(-b) - gamma
+	case epsilon.IsZeroF64(cmplx.Abs(c), tol...):
+		// theta = 0. phi is not unique, so phi = 0.
+		gamma = cmplx.Phase(a)
+		lambda = cmplx.Phase(d) - gamma
+	default:
+		gamma = cmplx.Phase(a)
+		phi = cmplx.Phase(c) - gamma
+		lambda = cmplx.Phase(-b) - gamma
+	}
+
+	return theta, Wrap(phi), Wrap(lambda), Wrap(gamma)
+}
+
+// Wrap returns the angle in (-pi, pi].
+func Wrap(radian float64) float64 {
+	w := math.Remainder(radian, 2*math.Pi)
+	if w <= -math.Pi {
+		w += 2 * math.Pi
+	}
+
+	return w
+}
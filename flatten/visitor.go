@@ -0,0 +1,1116 @@
+package flatten
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/antlr4-go/antlr/v4"
+	"github.com/itsubaki/q"
+	"github.com/itsubaki/qasm/environ"
+	"github.com/itsubaki/qasm/gen/parser"
+	xparser "github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/value"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+const End string = "end;"
+
+// MaxIterations is the maximum number of iterations of each loop.
+// The loops are unrolled, so the loop that does not terminate is an error.
+const MaxIterations = 1 << 16
+
+// Visitor evaluates the classical part of a program and records the quantum operations.
+// Classical expressions are evaluated by visitor.Visitor, so no state vector is allocated.
+type Visitor struct {
+	*parser.Baseqasm3ParserVisitor
+	env     *environ.Environ
+	eval    *visitor.Visitor
+	program *Program
+	bit     map[string][]int
+	dynamic map[string]bool
+	cond    string
+}
+
+func NewVisitor(env *environ.Environ) *Visitor {
+	return &Visitor{
+		Baseqasm3ParserVisitor: &parser.Baseqasm3ParserVisitor{},
+		env:                    env,
+		eval:                   visitor.New(q.New(), env, visitor.WithMaxIterations(MaxIterations)),
+		program:                &Program{},
+		bit:                    make(map[string][]int),
+		dynamic:                make(map[string]bool),
+	}
+}
+
+func (v *Visitor) Build(tree antlr.ParseTree) (*Program, error) {
+	if err, ok := v.Visit(tree).(error); ok && err != nil {
+		return nil, err
+	}
+
+	return v.program, nil
+}
+
+// Enclosed returns a visitor with a new enclosed environment that records into the same program.
+func (v *Visitor) Enclosed() *Visitor {
+	env := v.env.NewEnclosed()
+	return &Visitor{
+		Baseqasm3ParserVisitor: v.Baseqasm3ParserVisitor,
+		env:                    env,
+		eval:                   visitor.New(q.New(), env, visitor.WithMaxIterations(MaxIterations)),
+		program:                v.program,
+		bit:                    v.bit,
+		dynamic:                v.dynamic,
+		cond:                   v.cond,
+	}
+}
+
+// Emit appends the ops to the program under the current condition.
+func (v *Visitor) Emit(ops ...Op) {
+	for _, op := range ops {
+		op.Cond = v.cond
+		v.program.Ops = append(v.program.Ops, op)
+	}
+}
+
+// Dynamic returns true if the tree refers to a classical value that depends on a measurement.
+func (v *Visitor) Dynamic(tree antlr.Tree) bool {
+	if x, ok := tree.(*parser.LiteralExpressionContext); ok && x.Identifier() != nil {
+		return v.dynamic[x.Identifier().GetText()]
+	}
+
+	for _, c := range tree.GetChildren() {
+		if v.Dynamic(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *Visitor) Visit(tree antlr.ParseTree) any {
+	return tree.Accept(v)
+}
+
+func (v *Visitor) VisitTerminal(node antlr.TerminalNode) any {
+	return node.GetText()
+}
+
+func (v *Visitor) VisitProgram(ctx *parser.ProgramContext) any {
+	for _, s := range ctx.AllStatementOrScope() {
+		result := v.Visit(s)
+		if err, ok := result.(error); ok && err != nil {
+			return err
+		}
+
+		if contains(result, End) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (v *Visitor) VisitStatementOrScope(ctx *parser.StatementOrScopeContext) any {
+	if ctx.Statement() != nil {
+		return v.Visit(ctx.Statement())
+	}
+
+	return v.Visit(ctx.Scope())
+}
+
+func (v *Visitor) VisitStatement(ctx *parser.StatementContext) any {
+	statements := []antlr.ParseTree{
+		ctx.AliasDeclarationStatement(),
+		ctx.AssignmentStatement(),
+		ctx.BarrierStatement(),
+		ctx.BreakStatement(),
+		ctx.ClassicalDeclarationStatement(),
+		ctx.ConstDeclarationStatement(),
+		ctx.ContinueStatement(),
+		ctx.DefStatement(),
+		ctx.EndStatement(),
+		ctx.ExpressionStatement(),
+		ctx.ForStatement(),
+		ctx.GateCallStatement(),
+		ctx.GateStatement(),
+		ctx.IfStatement(),
+		ctx.IncludeStatement(),
+		ctx.MeasureArrowAssignmentStatement(),
+		ctx.OldStyleDeclarationStatement(),
+		ctx.QuantumDeclarationStatement(),
+		ctx.ResetStatement(),
+		ctx.ReturnStatement(),
+		ctx.SwitchStatement(),
+		ctx.WhileStatement(),
+	}
+
+	for _, s := range statements {
+		if s == nil {
+			continue
+		}
+
+		return v.Visit(s)
+	}
+
+	return fmt.Errorf("unsupported statement %q: %w", ctx.GetText(), visitor.ErrNotImplemented)
+}
+
+func (v *Visitor) VisitScope(ctx *parser.ScopeContext) any {
+	enclosed := v.Enclosed()
+
+	var list []any
+	for _, s := range ctx.AllStatementOrScope() {
+		result := enclosed.Visit(s)
+		if err, ok := result.(error); ok && err != nil {
+			return err
+		}
+
+		list = append(list, result)
+		if contains(result, visitor.Break, visitor.Continue, End) {
+			return list
+		}
+	}
+
+	return list
+}
+
+func (v *Visitor) VisitIncludeStatement(ctx *parser.IncludeStatementContext) any {
+	path := strings.Trim(v.Visit(ctx.StringLiteral()).(string), "\"")
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read file %s: %v", path, err)
+	}
+
+	program, err := xparser.Parse(string(text))
+	if err != nil {
+		return fmt.Errorf("include %s: %w", path, err)
+	}
+
+	if err, ok := v.Visit(program).(error); ok && err != nil {
+		return fmt.Errorf("include %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (v *Visitor) VisitBreakStatement(ctx *parser.BreakStatementContext) any {
+	if v.cond != "" {
+		return fmt.Errorf("break in measurement-dependent branch: %w", visitor.ErrNotImplemented)
+	}
+
+	return ctx.GetText()
+}
+
+func (v *Visitor) VisitContinueStatement(ctx *parser.ContinueStatementContext) any {
+	if v.cond != "" {
+		return fmt.Errorf("continue in measurement-dependent branch: %w", visitor.ErrNotImplemented)
+	}
+
+	return ctx.GetText()
+}
+
+func (v *Visitor) VisitEndStatement(ctx *parser.EndStatementContext) any {
+	if v.cond != "" {
+		return fmt.Errorf("end in measurement-dependent branch: %w", visitor.ErrNotImplemented)
+	}
+
+	return ctx.GetText()
+}
+
+func (v *Visitor) VisitIfStatement(ctx *parser.IfStatementContext) any {
+	if v.Dynamic(ctx.Expression()) {
+		// the condition depends on a measurement, so the ops are emitted with the condition.
+		cond, err := v.Condition(ctx.Expression())
+		if err != nil {
+			return err
+		}
+
+		enclosed := v.Enclosed()
+		enclosed.cond = and(v.cond, cond)
+		if err, ok := enclosed.Visit(ctx.GetIf_body()).(error); ok && err != nil {
+			return err
+		}
+
+		if ctx.GetElse_body() == nil {
+			return nil
+		}
+
+		enclosed.cond = and(v.cond, fmt.Sprintf("!(%s)", cond))
+		if err, ok := enclosed.Visit(ctx.GetElse_body()).(error); ok && err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	x := v.eval.Visit(ctx.Expression())
+	if err, ok := x.(error); ok && err != nil {
+		return err
+	}
+
+	cond, ok := x.(bool)
+	if !ok {
+		return fmt.Errorf("condition must be a bool %q", ctx.Expression().GetText())
+	}
+
+	enclosed := v.Enclosed()
+	if cond {
+		return enclosed.Visit(ctx.GetIf_body())
+	}
+
+	if ctx.GetElse_body() != nil {
+		return enclosed.Visit(ctx.GetElse_body())
+	}
+
+	return nil
+}
+
+func (v *Visitor) VisitForStatement(ctx *parser.ForStatementContext) any {
+	if ctx.RangeExpression() == nil {
+		return fmt.Errorf("for loop over %q: %w", ctx.Expression().GetText(), visitor.ErrNotImplemented)
+	}
+
+	if v.Dynamic(ctx.RangeExpression()) {
+		return fmt.Errorf("measurement-dependent range %q: %w", ctx.RangeExpression().GetText(), visitor.ErrNotImplemented)
+	}
+
+	id := v.Visit(ctx.Identifier()).(string)
+	result := v.eval.Visit(ctx.RangeExpression())
+	if err, ok := result.(error); ok && err != nil {
+		return err
+	}
+
+	// [start:stop] or [start:step:stop]
+	rx := result.([]int64)
+	start, step, stop := rx[0], int64(1), rx[len(rx)-1]
+	if len(rx) == 3 {
+		step = rx[1]
+	}
+
+	if step == 0 {
+		return fmt.Errorf("range step must not be zero %q", ctx.RangeExpression().GetText())
+	}
+
+	enclosed := v.Enclosed()
+	for i, n := start, 1; (step > 0 && i <= stop) || (step < 0 && i >= stop); i, n = i+step, n+1 {
+		if err := v.eval.Iterate(n); err != nil {
+			return err
+		}
+
+		enclosed.env.SetVariable(id, i)
+		result := enclosed.Visit(ctx.GetBody())
+		if err, ok := result.(error); ok && err != nil {
+			return err
+		}
+
+		if contains(result, End) {
+			return End
+		}
+
+		if contains(result, visitor.Break) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (v *Visitor) VisitWhileStatement(ctx *parser.WhileStatementContext) any {
+	if v.Dynamic(ctx.Expression()) {
+		return fmt.Errorf("measurement-dependent loop %q: %w", ctx.Expression().GetText(), visitor.ErrNotImplemented)
+	}
+
+	enclosed := v.Enclosed()
+	for n := 1; ; n++ {
+		x := v.eval.Visit(ctx.Expression())
+		if err, ok := x.(error); ok && err != nil {
+			return err
+		}
+
+		cond, ok := x.(bool)
+		if !ok {
+			return fmt.Errorf("condition must be a bool %q", ctx.Expression().GetText())
+		}
+
+		if !cond {
+			return nil
+		}
+
+		if err := v.eval.Iterate(n); err != nil {
+			return err
+		}
+
+		result := enclosed.Visit(ctx.GetBody())
+		if err, ok := result.(error); ok && err != nil {
+			return err
+		}
+
+		if contains(result, End) {
+			return End
+		}
+
+		if contains(result, visitor.Break) {
+			return nil
+		}
+	}
+}
+
+func (v *Visitor) VisitSwitchStatement(ctx *parser.SwitchStatementContext) any {
+	if v.Dynamic(ctx.Expression()) {
+		return fmt.Errorf("measurement-dependent switch %q: %w", ctx.Expression().GetText(), visitor.ErrNotImplemented)
+	}
+
+	x := v.eval.Visit(ctx.Expression())
+	if err, ok := x.(error); ok && err != nil {
+		return err
+	}
+
+	for _, item := range ctx.AllSwitchCaseItem() {
+		if item.DEFAULT() != nil {
+			return v.Visit(item.Scope())
+		}
+
+		for _, r := range v.eval.Visit(item.ExpressionList()).([]any) {
+			if r != x {
+				continue
+			}
+
+			return v.Visit(item.Scope())
+		}
+	}
+
+	return nil
+}
+
+func (v *Visitor) VisitReturnStatement(ctx *parser.ReturnStatementContext) any {
+	if v.cond != "" {
+		return fmt.Errorf("return in measurement-dependent branch: %w", visitor.ErrNotImplemented)
+	}
+
+	if ctx.MeasureExpression() != nil {
+		return fmt.Errorf("return measure: %w", visitor.ErrNotImplemented)
+	}
+
+	if ctx.Expression() == nil {
+		return nil
+	}
+
+	return v.eval.Visit(ctx.Expression())
+}
+
+func (v *Visitor) VisitGateStatement(ctx *parser.GateStatementContext) any {
+	return v.eval.VisitGateStatement(ctx)
+}
+
+func (v *Visitor) VisitDefStatement(ctx *parser.DefStatementContext) any {
+	return v.eval.VisitDefStatement(ctx)
+}
+
+func (v *Visitor) VisitConstDeclarationStatement(ctx *parser.ConstDeclarationStatementContext) any {
+	return v.eval.VisitConstDeclarationStatement(ctx)
+}
+
+func (v *Visitor) VisitAliasDeclarationStatement(ctx *parser.AliasDeclarationStatementContext) any {
+	return v.eval.VisitAliasDeclarationStatement(ctx)
+}
+
+func (v *Visitor) VisitQuantumDeclarationStatement(ctx *parser.QuantumDeclarationStatementContext) any {
+	id := v.Visit(ctx.Identifier()).(string)
+	size, ok := v.eval.Visit(ctx.QubitType()).(int64)
+	if !ok {
+		return fmt.Errorf("size must be an integer %q", ctx.QubitType().GetText())
+	}
+
+	return v.DeclareQubit(id, int(size), ctx.QubitType().Designator() == nil)
+}
+
+func (v *Visitor) VisitOldStyleDeclarationStatement(ctx *parser.OldStyleDeclarationStatementContext) any {
+	id := v.Visit(ctx.Identifier()).(string)
+
+	var size int64 = 1
+	if ctx.Designator() != nil {
+		s, ok := v.eval.Visit(ctx.Designator()).(int64)
+		if !ok {
+			return fmt.Errorf("size must be an integer %q", ctx.Designator().GetText())
+		}
+
+		size = s
+	}
+
+	if ctx.QREG() != nil {
+		return v.DeclareQubit(id, int(size), false)
+	}
+
+	return v.DeclareBit(id, int(size), false)
+}
+
+// DeclareQubit allocates the qubit indices of the register.
+func (v *Visitor) DeclareQubit(id string, size int, scalar bool) error {
+	if _, ok := v.env.GetQubit(id); ok {
+		return fmt.Errorf("%q redeclared", id)
+	}
+
+	start := v.program.NumQubits()
+	qubits := make([]q.Qubit, size)
+	for i := range size {
+		qubits[i] = q.Qubit(start + i)
+	}
+
+	v.env.SetQubit(id, qubits)
+	v.program.Qubits = append(v.program.Qubits, Register{
+		Name:   id,
+		Size:   size,
+		Scalar: scalar,
+	})
+
+	return nil
+}
+
+// PhysicalQubit returns the qubit index of the physical qubit such as $0.
+// The physical qubit is allocated as a scalar register on the first use.
+func (v *Visitor) PhysicalQubit(id string) ([]int, error) {
+	if qb, ok := v.env.GetQubit(id); ok {
+		return q.Index(qb...), nil
+	}
+
+	root := v.env
+	for root.Outer != nil {
+		root = root.Outer
+	}
+
+	index := v.program.NumQubits()
+	root.SetQubit(id, []q.Qubit{q.Qubit(index)})
+	v.program.Qubits = append(v.program.Qubits, Register{
+		Name:   id,
+		Size:   1,
+		Scalar: true,
+	})
+
+	return []int{index}, nil
+}
+
+// DeclareBit allocates the bit indices of the register.
+func (v *Visitor) DeclareBit(id string, size int, scalar bool) error {
+	if _, ok := v.bit[id]; ok {
+		return fmt.Errorf("%q redeclared", id)
+	}
+
+	start := v.program.NumBits()
+	bits := make([]int, size)
+	for i := range size {
+		bits[i] = start + i
+	}
+
+	v.bit[id] = bits
+	v.program.Bits = append(v.program.Bits, Register{
+		Name:   id,
+		Size:   size,
+		Scalar: scalar,
+	})
+
+	if scalar {
+		v.env.SetBit(id, false)
+		return nil
+	}
+
+	v.env.SetBitArray(id, make([]bool, size))
+	return nil
+}
+
+func (v *Visitor) VisitClassicalDeclarationStatement(ctx *parser.ClassicalDeclarationStatementContext) any {
+	if ctx.ScalarType() == nil || ctx.ScalarType().BIT() == nil {
+		if v.cond != "" {
+			return fmt.Errorf("declaration in measurement-dependent branch %q: %w", ctx.GetText(), visitor.ErrNotImplemented)
+		}
+
+		if ctx.DeclarationExpression() != nil && v.Dynamic(ctx.DeclarationExpression()) {
+			return fmt.Errorf("measurement-dependent declaration %q: %w", ctx.GetText(), visitor.ErrNotImplemented)
+		}
+
+		return v.eval.VisitClassicalDeclarationStatement(ctx)
+	}
+
+	id := v.Visit(ctx.Identifier()).(string)
+	size, ok := v.eval.Visit(ctx.ScalarType()).(int64)
+	if !ok {
+		return fmt.Errorf("size must be an integer %q", ctx.ScalarType().GetText())
+	}
+
+	if err := v.DeclareBit(id, int(size), ctx.ScalarType().Designator() == nil); err != nil {
+		return err
+	}
+
+	x := ctx.DeclarationExpression()
+	switch {
+	case x == nil:
+		return nil
+	case x.MeasureExpression() != nil:
+		return v.Measure(x.MeasureExpression(), id, v.bit[id])
+	case v.Dynamic(x):
+		return fmt.Errorf("measurement-dependent declaration %q: %w", ctx.GetText(), visitor.ErrNotImplemented)
+	}
+
+	var bits []bool
+	switch val := v.eval.Visit(x).(type) {
+	case error:
+		return val
+	case bool:
+		bits = []bool{val}
+	case []bool:
+		bits = val
+	default:
+		return fmt.Errorf("assign %v(%T) to %q", val, val, id)
+	}
+
+	if ctx.ScalarType().Designator() != nil {
+		v.env.SetBitArray(id, bits)
+		return nil
+	}
+
+	if len(bits) != 1 {
+		return fmt.Errorf("assign %d bits to a single bit", len(bits))
+	}
+
+	v.env.SetBit(id, bits[0])
+	return nil
+}
+
+func (v *Visitor) VisitAssignmentStatement(ctx *parser.AssignmentStatementContext) any {
+	if ctx.MeasureExpression() != nil {
+		id, bits, err := v.Bits(ctx.IndexedIdentifier())
+		if err != nil {
+			return err
+		}
+
+		return v.Measure(ctx.MeasureExpression(), id, bits)
+	}
+
+	if v.cond != "" {
+		return fmt.Errorf("assignment in measurement-dependent branch %q: %w", ctx.GetText(), visitor.ErrNotImplemented)
+	}
+
+	if v.Dynamic(ctx.Expression()) {
+		return fmt.Errorf("measurement-dependent assignment %q: %w", ctx.GetText(), visitor.ErrNotImplemented)
+	}
+
+	return v.eval.VisitAssignmentStatement(ctx)
+}
+
+func (v *Visitor) VisitMeasureArrowAssignmentStatement(ctx *parser.MeasureArrowAssignmentStatementContext) any {
+	if ctx.IndexedIdentifier() == nil {
+		return v.Measure(ctx.MeasureExpression(), "", nil)
+	}
+
+	id, bits, err := v.Bits(ctx.IndexedIdentifier())
+	if err != nil {
+		return err
+	}
+
+	return v.Measure(ctx.MeasureExpression(), id, bits)
+}
+
+// Bits returns the name and the bit indices of the identifier.
+func (v *Visitor) Bits(ctx parser.IIndexedIdentifierContext) (string, []int, error) {
+	id := v.Visit(ctx.Identifier()).(string)
+	bits, ok := v.bit[id]
+	if !ok {
+		return "", nil, fmt.Errorf("undefined %q", id)
+	}
+
+	result := v.eval.Visit(ctx)
+	if err, ok := result.(error); ok && err != nil {
+		return "", nil, err
+	}
+
+	index := result.([]int64)
+	if len(index) == 0 {
+		return id, bits, nil
+	}
+
+	var list []int
+	for _, i := range index {
+		if i < 0 || int(i) >= len(bits) {
+			return "", nil, fmt.Errorf("index out of range %q[%d]", id, i)
+		}
+
+		list = append(list, bits[i])
+	}
+
+	return id, list, nil
+}
+
+// Measure emits the measurement of the operand into the bits.
+func (v *Visitor) Measure(ctx parser.IMeasureExpressionContext, id string, bits []int) error {
+	qubits, err := v.Operand(ctx.GateOperand())
+	if err != nil {
+		return err
+	}
+
+	if len(bits) > 0 && len(bits) != len(qubits) {
+		return fmt.Errorf("assign %d measured qubits to %d bits", len(qubits), len(bits))
+	}
+
+	for i, qb := range qubits {
+		op := Op{
+			Name:   Measure,
+			Target: []int{qb},
+		}
+
+		if len(bits) > 0 {
+			op.Bit = []int{bits[i]}
+		}
+
+		v.Emit(op)
+	}
+
+	if id != "" {
+		v.dynamic[id] = true
+	}
+
+	return nil
+}
+
+func (v *Visitor) VisitResetStatement(ctx *parser.ResetStatementContext) any {
+	qubits, err := v.Operand(ctx.GateOperand())
+	if err != nil {
+		return err
+	}
+
+	for _, qb := range qubits {
+		v.Emit(Op{
+			Name:   Reset,
+			Target: []int{qb},
+		})
+	}
+
+	return nil
+}
+
+func (v *Visitor) VisitBarrierStatement(ctx *parser.BarrierStatementContext) any {
+	var qubits []int
+	if ctx.GateOperandList() == nil {
+		for i := range v.program.NumQubits() {
+			qubits = append(qubits, i)
+		}
+	}
+
+	if ctx.GateOperandList() != nil {
+		operands, err := v.Operands(ctx.GateOperandList())
+		if err != nil {
+			return err
+		}
+
+		for _, o := range operands {
+			qubits = append(qubits, o...)
+		}
+	}
+
+	v.Emit(Op{
+		Name:   Barrier,
+		Target: qubits,
+	})
+
+	return nil
+}
+
+// Operand returns the qubit indices of the operand.
+func (v *Visitor) Operand(ctx parser.IGateOperandContext) ([]int, error) {
+	if ctx.HardwareQubit() != nil {
+		return v.PhysicalQubit(ctx.HardwareQubit().GetText())
+	}
+
+	result := v.eval.Visit(ctx)
+	if err, ok := result.(error); ok && err != nil {
+		return nil, err
+	}
+
+	return q.Index(result.([]q.Qubit)...), nil
+}
+
+// Operands returns the qubit indices of each operand.
+func (v *Visitor) Operands(ctx parser.IGateOperandListContext) ([][]int, error) {
+	var list [][]int
+	for _, o := range ctx.AllGateOperand() {
+		qubits, err := v.Operand(o)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, qubits)
+	}
+
+	return list, nil
+}
+
+func (v *Visitor) VisitGateCallStatement(ctx *parser.GateCallStatementContext) any {
+	ops, err := v.Expand(ctx)
+	if err != nil {
+		return err
+	}
+
+	v.Emit(ops...)
+	return nil
+}
+
+// Expand returns the ops of the gate call, inlining user-defined gates and applying the modifiers.
+func (v *Visitor) Expand(ctx *parser.GateCallStatementContext) ([]Op, error) {
+	// NOTE: The "pow@ ctrl@" and "pow@ negctrl@" modifier orders are not supported.
+	if err := visitor.NotImplementedOrder(ctx); err != nil {
+		return nil, err
+	}
+
+	var operands [][]int
+	if ctx.GateOperandList() != nil {
+		list, err := v.Operands(ctx.GateOperandList())
+		if err != nil {
+			return nil, err
+		}
+
+		operands = list
+	}
+
+	// control qubits of each modifier
+	mods := ctx.AllGateModifier()
+	ctrl := make([][]int, len(mods))
+
+	var cursor int
+	for i, mod := range mods {
+		if mod.CTRL() == nil && mod.NEGCTRL() == nil {
+			continue
+		}
+
+		n, ok := v.eval.Visit(mod).(int64)
+		if !ok {
+			return nil, fmt.Errorf("apply %q", mod.GetText())
+		}
+
+		for range n {
+			if cursor >= len(operands) {
+				return nil, fmt.Errorf("apply %q: too few operands", mod.GetText())
+			}
+
+			ctrl[i] = append(ctrl[i], operands[cursor]...)
+			cursor++
+		}
+	}
+
+	ops, err := v.Gate(ctx, operands[cursor:])
+	if err != nil {
+		return nil, err
+	}
+
+	// modifiers are applied from the innermost one.
+	for i := len(mods) - 1; i >= 0; i-- {
+		switch {
+		case mods[i].INV() != nil:
+			ops = Inverse(ops)
+		case mods[i].POW() != nil:
+			p, err := value.New(v.eval.Visit(mods[i])).Float64()
+			if err != nil {
+				return nil, fmt.Errorf("apply %q: %w", mods[i].GetText(), err)
+			}
+
+			ops, err = Pow(ops, p.Value().(float64))
+			if err != nil {
+				return nil, fmt.Errorf("apply %q: %w", mods[i].GetText(), err)
+			}
+		case mods[i].CTRL() != nil:
+			ops = Controlled(ops, ctrl[i])
+		case mods[i].NEGCTRL() != nil:
+			ops = NegControlled(ops, ctrl[i])
+		}
+	}
+
+	return ops, nil
+}
+
+// Gate returns the ops of the gate call without modifiers.
+func (v *Visitor) Gate(ctx *parser.GateCallStatementContext, operands [][]int) ([]Op, error) {
+	var params []float64
+	if ctx.ExpressionList() != nil {
+		if v.Dynamic(ctx.ExpressionList()) {
+			return nil, fmt.Errorf("measurement-dependent parameter %q: %w", ctx.ExpressionList().GetText(), visitor.ErrNotImplemented)
+		}
+
+		p, err := v.eval.Params(ctx.ExpressionList())
+		if err != nil {
+			return nil, err
+		}
+
+		params = p
+	}
+
+	if ctx.GPHASE() != nil {
+		if len(params) != 1 {
+			return nil, fmt.Errorf("gphase: need 1 param, got %d", len(params))
+		}
+
+		return []Op{{
+			Name:   GPhase,
+			Params: params,
+		}}, nil
+	}
+
+	id := v.Visit(ctx.Identifier()).(string)
+	if id == visitor.U {
+		if len(params) != 3 {
+			return nil, fmt.Errorf("U: need 3 params, got %d", len(params))
+		}
+
+		var ops []Op
+		for _, o := range operands {
+			for _, qb := range o {
+				ops = append(ops, Op{
+					Name:   U,
+					Params: params,
+					Target: []int{qb},
+				})
+			}
+		}
+
+		return ops, nil
+	}
+
+	g, ok := v.env.GetGate(id)
+	if !ok {
+		return nil, fmt.Errorf("undefined %q", id)
+	}
+
+	if len(params) != len(g.Params) {
+		return nil, fmt.Errorf("%s: need %d params, got %d", id, len(g.Params), len(params))
+	}
+
+	if len(operands) != len(g.QArgs) {
+		return nil, fmt.Errorf("%s: need %d operands, got %d", id, len(g.QArgs), len(operands))
+	}
+
+	enclosed := v.Enclosed()
+	for i, p := range g.Params {
+		enclosed.env.SetVariable(p, params[i])
+	}
+
+	for i, a := range g.QArgs {
+		enclosed.env.Qubit[a] = qubits(operands[i])
+	}
+
+	var ops []Op
+	for i, s := range g.Body.AllStatementOrScope() {
+		if s.Statement() == nil || s.Statement().GateCallStatement() == nil {
+			return nil, fmt.Errorf("%s: unsupported statement %q in gate body", id, s.GetText())
+		}
+
+		call := s.Statement().GateCallStatement().(*parser.GateCallStatementContext)
+		list, err := enclosed.Expand(call)
+		if err != nil {
+			return nil, fmt.Errorf("gate call[%d]: %w", i, err)
+		}
+
+		ops = append(ops, list...)
+	}
+
+	// the calls of the body have their own ids.
+	base := v.program.calls + 1
+	for i := range ops {
+		if ops[i].Gate == "" {
+			ops[i].Gate, ops[i].Call = id, base+element(operands, ops[i].Target)
+		}
+	}
+
+	width := 1
+	for _, o := range operands {
+		width = max(width, len(o))
+	}
+
+	v.program.calls += width
+	return ops, nil
+}
+
+// element returns the index of the target qubits in the operand registers.
+// It is the element of the broadcast of the gate call over the registers.
+func element(operands [][]int, target []int) int {
+	for _, o := range operands {
+		if len(o) < 2 {
+			continue
+		}
+
+		for _, qb := range target {
+			if j := slices.Index(o, qb); j >= 0 {
+				return j
+			}
+		}
+	}
+
+	return 0
+}
+
+func (v *Visitor) VisitExpressionStatement(ctx *parser.ExpressionStatementContext) any {
+	if call, ok := ctx.Expression().(*parser.CallExpressionContext); ok {
+		id := v.Visit(call.Identifier()).(string)
+		if routine, ok := v.env.GetSubroutine(id); ok {
+			return v.Call(call, routine)
+		}
+	}
+
+	if v.Dynamic(ctx.Expression()) {
+		return fmt.Errorf("measurement-dependent expression %q: %w", ctx.GetText(), visitor.ErrNotImplemented)
+	}
+
+	return v.eval.Visit(ctx.Expression())
+}
+
+// Call inlines the subroutine call.
+func (v *Visitor) Call(ctx *parser.CallExpressionContext, routine *environ.Subroutine) error {
+	var args []any
+	if ctx.ExpressionList() != nil {
+		args = v.eval.Visit(ctx.ExpressionList()).([]any)
+	}
+
+	if len(args) != len(routine.QArgs) {
+		return fmt.Errorf("%s: need %d args, got %d", routine.Name, len(routine.QArgs), len(args))
+	}
+
+	enclosed := v.Enclosed()
+	for i, p := range routine.QArgs {
+		switch arg := args[i].(type) {
+		case error:
+			return arg
+		case []q.Qubit:
+			enclosed.env.Qubit[p] = arg
+		default:
+			enclosed.env.SetVariable(p, arg)
+		}
+	}
+
+	if err, ok := enclosed.Visit(routine.Body).(error); ok && err != nil {
+		return fmt.Errorf("%s: %w", routine.Name, err)
+	}
+
+	return nil
+}
+
+func qubits(list []int) []q.Qubit {
+	qb := make([]q.Qubit, len(list))
+	for i := range list {
+		qb[i] = q.Qubit(list[i])
+	}
+
+	return qb
+}
+
+// Condition returns the measurement-dependent condition as OpenQASM 3.
+// The indices of the bits and the other values are resolved,
+// so it does not refer to the loop variables and the parameters that are not in the flattened program.
+func (v *Visitor) Condition(x parser.IExpressionContext) (string, error) {
+	if !v.Dynamic(x) {
+		return v.Literal(x)
+	}
+
+	switch x := x.(type) {
+	case *parser.LiteralExpressionContext:
+		// c
+		return x.GetText(), nil
+	case *parser.IndexExpressionContext:
+		// c[i]
+		lit, ok := x.Expression().(*parser.LiteralExpressionContext)
+		if !ok || lit.Identifier() == nil || len(x.IndexOperator().AllExpression()) != 1 {
+			return "", fmt.Errorf("measurement-dependent condition %q: %w", x.GetText(), visitor.ErrNotImplemented)
+		}
+
+		id := lit.GetText()
+		bits, ok := v.bit[id]
+		if !ok {
+			return "", fmt.Errorf("undefined %q", id)
+		}
+
+		index, ok := v.eval.Visit(x.IndexOperator().Expression(0)).(int64)
+		if !ok {
+			return "", fmt.Errorf("index must be an integer %q", x.IndexOperator().GetText())
+		}
+
+		if index < 0 || int(index) >= len(bits) {
+			return "", fmt.Errorf("index out of range %q[%d]", id, index)
+		}
+
+		return v.program.BitName(bits[index]), nil
+	case *parser.ParenthesisExpressionContext:
+		cond, err := v.Condition(x.Expression())
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("(%s)", cond), nil
+	case *parser.UnaryExpressionContext:
+		cond, err := v.Condition(x.Expression())
+		if err != nil {
+			return "", err
+		}
+
+		return x.GetOp().GetText() + cond, nil
+	case interface {
+		AllExpression() []parser.IExpressionContext
+		GetOp() antlr.Token
+	}:
+		// c[0] == 1, c[0] && c[1], ...
+		list := x.AllExpression()
+		lhs, err := v.Condition(list[0])
+		if err != nil {
+			return "", err
+		}
+
+		rhs, err := v.Condition(list[1])
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s %s %s", lhs, x.GetOp().GetText(), rhs), nil
+	default:
+		return "", fmt.Errorf("measurement-dependent condition %q: %w", x.GetText(), visitor.ErrNotImplemented)
+	}
+}
+
+// Literal returns the value of the expression as a literal of OpenQASM 3.
+func (v *Visitor) Literal(x parser.IExpressionContext) (string, error) {
+	switch val := v.eval.Visit(x).(type) {
+	case error:
+		return "", val
+	case bool:
+		return strconv.FormatBool(val), nil
+	case int64:
+		return strconv.FormatInt(val, 10), nil
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64), nil
+	default:
+		return "", fmt.Errorf("literal of %v(%T) in condition %q: %w", val, val, x.GetText(), visitor.ErrNotImplemented)
+	}
+}
+
+func and(a, b string) string {
+	if a == "" {
+		return b
+	}
+
+	return fmt.Sprintf("(%s) && (%s)", a, b)
+}
+
+// contains returns true if the result contains substrings.
+func contains(result any, substrings ...string) bool {
+	switch v := result.(type) {
+	case string:
+		for _, s := range substrings {
+			if strings.Contains(v, s) {
+				return true
+			}
+		}
+	case []any:
+		for _, r := range v {
+			if contains(r, substrings...) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,674 @@
+package lsp
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/antlr4-go/antlr/v4"
+	"github.com/itsubaki/qasm/environ"
+	"github.com/itsubaki/qasm/gen/parser"
+	"github.com/itsubaki/qasm/listener"
+	xparser "github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+// Kinds of the symbols.
+const (
+	Gate     = "gate"
+	Def      = "def"
+	Qubit    = "qubit"
+	Bit      = "bit"
+	Variable = "variable"
+	Const    = "const"
+	Param    = "param"
+)
+
+// Builtins are the functions of the call expressions.
+var Builtins = []string{"sin", "cos", "tan", "arcsin", "arccos", "arctan", "ceiling", "floor", "sqrt", "exp", "log", "mod"}
+
+// Symbol is an identifier declared in the document or the included files.
+// Range is the identifier and Full is the whole declaration.
+type Symbol struct {
+	Name     string
+	Kind     string
+	Detail   string
+	URI      string
+	Range    Range
+	Full     Range
+	Gate     *environ.Gate
+	Children []*Symbol
+	scope    *scope
+}
+
+// Reference is an identifier used in the document.
+// Symbol is nil if the identifier is a builtin or undefined.
+type Reference struct {
+	Name   string
+	Range  Range
+	Symbol *Symbol
+	kind   string
+	scope  *scope
+	call   *call
+}
+
+// call is the number of the params, the operands and the controls of the gate call.
+// controls is -1 if the number is not a literal.
+type call struct {
+	params   int
+	operands int
+	controls int
+}
+
+// scope is the identifiers declared in the range.
+// The range of the global scope is nil.
+type scope struct {
+	outer   *scope
+	symbols map[string]*Symbol
+	rng     *Range
+}
+
+func (s *scope) lookup(name string) (*Symbol, bool) {
+	if sym, ok := s.symbols[name]; ok {
+		return sym, true
+	}
+
+	if s.outer != nil {
+		return s.outer.lookup(name)
+	}
+
+	return nil, false
+}
+
+// Document is the result of the analysis of the text.
+type Document struct {
+	URI         string
+	Text        string
+	Diagnostics []Diagnostic
+	Symbols     []*Symbol
+	Declared    []*Symbol
+	References  []*Reference
+	Globals     map[string]*Symbol
+	lines       []string
+}
+
+// Analyze parses the text and collects the diagnostics, the symbols and the references.
+// The gates and the subroutines of the included files are resolved relative to the document, then the working directory.
+// The references are not checked if the text has a syntax error.
+func Analyze(uri, text string) *Document {
+	d := &Document{
+		URI:         uri,
+		Text:        text,
+		Diagnostics: []Diagnostic{},
+		Globals:     make(map[string]*Symbol),
+		lines:       strings.Split(text, "\n"),
+	}
+
+	tree, errs := parse(text)
+	for _, e := range errs {
+		start := d.position(e.Line, e.Column)
+		d.Diagnostics = append(d.Diagnostics, Diagnostic{
+			Range:    Range{Start: start, End: Position{Line: start.Line, Character: start.Character + 1}},
+			Severity: SeverityError,
+			Source:   "qasm",
+			Message:  e.Message,
+		})
+	}
+
+	global := &scope{symbols: d.Globals}
+	c := &collector{
+		Baseqasm3ParserListener: &parser.Baseqasm3ParserListener{},
+		doc:                     d,
+		uri:                     uri,
+		lines:                   d.lines,
+		scope:                   global,
+		visited:                 map[string]bool{path(uri): true},
+		complete:                true,
+	}
+
+	antlr.ParseTreeWalkerDefault.Walk(c, tree)
+	if len(errs) == 0 {
+		d.resolve(c.complete)
+	}
+
+	return d
+}
+
+// parse returns the tree and all the syntax errors of the lexer and the parser.
+func parse(text string) (parser.IProgramContext, []*listener.SyntaxError) {
+	l := &listener.ErrorListener{}
+	lexer := parser.Newqasm3Lexer(antlr.NewInputStream(text))
+	lexer.RemoveErrorListeners()
+	lexer.AddErrorListener(l)
+
+	p := parser.Newqasm3Parser(antlr.NewCommonTokenStream(lexer, antlr.TokenDefaultChannel))
+	p.RemoveErrorListeners()
+	p.AddErrorListener(l)
+
+	tree := p.Program()
+	return tree, l.Errors
+}
+
+// resolve resolves the references and checks the undefined identifiers and the gate calls.
+// The undefined identifiers are not reported if any included file is not found.
+func (d *Document) resolve(complete bool) {
+	for _, r := range d.References {
+		if sym, ok := r.scope.lookup(r.Name); ok {
+			r.Symbol = sym
+		}
+
+		if r.Symbol == nil {
+			if builtin(r.Name, r.kind) || !complete {
+				continue
+			}
+
+			d.errorf(r.Range, "undefined %q", r.Name)
+			continue
+		}
+
+		if r.call == nil {
+			continue
+		}
+
+		if r.Symbol.Gate == nil {
+			d.errorf(r.Range, "%q is not a gate", r.Name)
+			continue
+		}
+
+		g := r.Symbol.Gate
+		if r.call.params != len(g.Params) {
+			d.errorf(r.Range, "%q takes %d params, got %d", r.Name, len(g.Params), r.call.params)
+		}
+
+		if r.call.controls >= 0 && r.call.operands != len(g.QArgs)+r.call.controls {
+			d.errorf(r.Range, "%q takes %d qubits, got %d", r.Name, len(g.QArgs)+r.call.controls, r.call.operands)
+		}
+	}
+}
+
+func builtin(name, kind string) bool {
+	switch kind {
+	case Gate:
+		return name == visitor.U
+	case Def:
+		return slices.Contains(Builtins, name)
+	default:
+		_, ok := visitor.Const[name]
+		return ok
+	}
+}
+
+func (d *Document) errorf(r Range, format string, a ...any) {
+	d.Diagnostics = append(d.Diagnostics, Diagnostic{
+		Range:    r,
+		Severity: SeverityError,
+		Source:   "qasm",
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+func (d *Document) warnf(r Range, format string, a ...any) {
+	d.Diagnostics = append(d.Diagnostics, Diagnostic{
+		Range:    r,
+		Severity: SeverityWarning,
+		Source:   "qasm",
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+func (d *Document) position(line, column int) Position {
+	return position(d.lines, line, column)
+}
+
+// Reference returns the reference at the position.
+func (d *Document) Reference(p Position) (*Reference, bool) {
+	for _, r := range d.References {
+		if r.Range.Contains(p) {
+			return r, true
+		}
+	}
+
+	return nil, false
+}
+
+// Declaration returns the symbol declared at the position.
+func (d *Document) Declaration(p Position) (*Symbol, bool) {
+	for _, s := range d.Declared {
+		if s.Range.Contains(p) {
+			return s, true
+		}
+	}
+
+	return nil, false
+}
+
+// Word returns the identifier at the position and its range.
+func (d *Document) Word(p Position) (string, Range, bool) {
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return "", Range{}, false
+	}
+
+	line := utf16.Encode([]rune(d.lines[p.Line]))
+	ident := func(c uint16) bool {
+		return c == '_' || c > 0x7f || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+	}
+
+	start, end := min(p.Character, len(line)), min(p.Character, len(line))
+	for start > 0 && ident(line[start-1]) {
+		start--
+	}
+
+	for end < len(line) && ident(line[end]) {
+		end++
+	}
+
+	if start == end {
+		return "", Range{}, false
+	}
+
+	return string(utf16.Decode(line[start:end])), Range{
+		Start: Position{Line: p.Line, Character: start},
+		End:   Position{Line: p.Line, Character: end},
+	}, true
+}
+
+// End returns the position of the end of the text.
+func (d *Document) End() Position {
+	last := len(d.lines) - 1
+	return Position{Line: last, Character: len(utf16.Encode([]rune(d.lines[last])))}
+}
+
+// position returns the position of the line starting at 1 and the column in runes starting at 0.
+func position(lines []string, line, column int) Position {
+	if line < 1 || line > len(lines) {
+		return Position{Line: max(line-1, 0), Character: column}
+	}
+
+	runes := []rune(lines[line-1])
+	return Position{
+		Line:      line - 1,
+		Character: len(utf16.Encode(runes[:min(max(column, 0), len(runes))])),
+	}
+}
+
+// path returns the file path of the URI.
+func path(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+
+	return u.Path
+}
+
+// URI returns the file URI of the path.
+func URI(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+}
+
+type collector struct {
+	*parser.Baseqasm3ParserListener
+	doc      *Document
+	uri      string
+	lines    []string
+	scope    *scope
+	parent   *Symbol
+	visited  map[string]bool
+	complete bool
+}
+
+// included returns true if the collector walks an included file.
+func (c *collector) included() bool {
+	return c.uri != c.doc.URI
+}
+
+func (c *collector) push(ctx antlr.ParserRuleContext) {
+	rng := c.ctxRange(ctx)
+	c.scope = &scope{outer: c.scope, symbols: make(map[string]*Symbol), rng: &rng}
+}
+
+func (c *collector) pop() {
+	c.scope = c.scope.outer
+}
+
+func (c *collector) tokenRange(t antlr.Token) Range {
+	return Range{
+		Start: position(c.lines, t.GetLine(), t.GetColumn()),
+		End:   position(c.lines, t.GetLine(), t.GetColumn()+len([]rune(t.GetText()))),
+	}
+}
+
+func (c *collector) ctxRange(ctx antlr.ParserRuleContext) Range {
+	start, stop := ctx.GetStart(), ctx.GetStop()
+	if stop == nil || stop.GetTokenIndex() < start.GetTokenIndex() {
+		stop = start
+	}
+
+	return Range{
+		Start: c.tokenRange(start).Start,
+		End:   c.tokenRange(stop).End,
+	}
+}
+
+// declare declares the identifier in the current scope.
+// The detail is the source from the start of the declaration to the end token.
+func (c *collector) declare(ctx antlr.ParserRuleContext, id antlr.TerminalNode, kind string, end antlr.Token) *Symbol {
+	if id == nil {
+		return nil
+	}
+
+	sym := &Symbol{
+		Name:   id.GetText(),
+		Kind:   kind,
+		Detail: xparser.Source(ctx.GetStart(), end),
+		URI:    c.uri,
+		Range:  c.tokenRange(id.GetSymbol()),
+		Full:   c.ctxRange(ctx),
+		scope:  c.scope,
+	}
+
+	if _, ok := c.scope.symbols[sym.Name]; ok && !c.included() {
+		c.doc.errorf(sym.Range, "%q redeclared", sym.Name)
+	}
+
+	c.scope.symbols[sym.Name] = sym
+	if c.included() {
+		return sym
+	}
+
+	c.doc.Declared = append(c.doc.Declared, sym)
+	switch {
+	case c.parent != nil:
+		c.parent.Children = append(c.parent.Children, sym)
+	case c.scope.outer == nil:
+		c.doc.Symbols = append(c.doc.Symbols, sym)
+	}
+
+	return sym
+}
+
+// local declares the param or the argument with the detail.
+func (c *collector) local(id antlr.TerminalNode, detail string, full antlr.ParserRuleContext) {
+	if id == nil {
+		return
+	}
+
+	sym := c.declare(full, id, Param, id.GetSymbol())
+	if sym != nil {
+		sym.Detail = detail
+	}
+}
+
+func (c *collector) refer(id antlr.TerminalNode, kind string) *Reference {
+	if id == nil || c.included() {
+		return nil
+	}
+
+	r := &Reference{
+		Name:  id.GetText(),
+		Range: c.tokenRange(id.GetSymbol()),
+		kind:  kind,
+		scope: c.scope,
+	}
+
+	c.doc.References = append(c.doc.References, r)
+	return r
+}
+
+func (c *collector) EnterIncludeStatement(ctx *parser.IncludeStatementContext) {
+	if ctx.StringLiteral() == nil {
+		return
+	}
+
+	name := strings.Trim(ctx.StringLiteral().GetText(), "\"")
+	candidates := []string{filepath.Join(filepath.Dir(path(c.uri)), name), name}
+	if filepath.IsAbs(name) {
+		candidates = []string{name}
+	}
+
+	for _, file := range candidates {
+		text, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		abs, _ := filepath.Abs(file)
+		if c.visited[abs] {
+			return
+		}
+		c.visited[abs] = true
+
+		tree, errs := parse(string(text))
+		if len(errs) > 0 && !c.included() {
+			c.doc.warnf(c.ctxRange(ctx), "include %s: %v", name, errs[0])
+		}
+
+		sub := &collector{
+			Baseqasm3ParserListener: c.Baseqasm3ParserListener,
+			doc:                     c.doc,
+			uri:                     URI(abs),
+			lines:                   strings.Split(string(text), "\n"),
+			scope:                   c.scope,
+			visited:                 c.visited,
+			complete:                true,
+		}
+
+		antlr.ParseTreeWalkerDefault.Walk(sub, tree)
+		c.complete = c.complete && sub.complete
+		return
+	}
+
+	c.complete = false
+	if !c.included() {
+		c.doc.warnf(c.ctxRange(ctx), "include %s: file not found", name)
+	}
+}
+
+func (c *collector) EnterGateStatement(ctx *parser.GateStatementContext) {
+	g := &environ.Gate{Body: ctx.Scope()}
+	if ctx.Identifier() != nil {
+		g.Name = ctx.Identifier().GetText()
+	}
+
+	if ctx.GetParams() != nil {
+		for _, id := range ctx.GetParams().AllIdentifier() {
+			g.Params = append(g.Params, id.GetText())
+		}
+	}
+
+	if ctx.GetQubits() != nil {
+		for _, id := range ctx.GetQubits().AllIdentifier() {
+			g.QArgs = append(g.QArgs, id.GetText())
+		}
+	}
+
+	sym := c.declare(ctx, ctx.Identifier(), Gate, ctx.GetStart())
+	if sym != nil {
+		sym.Gate, sym.Detail = g, g.String()
+	}
+
+	c.push(ctx)
+	parent := c.parent
+	c.parent = sym
+	if ctx.GetParams() != nil {
+		for _, id := range ctx.GetParams().AllIdentifier() {
+			c.local(id, "angle "+id.GetText(), ctx)
+		}
+	}
+
+	if ctx.GetQubits() != nil {
+		for _, id := range ctx.GetQubits().AllIdentifier() {
+			c.local(id, "qubit "+id.GetText(), ctx)
+		}
+	}
+
+	c.parent = parent
+}
+
+func (c *collector) ExitGateStatement(ctx *parser.GateStatementContext) {
+	c.pop()
+}
+
+func (c *collector) EnterDefStatement(ctx *parser.DefStatementContext) {
+	end := ctx.GetStart()
+	switch {
+	case ctx.ReturnSignature() != nil:
+		end = ctx.ReturnSignature().GetStop()
+	case ctx.RPAREN() != nil:
+		end = ctx.RPAREN().GetSymbol()
+	}
+
+	sym := c.declare(ctx, ctx.Identifier(), Def, end)
+
+	c.push(ctx)
+	parent := c.parent
+	c.parent = sym
+	if ctx.ArgumentDefinitionList() != nil {
+		for _, a := range ctx.ArgumentDefinitionList().AllArgumentDefinition() {
+			c.local(a.Identifier(), xparser.Text(a), a)
+		}
+	}
+
+	c.parent = parent
+}
+
+func (c *collector) ExitDefStatement(ctx *parser.DefStatementContext) {
+	c.pop()
+}
+
+func (c *collector) EnterForStatement(ctx *parser.ForStatementContext) {
+	c.push(ctx)
+	if ctx.ScalarType() != nil && ctx.Identifier() != nil {
+		c.declare(ctx, ctx.Identifier(), Variable, ctx.Identifier().GetSymbol())
+	}
+}
+
+func (c *collector) ExitForStatement(ctx *parser.ForStatementContext) {
+	c.pop()
+}
+
+func (c *collector) EnterScope(ctx *parser.ScopeContext) {
+	c.push(ctx)
+}
+
+func (c *collector) ExitScope(ctx *parser.ScopeContext) {
+	c.pop()
+}
+
+func (c *collector) EnterQuantumDeclarationStatement(ctx *parser.QuantumDeclarationStatementContext) {
+	c.declare(ctx, ctx.Identifier(), Qubit, symbol(ctx.Identifier()))
+}
+
+func (c *collector) EnterOldStyleDeclarationStatement(ctx *parser.OldStyleDeclarationStatementContext) {
+	kind := Qubit
+	if ctx.CREG() != nil {
+		kind = Bit
+	}
+
+	end := symbol(ctx.Identifier())
+	if ctx.Designator() != nil {
+		end = ctx.Designator().GetStop()
+	}
+
+	c.declare(ctx, ctx.Identifier(), kind, end)
+}
+
+func (c *collector) EnterClassicalDeclarationStatement(ctx *parser.ClassicalDeclarationStatementContext) {
+	kind := Variable
+	if ctx.ScalarType() != nil && ctx.ScalarType().BIT() != nil {
+		kind = Bit
+	}
+
+	c.declare(ctx, ctx.Identifier(), kind, symbol(ctx.Identifier()))
+}
+
+func (c *collector) EnterConstDeclarationStatement(ctx *parser.ConstDeclarationStatementContext) {
+	c.declare(ctx, ctx.Identifier(), Const, symbol(ctx.Identifier()))
+}
+
+func (c *collector) EnterIoDeclarationStatement(ctx *parser.IoDeclarationStatementContext) {
+	c.declare(ctx, ctx.Identifier(), Variable, symbol(ctx.Identifier()))
+}
+
+func (c *collector) EnterAliasDeclarationStatement(ctx *parser.AliasDeclarationStatementContext) {
+	c.declare(ctx, ctx.Identifier(), Qubit, symbol(ctx.Identifier()))
+}
+
+func (c *collector) EnterExternStatement(ctx *parser.ExternStatementContext) {
+	sym := c.declare(ctx, ctx.Identifier(), Def, ctx.GetStop())
+	if sym != nil {
+		sym.Detail = strings.TrimSuffix(sym.Detail, ";")
+	}
+}
+
+func (c *collector) EnterGateCallStatement(ctx *parser.GateCallStatementContext) {
+	if ctx.Identifier() == nil {
+		// gphase
+		return
+	}
+
+	r := c.refer(ctx.Identifier(), Gate)
+	if r == nil || r.Name == visitor.U {
+		// U is applied to each operand.
+		return
+	}
+
+	r.call = &call{}
+	if ctx.ExpressionList() != nil {
+		r.call.params = len(ctx.ExpressionList().AllExpression())
+	}
+
+	if ctx.GateOperandList() != nil {
+		r.call.operands = len(ctx.GateOperandList().AllGateOperand())
+	}
+
+	for _, m := range ctx.AllGateModifier() {
+		if m.CTRL() == nil && m.NEGCTRL() == nil {
+			continue
+		}
+
+		if m.Expression() == nil {
+			r.call.controls++
+			continue
+		}
+
+		n, err := strconv.Atoi(m.Expression().GetText())
+		if err != nil {
+			r.call.controls = -1
+			break
+		}
+
+		r.call.controls += n
+	}
+}
+
+func (c *collector) EnterIndexedIdentifier(ctx *parser.IndexedIdentifierContext) {
+	c.refer(ctx.Identifier(), Variable)
+}
+
+func (c *collector) EnterLiteralExpression(ctx *parser.LiteralExpressionContext) {
+	c.refer(ctx.Identifier(), Variable)
+}
+
+func (c *collector) EnterCallExpression(ctx *parser.CallExpressionContext) {
+	c.refer(ctx.Identifier(), Def)
+}
+
+// source returns the source text from the start to the end token including whitespace.
+func symbol(id antlr.TerminalNode) antlr.Token {
+	if id == nil {
+		return nil
+	}
+
+	return id.GetSymbol()
+}
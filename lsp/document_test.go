@@ -0,0 +1,192 @@
+package lsp_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/itsubaki/qasm/lsp"
+)
+
+func ExampleAnalyze() {
+	text := `OPENQASM 3.0;
+include "../testdata/stdgates.qasm";
+
+gate bell a, b { h a; cx a, b; }
+
+qubit[2] q;
+bell q[0];
+cx q[0], q[1], q[2];
+x r;
+`
+
+	doc := lsp.Analyze("file:///tmp/main.qasm", text)
+	for _, d := range doc.Diagnostics {
+		fmt.Printf("%d:%d: %s\n", d.Range.Start.Line, d.Range.Start.Character, d.Message)
+	}
+
+	// Output:
+	// 6:0: "bell" takes 2 qubits, got 1
+	// 7:0: "cx" takes 2 qubits, got 3
+	// 8:2: undefined "r"
+}
+
+func ExampleDocument_Hover() {
+	text := `OPENQASM 3.0;
+gate cu(theta) c, t { ctrl @ U(theta, 0, 0) t; }
+qubit[2] q;
+cu(pi) q[0], q[1];
+`
+
+	doc := lsp.Analyze("file:///tmp/main.qasm", text)
+	fmt.Println(doc.Hover(lsp.Position{Line: 3, Character: 1}).Contents.Value)
+	fmt.Println(doc.Hover(lsp.Position{Line: 3, Character: 4}).Contents.Value)
+	fmt.Println(doc.Hover(lsp.Position{Line: 3, Character: 8}).Contents.Value)
+
+	// Output:
+	// ```qasm
+	// gate cu(theta) c, t
+	// ```
+	// ```qasm
+	// const float pi = 3.141592653589793
+	// ```
+	// ```qasm
+	// qubit[2] q
+	// ```
+}
+
+func ExampleDocument_Definition() {
+	text := `OPENQASM 3.0;
+qubit q;
+def f(int n) -> int { return n + 1; }
+int i = f(2);
+`
+
+	doc := lsp.Analyze("file:///tmp/main.qasm", text)
+	fmt.Println(doc.Definition(lsp.Position{Line: 3, Character: 8}))
+	fmt.Println(doc.Definition(lsp.Position{Line: 2, Character: 29}))
+
+	// Output:
+	// [{file:///tmp/main.qasm {{2 4} {2 5}}}]
+	// [{file:///tmp/main.qasm {{2 10} {2 11}}}]
+}
+
+func ExampleDocument_DocumentSymbols() {
+	text := `OPENQASM 3.0;
+gate g(theta) a { U(theta, 0, 0) a; }
+def f(qubit a) -> bit { return measure a; }
+const int n = 2;
+qubit[n] q;
+bit[n] c;
+`
+
+	doc := lsp.Analyze("file:///tmp/main.qasm", text)
+	for _, s := range doc.DocumentSymbols() {
+		fmt.Printf("%s %d %q\n", s.Name, s.Kind, s.Detail)
+		for _, c := range s.Children {
+			fmt.Printf("  %s %d %q\n", c.Name, c.Kind, c.Detail)
+		}
+	}
+
+	// Output:
+	// g 12 "gate g(theta) a"
+	//   theta 13 "angle theta"
+	//   a 13 "qubit a"
+	// f 12 "def f(qubit a) -> bit"
+	//   a 13 "qubit a"
+	// n 14 "const int n"
+	// q 13 "qubit[n] q"
+	// c 13 "bit[n] c"
+}
+
+func TestAnalyze(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{
+			text: "OPENQASM 3.0;\nqubit q0 q1;\n",
+			want: []string{"1:9: extraneous input 'q1' expecting ';'"},
+		},
+		{
+			text: "OPENQASM 3.0;\nqubit q;\nqubit q;\n",
+			want: []string{`2:6: "q" redeclared`},
+		},
+		{
+			text: "OPENQASM 3.0;\nqubit q;\nU(pi, 0) q;\nU(sqrt(2), 0, euler) q;\n",
+			want: []string{},
+		},
+		{
+			text: "OPENQASM 3.0;\ngate g(a, b) q { U(a, b, 0) q; }\nqubit[2] q;\ng(1) q[0];\nctrl @ g(1, 2) q[0], q[1];\nctrl(2) @ g(1, 2) q[0], q[1];\n",
+			want: []string{
+				`3:0: "g" takes 2 params, got 1`,
+				`5:10: "g" takes 3 qubits, got 2`,
+			},
+		},
+		{
+			text: "OPENQASM 3.0;\nint n = 1;\nfor int i in [0:n] { n += i; }\nn += i;\n",
+			want: []string{`3:5: undefined "i"`},
+		},
+		{
+			text: "OPENQASM 3.0;\ninclude \"not_found.qasm\";\nqubit q;\nh q;\n",
+			want: []string{"1:0: include not_found.qasm: file not found"},
+		},
+		{
+			text: "OPENQASM 3.0;\nqubit q;\nq q;\n",
+			want: []string{`2:0: "q" is not a gate`},
+		},
+		{
+			text: "OPENQASM 3.0;\nqubit[2] 𝜃;\nreset 𝜃[0]; x 𝜃[1];\n",
+			want: []string{`2:13: undefined "x"`},
+		},
+	}
+
+	for _, c := range cases {
+		doc := lsp.Analyze("file:///tmp/main.qasm", c.text)
+
+		got := []string{}
+		for _, d := range doc.Diagnostics {
+			got = append(got, fmt.Sprintf("%d:%d: %s", d.Range.Start.Line, d.Range.Start.Character, d.Message))
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("got=%q, want=%q", got, c.want)
+		}
+	}
+}
+
+func TestDocument_Completion(t *testing.T) {
+	text := `OPENQASM 3.0;
+gate g(theta) a { U(theta, 0, 0) a; }
+qubit q;
+
+`
+
+	doc := lsp.Analyze("file:///tmp/main.qasm", text)
+
+	cases := []struct {
+		pos     lsp.Position
+		label   string
+		visible bool
+	}{
+		{lsp.Position{Line: 1, Character: 20}, "theta", true},
+		{lsp.Position{Line: 3, Character: 0}, "theta", false},
+		{lsp.Position{Line: 3, Character: 0}, "g", true},
+		{lsp.Position{Line: 3, Character: 0}, "q", true},
+		{lsp.Position{Line: 3, Character: 0}, "pi", true},
+		{lsp.Position{Line: 3, Character: 0}, "sqrt", true},
+		{lsp.Position{Line: 3, Character: 0}, "U", true},
+	}
+
+	for _, c := range cases {
+		var got bool
+		for _, item := range doc.Completion(c.pos) {
+			if item.Label == c.label {
+				got = true
+			}
+		}
+
+		if got != c.visible {
+			t.Errorf("%v %s: got=%v, want=%v", c.pos, c.label, got, c.visible)
+		}
+	}
+}
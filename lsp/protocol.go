@@ -0,0 +1,186 @@
+package lsp
+
+import "encoding/json"
+
+// Message is a request or a notification of JSON-RPC 2.0.
+// A notification has no id.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is the result of a request.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+}
+
+// ErrorResponse is the error of a request.
+type ErrorResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   *ResponseError  `json:"error"`
+}
+
+// Notification is a message from the server without a response.
+type Notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// ResponseError is the code and the message of the error.
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+	return e.Message
+}
+
+// Error codes of JSON-RPC 2.0 and LSP.
+const (
+	ParseError           = -32700
+	InvalidRequest       = -32600
+	MethodNotFound       = -32601
+	InvalidParams        = -32602
+	ServerNotInitialized = -32002
+)
+
+// Position is the zero-based line and the character offset in UTF-16 code units.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Before returns true if p is before o.
+func (p Position) Before(o Position) bool {
+	return p.Line < o.Line || (p.Line == o.Line && p.Character < o.Character)
+}
+
+// Range is the range from Start to End, which is exclusive.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Contains returns true if the position is in the range including the end.
+func (r Range) Contains(p Position) bool {
+	return !p.Before(r.Start) && !r.End.Before(p)
+}
+
+// Location is the range in the document of the URI.
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// Severities of the diagnostics.
+const (
+	SeverityError   = 1
+	SeverityWarning = 2
+)
+
+// Diagnostic is an error or a warning of the document.
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// TextEdit replaces the range with the new text.
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// Kinds of the completion items.
+const (
+	CompletionFunction = 3
+	CompletionVariable = 6
+	CompletionConstant = 21
+)
+
+// CompletionItem is a candidate of the completion.
+type CompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Kinds of the document symbols.
+const (
+	SymbolFunction = 12
+	SymbolVariable = 13
+	SymbolConstant = 14
+)
+
+// DocumentSymbol is a symbol of the document and its children.
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+// MarkupContent is the content of the hover.
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Hover is the content shown over the range.
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+// TextDocumentItem is the document opened in the client.
+type TextDocumentItem struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+// TextDocumentIdentifier is the URI of the document.
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// DidOpenParams is the params of textDocument/didOpen.
+type DidOpenParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+// DidChangeParams is the params of textDocument/didChange.
+// The whole text is sent in each change since the sync kind is full.
+type DidChangeParams struct {
+	TextDocument   TextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+// DocumentParams is the params of the requests of the document.
+type DocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// PositionParams is the params of the requests of the position in the document.
+type PositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+// PublishDiagnosticsParams is the params of textDocument/publishDiagnostics.
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
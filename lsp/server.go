@@ -0,0 +1,421 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/itsubaki/qasm/formatter"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+// Server is the language server of OpenQASM 3 over the stream of JSON-RPC 2.0.
+// The documents are synchronized with the whole text and analyzed on each change.
+type Server struct {
+	in          *bufio.Reader
+	out         io.Writer
+	docs        map[string]*Document
+	initialized bool
+	shutdown    bool
+}
+
+// New returns a new server that reads the messages from in and writes them to out.
+func New(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*Document),
+	}
+}
+
+// Run reads and handles the messages until the exit notification or the end of the input.
+func (s *Server) Run() error {
+	for {
+		body, err := s.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var msg Message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.write(&ErrorResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &ResponseError{Code: ParseError, Message: err.Error()}}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, err := s.Handle(&msg)
+		if len(msg.ID) == 0 {
+			// notification
+			continue
+		}
+
+		if err != nil {
+			var rerr *ResponseError
+			if !errors.As(err, &rerr) {
+				rerr = &ResponseError{Code: InvalidParams, Message: err.Error()}
+			}
+
+			if err := s.write(&ErrorResponse{JSONRPC: "2.0", ID: msg.ID, Error: rerr}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := s.write(&Response{JSONRPC: "2.0", ID: msg.ID, Result: result}); err != nil {
+			return err
+		}
+	}
+}
+
+// Handle handles the message and returns the result of the request.
+func (s *Server) Handle(msg *Message) (any, error) {
+	if !s.initialized && msg.Method != "initialize" {
+		return nil, &ResponseError{Code: ServerNotInitialized, Message: "server not initialized"}
+	}
+
+	if s.shutdown {
+		return nil, &ResponseError{Code: InvalidRequest, Message: "server is shut down"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		s.initialized = true
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":           1,
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"completionProvider":         map[string]any{},
+				"documentFormattingProvider": true,
+				"documentSymbolProvider":     true,
+			},
+			"serverInfo": map[string]string{
+				"name": "qasm",
+			},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return nil, s.update(params.TextDocument.URI, text)
+	case "textDocument/didClose":
+		var params DocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		delete(s.docs, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+	case "textDocument/hover":
+		doc, params, err := s.position(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		return doc.Hover(params.Position), nil
+	case "textDocument/definition":
+		doc, params, err := s.position(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		return doc.Definition(params.Position), nil
+	case "textDocument/completion":
+		doc, params, err := s.position(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		return doc.Completion(params.Position), nil
+	case "textDocument/formatting":
+		doc, err := s.document(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		return doc.Format(), nil
+	case "textDocument/documentSymbol":
+		doc, err := s.document(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		return doc.DocumentSymbols(), nil
+	default:
+		if strings.HasPrefix(msg.Method, "$/") {
+			// optional notifications such as $/cancelRequest
+			return nil, nil
+		}
+
+		return nil, &ResponseError{Code: MethodNotFound, Message: fmt.Sprintf("method not found %q", msg.Method)}
+	}
+}
+
+// update analyzes the text and publishes the diagnostics.
+func (s *Server) update(uri, text string) error {
+	doc := Analyze(uri, text)
+	s.docs[uri] = doc
+
+	return s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: doc.Diagnostics,
+	})
+}
+
+func (s *Server) document(msg *Message) (*Document, error) {
+	var params DocumentParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, err
+	}
+
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, &ResponseError{Code: InvalidParams, Message: fmt.Sprintf("document not found %q", params.TextDocument.URI)}
+	}
+
+	return doc, nil
+}
+
+func (s *Server) position(msg *Message) (*Document, *PositionParams, error) {
+	var params PositionParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, nil, err
+	}
+
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, nil, &ResponseError{Code: InvalidParams, Message: fmt.Sprintf("document not found %q", params.TextDocument.URI)}
+	}
+
+	return doc, &params, nil
+}
+
+func (s *Server) notify(method string, params any) error {
+	return s.write(&Notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// read reads the body of the message with the Content-Length header.
+func (s *Server) read() ([]byte, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return nil, io.EOF
+		}
+
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid content length %q: %w", header.Get("Content-Length"), err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+
+	return body, nil
+}
+
+// write writes the message with the Content-Length header.
+func (s *Server) write(v any) error {
+	// the messages and the hover contents are not escaped.
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	msg := bytes.TrimSuffix(body.Bytes(), []byte("\n"))
+	if _, err := fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(msg), msg); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+
+	return nil
+}
+
+// Hover returns the declaration of the identifier at the position.
+// The builtin constants and functions are shown with their description.
+func (d *Document) Hover(p Position) *Hover {
+	var detail string
+	var rng Range
+	if r, ok := d.Reference(p); ok {
+		rng = r.Range
+		switch {
+		case r.Symbol != nil:
+			detail = r.Symbol.Detail
+		case r.kind == Gate:
+			detail = "gate U(θ, φ, λ) q"
+		case r.kind == Def:
+			detail = "builtin " + r.Name
+		default:
+			c, ok := visitor.Const[r.Name]
+			if !ok {
+				return nil
+			}
+
+			detail = fmt.Sprintf("const float %s = %v", r.Name, c)
+		}
+	} else if s, ok := d.Declaration(p); ok {
+		rng, detail = s.Range, s.Detail
+	} else {
+		return nil
+	}
+
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```qasm\n" + detail + "\n```"},
+		Range:    &rng,
+	}
+}
+
+// Definition returns the location of the declaration of the identifier at the position.
+func (d *Document) Definition(p Position) []Location {
+	if r, ok := d.Reference(p); ok && r.Symbol != nil {
+		return []Location{{URI: r.Symbol.URI, Range: r.Symbol.Range}}
+	}
+
+	if s, ok := d.Declaration(p); ok {
+		return []Location{{URI: s.URI, Range: s.Range}}
+	}
+
+	return []Location{}
+}
+
+// Completion returns the identifiers declared in the scopes of the position and the builtin constants and functions.
+func (d *Document) Completion(p Position) []CompletionItem {
+	seen := make(map[string]bool)
+	items := []CompletionItem{}
+	add := func(label string, kind int, detail string) {
+		if seen[label] {
+			return
+		}
+
+		seen[label] = true
+		items = append(items, CompletionItem{Label: label, Kind: kind, Detail: detail})
+	}
+
+	// the innermost declaration first
+	for _, s := range slices.Backward(d.Declared) {
+		if s.scope.rng == nil || s.scope.rng.Contains(p) {
+			add(s.Name, completionKind(s.Kind), s.Detail)
+		}
+	}
+
+	// the gates and the subroutines of the included files
+	for _, name := range slices.Sorted(maps.Keys(d.Globals)) {
+		s := d.Globals[name]
+		add(s.Name, completionKind(s.Kind), s.Detail)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(visitor.Const)) {
+		add(name, CompletionConstant, fmt.Sprintf("const float %s = %v", name, visitor.Const[name]))
+	}
+
+	for _, name := range Builtins {
+		add(name, CompletionFunction, "builtin "+name)
+	}
+
+	add(visitor.U, CompletionFunction, "gate U(θ, φ, λ) q")
+	return items
+}
+
+func completionKind(kind string) int {
+	switch kind {
+	case Gate, Def:
+		return CompletionFunction
+	case Const:
+		return CompletionConstant
+	default:
+		return CompletionVariable
+	}
+}
+
+// Format returns the edit that replaces the whole text with the formatted text.
+// No edit is returned if the text has a syntax error.
+func (d *Document) Format() []TextEdit {
+	text, err := formatter.Format(d.Text)
+	if err != nil || text == d.Text {
+		return []TextEdit{}
+	}
+
+	return []TextEdit{{
+		Range:   Range{End: d.End()},
+		NewText: text,
+	}}
+}
+
+// DocumentSymbols returns the symbols declared at the top level of the document and their children.
+func (d *Document) DocumentSymbols() []DocumentSymbol {
+	var convert func(symbols []*Symbol) []DocumentSymbol
+	convert = func(symbols []*Symbol) []DocumentSymbol {
+		out := []DocumentSymbol{}
+		for _, s := range symbols {
+			out = append(out, DocumentSymbol{
+				Name:           s.Name,
+				Detail:         s.Detail,
+				Kind:           symbolKind(s.Kind),
+				Range:          s.Full,
+				SelectionRange: s.Range,
+				Children:       convert(s.Children),
+			})
+		}
+
+		return out
+	}
+
+	return convert(d.Symbols)
+}
+
+func symbolKind(kind string) int {
+	switch kind {
+	case Gate, Def:
+		return SymbolFunction
+	case Const:
+		return SymbolConstant
+	default:
+		return SymbolVariable
+	}
+}
@@ -0,0 +1,138 @@
+package lsp_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/itsubaki/qasm/lsp"
+)
+
+func request(id int, method string, params any) string {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+	if id > 0 {
+		msg["id"] = id
+	}
+
+	body, _ := json.Marshal(msg)
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func responses(t *testing.T, out io.Reader) []string {
+	r := bufio.NewReader(out)
+
+	var list []string
+	for {
+		header, err := textproto.NewReader(r).ReadMIMEHeader()
+		if err == io.EOF {
+			return list
+		}
+
+		if err != nil {
+			t.Fatalf("read header: %v", err)
+		}
+
+		n, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			t.Fatalf("content length: %v", err)
+		}
+
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+
+		list = append(list, string(body))
+	}
+}
+
+func ExampleServer() {
+	uri := "file:///tmp/main.qasm"
+	doc := map[string]any{"uri": uri}
+
+	var in strings.Builder
+	in.WriteString(request(1, "initialize", map[string]any{}))
+	in.WriteString(request(0, "initialized", map[string]any{}))
+	in.WriteString(request(0, "textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "version": 1, "text": "OPENQASM 3.0;\nqubit  q;\nh q;\n"}}))
+	in.WriteString(request(2, "textDocument/formatting", map[string]any{"textDocument": doc}))
+	in.WriteString(request(3, "textDocument/foo", map[string]any{}))
+	in.WriteString(request(4, "shutdown", nil))
+	in.WriteString(request(0, "exit", nil))
+
+	var out bytes.Buffer
+	if err := lsp.New(strings.NewReader(in.String()), &out).Run(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, line := range strings.Split(out.String(), "Content-Length: ")[1:] {
+		fmt.Println(line[strings.Index(line, "{"):])
+	}
+
+	// Output:
+	// {"jsonrpc":"2.0","id":1,"result":{"capabilities":{"completionProvider":{},"definitionProvider":true,"documentFormattingProvider":true,"documentSymbolProvider":true,"hoverProvider":true,"textDocumentSync":1},"serverInfo":{"name":"qasm"}}}
+	// {"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///tmp/main.qasm","diagnostics":[{"range":{"start":{"line":2,"character":0},"end":{"line":2,"character":1}},"severity":1,"source":"qasm","message":"undefined \"h\""}]}}
+	// {"jsonrpc":"2.0","id":2,"result":[{"range":{"start":{"line":0,"character":0},"end":{"line":3,"character":0}},"newText":"OPENQASM 3.0;\nqubit q;\nh q;\n"}]}
+	// {"jsonrpc":"2.0","id":3,"error":{"code":-32601,"message":"method not found \"textDocument/foo\""}}
+	// {"jsonrpc":"2.0","id":4,"result":null}
+}
+
+func TestServer(t *testing.T) {
+	uri := "file:///tmp/main.qasm"
+	doc := map[string]any{"uri": uri}
+	text := "OPENQASM 3.0;\ngate g a { U(0, 0, 0) a; }\nqubit q;\ng q;\n"
+
+	var in strings.Builder
+	in.WriteString(request(1, "textDocument/hover", map[string]any{"textDocument": doc, "position": map[string]int{"line": 0, "character": 0}}))
+	in.WriteString(request(2, "initialize", map[string]any{}))
+	in.WriteString(request(0, "textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "version": 1, "text": "qubit q"}}))
+	in.WriteString(request(0, "textDocument/didChange", map[string]any{"textDocument": doc, "contentChanges": []map[string]string{{"text": text}}}))
+	in.WriteString(request(3, "textDocument/hover", map[string]any{"textDocument": doc, "position": map[string]int{"line": 3, "character": 0}}))
+	in.WriteString(request(4, "textDocument/definition", map[string]any{"textDocument": doc, "position": map[string]int{"line": 3, "character": 2}}))
+	in.WriteString(request(5, "textDocument/documentSymbol", map[string]any{"textDocument": doc}))
+	in.WriteString(request(6, "textDocument/hover", map[string]any{"textDocument": map[string]string{"uri": "file:///tmp/other.qasm"}, "position": map[string]int{"line": 0, "character": 0}}))
+	in.WriteString(request(0, "textDocument/didClose", map[string]any{"textDocument": doc}))
+	in.WriteString("Content-Length: 5\r\n\r\n{...}")
+
+	var out bytes.Buffer
+	if err := lsp.New(strings.NewReader(in.String()), &out).Run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	want := []string{
+		`{"jsonrpc":"2.0","id":1,"error":{"code":-32002,"message":"server not initialized"}}`,
+		`{"jsonrpc":"2.0","id":2,"result":{"capabilities":{"completionProvider":{},"definitionProvider":true,"documentFormattingProvider":true,"documentSymbolProvider":true,"hoverProvider":true,"textDocumentSync":1},"serverInfo":{"name":"qasm"}}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///tmp/main.qasm","diagnostics":[{"range":{"start":{"line":0,"character":7},"end":{"line":0,"character":8}},"severity":1,"source":"qasm","message":"missing ';' at '<EOF>'"}]}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///tmp/main.qasm","diagnostics":[]}}`,
+		`{"jsonrpc":"2.0","id":3,"result":{"contents":{"kind":"markdown","value":"` + "```qasm\\ngate g a\\n```" + `"},"range":{"start":{"line":3,"character":0},"end":{"line":3,"character":1}}}}`,
+		`{"jsonrpc":"2.0","id":4,"result":[{"uri":"file:///tmp/main.qasm","range":{"start":{"line":2,"character":6},"end":{"line":2,"character":7}}}]}`,
+		`{"jsonrpc":"2.0","id":5,"result":[{"name":"g","detail":"gate g a","kind":12,"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":26}},"selectionRange":{"start":{"line":1,"character":5},"end":{"line":1,"character":6}},"children":[{"name":"a","detail":"qubit a","kind":13,"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":26}},"selectionRange":{"start":{"line":1,"character":7},"end":{"line":1,"character":8}}}]},{"name":"q","detail":"qubit q","kind":13,"range":{"start":{"line":2,"character":0},"end":{"line":2,"character":8}},"selectionRange":{"start":{"line":2,"character":6},"end":{"line":2,"character":7}}}]}`,
+		`{"jsonrpc":"2.0","id":6,"error":{"code":-32602,"message":"document not found \"file:///tmp/other.qasm\""}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///tmp/main.qasm","diagnostics":[]}}`,
+		`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"invalid character '.' looking for beginning of object key string"}}`,
+	}
+
+	got := responses(t, &out)
+	if len(got) != len(want) {
+		t.Fatalf("got=%d, want=%d\n%s", len(got), len(want), strings.Join(got, "\n"))
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got=%s\nwant=%s", got[i], want[i])
+		}
+	}
+}
+
+func TestServer_header(t *testing.T) {
+	err := lsp.New(strings.NewReader("Content-Type: foo\r\n\r\n"), io.Discard).Run()
+	if err == nil || !strings.Contains(err.Error(), "invalid content length") {
+		t.Errorf("got=%v", err)
+	}
+}
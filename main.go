@@ -2,38 +2,161 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 
 	"maps"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"slices"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/itsubaki/q"
-	"github.com/itsubaki/qasm/environ"
+	"github.com/itsubaki/qasm/circuit"
+	"github.com/itsubaki/qasm/debugger"
+	"github.com/itsubaki/qasm/dump"
+	"github.com/itsubaki/qasm/flatten"
+	langserver "github.com/itsubaki/qasm/lsp"
+	"github.com/itsubaki/qasm/optimize"
 	"github.com/itsubaki/qasm/parser"
+	interactive "github.com/itsubaki/qasm/repl"
+	"github.com/itsubaki/qasm/route"
 	"github.com/itsubaki/qasm/scan"
+	"github.com/itsubaki/qasm/server"
+	"github.com/itsubaki/qasm/session"
+	"github.com/itsubaki/qasm/stats"
 	renderer "github.com/itsubaki/qasm/svg"
+	"github.com/itsubaki/qasm/tracer"
+	"github.com/itsubaki/qasm/transpile"
 	"github.com/itsubaki/qasm/visitor"
 )
 
 func main() {
-	var filepath string
-	var top int
-	var repl, lex, parse, validate, svg, verbose bool
+	var filepath, emit, from, draw, controlFlow, expand, defs, basis, coupling string
+	var svgConfig, svgTheme, svgFont, trace, serve, history, saveState, loadState string
+	var dumpState, dumpProbs, dumpMarginals string
+	var top, physical, width, depth, svgFold, svgFontSize, svgPrecision, serveMaxQubits, serveConcurrency int
+	var serveTimeout time.Duration
+	var svgWireStroke, svgOpStroke float64
+	var repl, debug, lsp, lex, parse, validate, svg, html, stat, phase, o1, o2, verbose bool
 	flag.StringVar(&filepath, "f", "", "filepath")
+	flag.StringVar(&emit, "emit", "", "Emit the input in the given form (flat, json)")
+	flag.StringVar(&from, "from", "", "Convert the input from the given form (json) into OpenQASM 3")
+	flag.StringVar(&basis, "basis", "", "Decompose the input into the comma-separated basis gates (e.g. rz,sx,x,cx)")
+	flag.StringVar(&coupling, "coupling", "", "Route the input onto the coupling map of the JSON or YAML file")
+	flag.BoolVar(&phase, "global-phase", false, "Track the global phase exactly in -basis")
+	flag.BoolVar(&o1, "O1", false, "Cancel inverse pairs, merge single-qubit gates and drop identity rotations")
+	flag.BoolVar(&o2, "O2", false, "Optimize as -O1 and commute diagonal gates through controls")
 	flag.IntVar(&top, "top", -1, "top results")
+	flag.IntVar(&physical, "physical", 0, "Allocate the physical qubits $0 to $n-1 (0 allocates $0 to $n on first use of $n)")
 	flag.BoolVar(&repl, "repl", false, "REPL(read-eval-print loop) mode")
+	flag.StringVar(&history, "history", "~/.qasm_history", "History file of -repl (empty disables the history)")
+	flag.BoolVar(&debug, "debug", false, "Debug the program of -f statement by statement with the commands read from stdin")
+	flag.BoolVar(&lsp, "lsp", false, "Serve the Language Server Protocol over stdin and stdout")
 	flag.BoolVar(&lex, "lex", false, "Lex the input into a sequence of tokens")
 	flag.BoolVar(&parse, "parse", false, "Parse the input and convert it into an AST (abstract syntax tree)")
 	flag.BoolVar(&validate, "validate", false, "Validate the input without executing it")
 	flag.BoolVar(&svg, "svg", false, "Render the circuit as an SVG")
+	flag.BoolVar(&html, "html", false, "Render the circuit and the state after each layer as a self-contained HTML")
+	flag.StringVar(&draw, "draw", "", "Draw the circuit in the given form (svg, text, latex)")
+	flag.IntVar(&width, "width", 80, "Fold the text diagram to the width (0 disables folding)")
+	flag.StringVar(&controlFlow, "control-flow", "group", "Draw the control flow in the given mode (group, unroll)")
+	flag.StringVar(&expand, "expand", "", "Expand the comma-separated gates and subroutines inline in the diagram")
+	flag.IntVar(&depth, "expand-depth", 0, "Expand the gates and subroutines inline up to the depth in the diagram")
+	flag.StringVar(&defs, "defs", "", "Write the SVG of each gate and subroutine definition into the directory")
+	flag.StringVar(&svgConfig, "svg-config", "", "Load the SVG config from the JSON file")
+	flag.StringVar(&svgTheme, "svg-theme", "light", "Color the SVG with the theme (light, dark)")
+	flag.StringVar(&svgFont, "svg-font-family", renderer.DefaultConfig.FontFamily, "Font family of the SVG")
+	flag.IntVar(&svgFontSize, "svg-font-size", renderer.DefaultConfig.FontSize, "Font size of the SVG")
+	flag.IntVar(&svgPrecision, "svg-precision", renderer.DefaultConfig.Precision, "Precision of the gate params in the SVG")
+	flag.IntVar(&svgFold, "svg-fold", 0, "Fold the SVG into rows of the number of layers (0 disables folding)")
+	flag.Float64Var(&svgWireStroke, "svg-wire-stroke", renderer.DefaultConfig.WireStroke, "Stroke width of the wires in the SVG")
+	flag.Float64Var(&svgOpStroke, "svg-op-stroke", renderer.DefaultConfig.OpStroke, "Stroke width of the ops in the SVG")
+	flag.StringVar(&serve, "serve", "", "Serve the JSON endpoints (run, validate, svg, format, lex, parse) on the address (e.g. :8080)")
+	flag.IntVar(&serveMaxQubits, "serve-max-qubits", 24, "Maximum number of qubits of each run of -serve (0 is unlimited)")
+	flag.DurationVar(&serveTimeout, "serve-timeout", 10*time.Second, "Timeout of each request of -serve (0 disables the timeout)")
+	flag.IntVar(&serveConcurrency, "serve-concurrency", 0, "Maximum number of requests of -serve processed at the same time (0 is the number of CPUs)")
+	flag.BoolVar(&stat, "stats", false, "Report the resource estimation of the input without simulating it")
+	flag.StringVar(&saveState, "save-state", "", "Save the state vector, the qubit registers and the classical values after the run to the JSON file")
+	flag.StringVar(&loadState, "load-state", "", "Load the state saved by -save-state before the run")
+	flag.StringVar(&dumpState, "dump-state", "", "Write the state vector after the run as a NumPy .npy file of complex128 in the little-endian order of the qubits")
+	flag.StringVar(&dumpProbs, "dump-probs", "", "Write the probability of each basis state after the run as CSV")
+	flag.StringVar(&dumpMarginals, "dump-marginals", "", "Write the marginal probabilities of each register after the run as CSV")
+	flag.StringVar(&trace, "trace", "", "Write the execution trace of the input to the file as JSON lines")
 	flag.BoolVar(&verbose, "verbose", false, "Enable verbose output")
 	flag.Parse()
 
+	opts := []renderer.Option{
+		renderer.WithMode(renderer.Mode(controlFlow)),
+		renderer.WithDepth(depth),
+	}
+
+	if expand != "" {
+		opts = append(opts, renderer.WithExpand(strings.Split(expand, ",")...))
+	}
+
+	config := renderer.DefaultConfig
+	if svgConfig != "" {
+		c, err := renderer.LoadConfig(svgConfig)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		config = c
+	}
+
+	// the flags set on the command line override the config file
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "svg-theme":
+			theme, ok := renderer.Themes[svgTheme]
+			if !ok {
+				fmt.Fprintf(os.Stderr, "unsupported theme %q\n", svgTheme)
+				os.Exit(1)
+			}
+
+			config.Theme = theme
+		case "svg-font-family":
+			config.FontFamily = svgFont
+		case "svg-font-size":
+			config.FontSize = svgFontSize
+		case "svg-precision":
+			config.Precision = svgPrecision
+		case "svg-fold":
+			config.Fold = svgFold
+		case "svg-wire-stroke":
+			config.WireStroke = svgWireStroke
+		case "svg-op-stroke":
+			config.OpStroke = svgOpStroke
+		}
+	})
+
 	switch {
+	case serve != "":
+		s := server.New(
+			server.WithMaxQubits(serveMaxQubits),
+			server.WithTimeout(serveTimeout),
+			server.WithConcurrency(serveConcurrency),
+			server.WithConfig(config),
+		)
+
+		fmt.Fprintf(os.Stderr, "listening on %s\n", serve)
+		if err := http.ListenAndServe(serve, s); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case lsp:
+		if err := langserver.New(os.Stdin, os.Stdout).Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 	case lex:
 		text, err := Read(filepath)
 		if err != nil {
@@ -69,6 +192,50 @@ func main() {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
+	case from != "":
+		text, err := Read(filepath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		out, err := Import(text, from)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		fmt.Print(out)
+	case defs != "":
+		text, err := Read(filepath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		files, err := WriteDefinitions(defs, text, config, opts...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		for _, f := range files {
+			fmt.Println(f)
+		}
+	case html:
+		text, err := Read(filepath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		page, err := renderer.HTML(text, config, opts...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		fmt.Print(page)
 	case svg:
 		text, err := Read(filepath)
 		if err != nil {
@@ -76,15 +243,138 @@ func main() {
 			os.Exit(1)
 		}
 
-		diagram, err := renderer.SVG(text, renderer.DefaultConfig)
+		diagram, err := renderer.SVG(text, config, opts...)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 
 		fmt.Println(diagram)
+	case draw != "":
+		text, err := Read(filepath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		diagram, err := Draw(text, draw, width, config, opts...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		fmt.Print(diagram)
+	case stat:
+		text, err := Read(filepath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		s, err := stats.Estimate(text)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		fmt.Print(s)
+	case emit != "" || basis != "" || coupling != "" || o1 || o2:
+		text, err := Read(filepath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		p, err := flatten.Flatten(text)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if o1 || o2 {
+			level := 1
+			if o2 {
+				level = 2
+			}
+
+			o := optimize.Optimize(p, level)
+			fmt.Fprintf(os.Stderr, "gates: %d -> %d, depth: %d -> %d\n", p.NumGates(), o.NumGates(), p.Depth(), o.Depth())
+			p = o
+		}
+
+		var opts []transpile.Option
+		if phase {
+			opts = append(opts, transpile.WithGlobalPhase())
+		}
+
+		if basis != "" {
+			p, err = transpile.Transpile(p, strings.Split(basis, ","), opts...)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		var layout string
+		if coupling != "" {
+			c, err := route.Load(coupling)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			r, err := route.Route(p, c)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			p, layout = r.Program, r.Layout()
+			if basis != "" {
+				// decompose the inserted swaps
+				p, err = transpile.Transpile(p, strings.Split(basis, ","), opts...)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+		}
+
+		out, err := Emit(p, emit)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		fmt.Print(out + layout)
 	case repl:
-		REPL()
+		r := interactive.New(Input(), os.Stdout,
+			interactive.WithHistory(Home(history)),
+			interactive.WithConfig(config),
+			interactive.WithTop(top),
+		)
+
+		if err := r.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case debug:
+		if filepath == "" {
+			fmt.Fprintln(os.Stderr, "-debug reads the program from -f")
+			os.Exit(1)
+		}
+
+		text, err := Read(filepath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		d := debugger.New(text, Input(), os.Stdout)
+		if err := d.Run(visitor.WithPhysicalQubits(physical)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 	default:
 		text, err := Read(filepath)
 		if err != nil {
@@ -98,15 +388,62 @@ func main() {
 			os.Exit(1)
 		}
 
-		qsim := q.New()
-		env := environ.New()
-		v := visitor.New(qsim, env)
+		vopts := []visitor.Option{visitor.WithPhysicalQubits(physical)}
+		if trace != "" {
+			f, err := os.Create(trace)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer f.Close()
+
+			vopts = append(vopts, visitor.WithObserver(tracer.New(f)))
+		}
+
+		sess := session.New()
+		if loadState != "" {
+			snapshot, err := session.LoadFile(loadState)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			sess.Restore(snapshot)
+		}
+
+		qsim, env := sess.Q, sess.Env
+		v := sess.Visitor(vopts...)
 
 		if err := v.Run(program); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 
+		if saveState != "" {
+			if err := session.SaveFile(saveState, sess.Snapshot()); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		if dumpState != "" || dumpProbs != "" || dumpMarginals != "" {
+			snapshot := sess.Snapshot()
+			if err := Dump(dumpState, func(w io.Writer) error { return dump.WriteNPY(w, dump.Amplitudes(snapshot)) }); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if err := Dump(dumpProbs, func(w io.Writer) error { return dump.WriteProbabilities(w, snapshot) }); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if err := Dump(dumpMarginals, func(w io.Writer) error { return dump.WriteMarginals(w, snapshot) }); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
 		states := qsim.Qubit().State(env.Index()...)
 		for _, s := range q.Top(states, top) {
 			fmt.Println(s)
@@ -142,70 +479,146 @@ func Read(filepath string) (string, error) {
 	return text, nil
 }
 
-func REPL() {
+func Emit(p *flatten.Program, form string) (string, error) {
+	switch form {
+	case "", "flat":
+		return p.String(), nil
+	case "json":
+		b, err := json.MarshalIndent(circuit.New(p), "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("marshal circuit: %w", err)
+		}
+
+		return string(b) + "\n", nil
+	default:
+		return "", fmt.Errorf("unsupported emit %q", form)
+	}
+}
+
+func Import(text, form string) (string, error) {
+	switch form {
+	case "json":
+		c, err := circuit.Parse([]byte(text))
+		if err != nil {
+			return "", err
+		}
+
+		return c.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported from %q", form)
+	}
+}
+
+func Draw(text, form string, width int, config renderer.Config, opt ...renderer.Option) (string, error) {
+	layout, err := renderer.Parse(text, opt...)
+	if err != nil {
+		return "", err
+	}
+
+	switch form {
+	case "svg":
+		return renderer.Render(layout, config) + "\n", nil
+	case "text":
+		return renderer.RenderText(layout, width), nil
+	case "latex":
+		return renderer.RenderLaTeX(layout), nil
+	default:
+		return "", fmt.Errorf("unsupported draw %q", form)
+	}
+}
+
+// WriteDefinitions writes the SVG of each gate and subroutine definition into the directory
+// as <name>.svg and returns the paths of the files.
+func WriteDefinitions(dir, text string, config renderer.Config, opt ...renderer.Option) ([]string, error) {
+	defs, err := renderer.Definitions(text, opt...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, d := range defs {
+		path := filepath.Join(dir, d.Name+".svg")
+		if err := os.WriteFile(path, []byte(renderer.Render(d.Layout, config)+"\n"), 0o644); err != nil {
+			return nil, err
+		}
+
+		files = append(files, path)
+	}
+
+	return files, nil
+}
+
+// Dump writes to the file with the function if the path is not empty.
+func Dump(path string, write func(w io.Writer) error) error {
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Home returns the path with the leading ~/ replaced by the home directory.
+func Home(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, rest)
+}
+
+// Input returns the lines read from stdin.
+// The channel is closed on EOF, SIGINT or SIGTERM.
+func Input() <-chan string {
 	sigint := make(chan os.Signal, 2)
 	signal.Notify(sigint, syscall.SIGINT, syscall.SIGTERM)
 
-	input := make(chan string)
+	lines := make(chan string)
 	go func() {
+		defer close(lines)
+
 		s := bufio.NewScanner(os.Stdin)
 		for s.Scan() {
-			input <- s.Text()
+			lines <- s.Text()
 		}
 	}()
 
-	qsim := q.New()
-	env := environ.New()
-	v := visitor.New(qsim, env)
-
-	fmt.Println("qasm> OPENQASM 3.0;")
-	for {
-		fmt.Printf("qasm> ")
-
-		select {
-		case <-sigint:
-			return
-		case text := <-input:
-			if len(text) < 1 {
-				continue
-			}
+	input := make(chan string)
+	go func() {
+		defer close(input)
 
-			switch text {
-			case ":exit", ":quit", ":q":
+		for {
+			select {
+			case <-sigint:
 				return
-			case ":reset", ":r":
-				qsim = q.New()
-				env = environ.New()
-				v = visitor.New(qsim, env)
-				continue
-			case ":print", ":p":
-				fmt.Println("--- STATE ---")
-				states := qsim.Qubit().State(env.Index()...)
-				for _, s := range q.Top(states, -1) {
-					fmt.Println(s)
+			case text, ok := <-lines:
+				if !ok {
+					return
 				}
 
-				fmt.Println("--- ENVIRONMENT ---")
-				fmt.Printf("%-10s: %v\n", "const", env.Const)
-				fmt.Printf("%-10s: %v\n", "variable", env.Variable)
-				fmt.Printf("%-10s: %v\n", "bit", env.Bit)
-				fmt.Printf("%-10s: %v\n", "bit[]", env.BitArray)
-				fmt.Printf("%-10s: %v\n", "qubit", env.Qubit)
-				fmt.Printf("%-10s: %v\n", "gate", slices.Sorted(maps.Keys(env.Gate)))
-				fmt.Printf("%-10s: %v\n", "subroutine", slices.Sorted(maps.Keys(env.Subroutine)))
-				continue
-			}
-
-			program, err := parser.Parse(text)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-
-			if err := v.Run(program); err != nil {
-				fmt.Println(err)
-				continue
+				input <- text
 			}
 		}
-	}
+	}()
+
+	return input
 }
@@ -0,0 +1,212 @@
+package optimize
+
+import (
+	"slices"
+
+	"github.com/itsubaki/q/math/epsilon"
+	"github.com/itsubaki/q/math/matrix"
+	"github.com/itsubaki/q/quantum/gate"
+	"github.com/itsubaki/qasm/flatten"
+)
+
+// Optimizer is a peephole optimizer of the straight-line program.
+// The optimized program is equal to the input up to the global phase.
+type Optimizer struct {
+	level int
+	tol   float64
+}
+
+// Option is a function that modifies the Optimizer.
+type Option func(*Optimizer)
+
+// WithTolerance sets the tolerance to regard a rotation as the identity.
+func WithTolerance(tol float64) Option {
+	return func(o *Optimizer) {
+		o.tol = tol
+	}
+}
+
+// New returns a new Optimizer.
+// Level 1 cancels adjacent inverse pairs, merges consecutive single-qubit gates and drops identity rotations.
+// Level 2 also commutes diagonal gates through controls to find more pairs.
+func New(level int, opts ...Option) *Optimizer {
+	o := &Optimizer{
+		level: level,
+		tol:   epsilon.E13(),
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// Optimize returns the optimized program.
+func Optimize(p *flatten.Program, level int, opts ...Option) *flatten.Program {
+	return New(level, opts...).Optimize(p)
+}
+
+// Optimize returns the optimized program.
+func (o *Optimizer) Optimize(p *flatten.Program) *flatten.Program {
+	out := &flatten.Program{
+		Qubits: p.Qubits,
+		Bits:   p.Bits,
+		Gates:  p.Gates,
+	}
+
+	if o.level < 1 {
+		out.Ops = slices.Clone(p.Ops)
+		return out
+	}
+
+	for _, op := range p.Ops {
+		if !o.mergeable(op) {
+			out.Ops = append(out.Ops, op)
+			continue
+		}
+
+		if o.Identity(op) {
+			continue
+		}
+
+		j := o.partner(out.Ops, op)
+		if j < 0 {
+			out.Ops = append(out.Ops, op)
+			continue
+		}
+
+		merged, ok := o.Merge(out.Ops[j], op)
+		if !ok {
+			out.Ops = append(out.Ops, op)
+			continue
+		}
+
+		if o.Identity(merged) {
+			out.Ops = slices.Delete(out.Ops, j, j+1)
+			continue
+		}
+
+		out.Ops[j] = merged
+	}
+
+	return out
+}
+
+// Identity returns true if the op is the identity within the tolerance.
+// An uncontrolled op is compared up to the global phase.
+func (o *Optimizer) Identity(op flatten.Op) bool {
+	if op.Name != flatten.U {
+		return false
+	}
+
+	u := gate.U(op.Params[0], op.Params[1], op.Params[2])
+	if len(op.Control) == 0 {
+		theta, phi, lambda, _ := flatten.Euler(u, o.tol)
+		return epsilon.IsZeroF64(theta, o.tol) && epsilon.IsZeroF64(flatten.Wrap(phi+lambda), o.tol)
+	}
+
+	return u.Equal(gate.I(), o.tol)
+}
+
+// Merge returns the op equal to applying a and then b.
+// It returns false if the ops cannot be merged into a single op.
+func (o *Optimizer) Merge(a, b flatten.Op) (flatten.Op, bool) {
+	if !slices.Equal(a.Target, b.Target) || !sameSet(a.Control, b.Control) {
+		return flatten.Op{}, false
+	}
+
+	u := o.Matrix(b).MatMul(o.Matrix(a))
+	if len(a.Control) > 0 && !u.Equal(gate.I(), o.tol) {
+		// controlled ops are only cancelled. merging them changes the relative phase.
+		return flatten.Op{}, false
+	}
+
+	theta, phi, lambda, _ := flatten.Euler(u, o.tol)
+	return flatten.Op{
+		Name:    flatten.U,
+		Params:  []float64{theta, phi, lambda},
+		Control: a.Control,
+		Target:  a.Target,
+	}, true
+}
+
+// Matrix returns the 2x2 unitary of the U op.
+func (o *Optimizer) Matrix(op flatten.Op) *matrix.Matrix {
+	return gate.U(op.Params[0], op.Params[1], op.Params[2])
+}
+
+// Diagonal returns true if the op is diagonal on the qubit.
+func (o *Optimizer) Diagonal(op flatten.Op, qubit int) bool {
+	if slices.Contains(op.Control, qubit) {
+		return true
+	}
+
+	return op.Name == flatten.U && epsilon.IsZeroF64(op.Params[0], o.tol)
+}
+
+// Commute returns true if the ops are diagonal on all the shared qubits.
+func (o *Optimizer) Commute(a, b flatten.Op) bool {
+	if !o.mergeable(a) || !o.mergeable(b) {
+		return false
+	}
+
+	for _, q := range a.Qubits() {
+		if !slices.Contains(b.Qubits(), q) {
+			continue
+		}
+
+		if !o.Diagonal(a, q) || !o.Diagonal(b, q) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// partner returns the index of the op that the op may be merged with, or -1.
+func (o *Optimizer) partner(ops []flatten.Op, op flatten.Op) int {
+	for j := len(ops) - 1; j >= 0; j-- {
+		if !overlap(ops[j], op) {
+			continue
+		}
+
+		if slices.Equal(ops[j].Target, op.Target) && sameSet(ops[j].Control, op.Control) && o.mergeable(ops[j]) {
+			return j
+		}
+
+		if o.level < 2 || !o.Commute(ops[j], op) {
+			return -1
+		}
+	}
+
+	return -1
+}
+
+func (o *Optimizer) mergeable(op flatten.Op) bool {
+	return op.Name == flatten.U && op.Cond == ""
+}
+
+func overlap(a, b flatten.Op) bool {
+	for _, q := range a.Qubits() {
+		if slices.Contains(b.Qubits(), q) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sameSet(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, v := range a {
+		if !slices.Contains(b, v) {
+			return false
+		}
+	}
+
+	return true
+}
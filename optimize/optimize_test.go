@@ -0,0 +1,140 @@
+package optimize_test
+
+import (
+	"fmt"
+	"math/cmplx"
+	"os"
+	"testing"
+
+	"github.com/itsubaki/q/math/epsilon"
+	"github.com/itsubaki/qasm/flatten"
+	"github.com/itsubaki/qasm/optimize"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+func ExampleOptimize() {
+	p, err := flatten.Flatten(`
+	gate h q { U(pi/2.0, 0, pi) q; }
+	gate cx c, t { ctrl @ U(pi, 0, pi) c, t; }
+	gate rz(theta) q { U(0, 0, theta) q; }
+
+	qubit[2] q;
+	h q[0];
+	h q[0];
+	cx q[0], q[1];
+	cx q[0], q[1];
+	rz(pi/4) q[1];
+	inv @ rz(pi/4) q[1];
+	U(0, 0, 0) q[0];
+	rz(pi/4) q[0];
+	rz(pi/4) q[0];
+	cx q[0], q[1];
+	rz(pi/2) q[0];
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, level := range []int{1, 2} {
+		o := optimize.Optimize(p, level)
+		fmt.Printf("O%d: gates: %d -> %d, depth: %d -> %d\n", level, p.NumGates(), o.NumGates(), p.Depth(), o.Depth())
+		for _, op := range o.Ops {
+			fmt.Printf("%s%.4f %v %v\n", op.Name, op.Params, op.Control, op.Target)
+		}
+	}
+
+	// Output:
+	// O1: gates: 11 -> 3, depth: 9 -> 3
+	// U[0.0000 0.0000 1.5708] [] [0]
+	// U[3.1416 0.0000 3.1416] [0] [1]
+	// U[0.0000 0.0000 1.5708] [] [0]
+	// O2: gates: 11 -> 2, depth: 9 -> 2
+	// U[0.0000 0.0000 3.1416] [] [0]
+	// U[3.1416 0.0000 3.1416] [0] [1]
+}
+
+func TestOptimize(t *testing.T) {
+	cases := []string{
+		"../testdata/deutsch_jozsa_balanced.qasm",
+		"../testdata/deutsch_jozsa_constant.qasm",
+		"../testdata/grover.qasm",
+		"../testdata/qft.qasm",
+		"../testdata/qsp.qasm",
+		"../testdata/quantum_counting.qasm",
+		`
+		qubit[3] q;
+		U(0.1, 0.2, 0.3) q;
+		ctrl @ U(0, 0, 0.4) q[0], q[1];
+		U(0, 0, 0.5) q[1];
+		ctrl @ U(pi, 0, pi) q[1], q[2];
+		U(0, 0, -0.5) q[1];
+		ctrl @ U(0, 0, -0.4) q[0], q[1];
+		ctrl @ U(pi, 0, pi) q[1], q[2];
+		U(0.3, 0.2, 0.1) q[2];
+		inv @ U(0.3, 0.2, 0.1) q[2];
+		ctrl(2) @ U(pi, 0, pi) q[0], q[1], q[2];
+		ctrl(2) @ U(pi, 0, pi) q[1], q[0], q[2];
+		`,
+	}
+
+	for _, c := range cases {
+		text := c
+		if b, err := os.ReadFile(c); err == nil {
+			text = string(b)
+		}
+
+		p, err := flatten.Flatten(text)
+		if err != nil {
+			t.Fatalf("%s: %v", c, err)
+		}
+
+		want, _, err := visitor.Run(p.String())
+		if err != nil {
+			t.Fatalf("%s: %v", c, err)
+		}
+
+		for _, level := range []int{0, 1, 2} {
+			o := optimize.Optimize(p, level)
+			if o.NumGates() > p.NumGates() || o.Depth() > p.Depth() {
+				t.Errorf("O%d %s: gates: %d -> %d, depth: %d -> %d", level, c, p.NumGates(), o.NumGates(), p.Depth(), o.Depth())
+			}
+
+			got, _, err := visitor.Run(o.String())
+			if err != nil {
+				t.Fatalf("%s: %v", o, err)
+			}
+
+			// equal up to global phase
+			var inner complex128
+			for i, a := range want.Amplitude() {
+				inner += cmplx.Conj(a) * got.Amplitude()[i]
+			}
+
+			if !epsilon.IsZeroF64(cmplx.Abs(inner)-1, 1e-8) {
+				t.Errorf("O%d %s: |<want|got>|=%v", level, c, cmplx.Abs(inner))
+			}
+		}
+	}
+}
+
+func TestWithTolerance(t *testing.T) {
+	cases := []struct {
+		tol  float64
+		want int
+	}{
+		{0, 1},
+		{1e-3, 0},
+	}
+
+	p, err := flatten.Flatten(`qubit q; U(1e-4, 0, 0) q;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cases {
+		o := optimize.Optimize(p, 1, optimize.WithTolerance(c.tol))
+		if o.NumGates() != c.want {
+			t.Errorf("tol=%v: got=%v, want=%v", c.tol, o.NumGates(), c.want)
+		}
+	}
+}
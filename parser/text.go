@@ -0,0 +1,18 @@
+package parser
+
+import "github.com/antlr4-go/antlr/v4"
+
+// Text returns the source text of the context including the hidden tokens such as the whitespaces.
+func Text(ctx antlr.ParserRuleContext) string {
+	return Source(ctx.GetStart(), ctx.GetStop())
+}
+
+// Source returns the source text from the start token to the stop token.
+// If the stop token is missing or before the start token, it returns the text of the start token.
+func Source(start, stop antlr.Token) string {
+	if stop == nil || stop.GetStop() < start.GetStart() {
+		return start.GetText()
+	}
+
+	return start.GetInputStream().GetText(start.GetStart(), stop.GetStop())
+}
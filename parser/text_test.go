@@ -0,0 +1,22 @@
+package parser_test
+
+import (
+	"fmt"
+
+	"github.com/itsubaki/qasm/parser"
+)
+
+func ExampleText() {
+	program, err := parser.Parse("qubit q;\nif (c[0]  ==  1) { U(pi, 0, pi) q; }")
+	if err != nil {
+		panic(err)
+	}
+
+	stmt := program.AllStatementOrScope()[1].Statement()
+	fmt.Println(parser.Text(stmt.IfStatement().Expression()))
+	fmt.Println(parser.Source(stmt.GetStart(), nil))
+
+	// Output:
+	// c[0]  ==  1
+	// if
+}
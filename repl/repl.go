@@ -0,0 +1,428 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/itsubaki/q"
+	"github.com/itsubaki/qasm/gen/parser"
+	xparser "github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/session"
+	"github.com/itsubaki/qasm/svg"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+// ErrQuit is returned by the command to quit the REPL.
+var ErrQuit = errors.New("quit")
+
+// Prompts of the first line and the following lines of the input.
+const (
+	Prompt         = "qasm> "
+	ContinuePrompt = "....> "
+)
+
+// Version is the version statement of the saved session.
+const Version = "OPENQASM 3.0;"
+
+// MaxUndo is the default number of the inputs that can be undone.
+// Each undo keeps a copy of the state vector, so the oldest ones are dropped.
+const MaxUndo = 32
+
+// REPL reads the statements and the commands, and runs the statements in the session.
+// The input is buffered until the braces are balanced.
+type REPL struct {
+	in      <-chan string
+	out     io.Writer
+	history string
+	config  svg.Config
+	top     int
+	maxUndo int
+	session *session.Session
+	v       *visitor.Visitor
+	rec     *recorder
+	entries []string
+	undo    []undo
+	lines   []string
+}
+
+// undo is the snapshot and the number of the statements before the input.
+type undo struct {
+	snapshot *session.Snapshot
+	entries  int
+}
+
+// Option is a function that modifies the REPL.
+type Option func(*REPL)
+
+// WithHistory sets the file of the history.
+// The history is read when the REPL starts and each input is appended to the file.
+func WithHistory(path string) Option {
+	return func(r *REPL) {
+		r.history = path
+	}
+}
+
+// WithConfig sets the config of the SVG.
+func WithConfig(config svg.Config) Option {
+	return func(r *REPL) {
+		r.config = config
+	}
+}
+
+// WithTop sets the number of the states printed in the order of the probability (-1 is all).
+func WithTop(n int) Option {
+	return func(r *REPL) {
+		r.top = n
+	}
+}
+
+// WithMaxUndo sets the number of the inputs that can be undone.
+// If n is not positive, the default of MaxUndo is used.
+func WithMaxUndo(n int) Option {
+	return func(r *REPL) {
+		if n <= 0 {
+			return
+		}
+
+		r.maxUndo = n
+	}
+}
+
+// New returns a new REPL that reads the lines from in and writes to out.
+func New(in <-chan string, out io.Writer, opt ...Option) *REPL {
+	r := &REPL{
+		in:      in,
+		out:     out,
+		config:  svg.DefaultConfig,
+		top:     -1,
+		maxUndo: MaxUndo,
+	}
+
+	for _, f := range opt {
+		f(r)
+	}
+
+	r.Reset()
+	return r
+}
+
+// recorder records the last measurement.
+type recorder struct {
+	visitor.NopObserver
+	last []bool
+}
+
+func (r *recorder) Measure(m visitor.Measurement) error {
+	r.last = m.Outcome
+	return nil
+}
+
+// Reset starts a new session with a new simulator and environment.
+func (r *REPL) Reset() {
+	r.session, r.rec = session.New(), &recorder{}
+	r.v = r.session.Visitor(visitor.WithObserver(r.rec))
+	r.entries, r.undo = nil, nil
+}
+
+// Restore restores the snapshot of the session and the statements.
+func (r *REPL) Restore(u undo) {
+	r.session.Restore(u.snapshot)
+	r.v = r.session.Visitor(visitor.WithObserver(r.rec))
+	r.entries = r.entries[:u.entries]
+}
+
+// Run reads the input until the end of it or the quit command.
+func (r *REPL) Run() error {
+	history, err := r.open()
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+	}
+
+	if history != nil {
+		defer history.Close()
+	}
+
+	fmt.Fprintln(r.out, Prompt+Version)
+
+	var buf []string
+	for {
+		prompt := Prompt
+		if len(buf) > 0 {
+			prompt = ContinuePrompt
+		}
+
+		fmt.Fprint(r.out, prompt)
+		line, ok := <-r.in
+		if !ok {
+			return nil
+		}
+
+		if strings.TrimSpace(line) == "" && len(buf) == 0 {
+			continue
+		}
+
+		r.lines = append(r.lines, line)
+		if history != nil {
+			if _, err := fmt.Fprintln(history, line); err != nil {
+				fmt.Fprintf(r.out, "write history: %v\n", err)
+			}
+		}
+
+		if len(buf) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if err := r.Command(strings.TrimSpace(line)); err != nil {
+				if errors.Is(err, ErrQuit) {
+					return nil
+				}
+
+				fmt.Fprintln(r.out, err)
+			}
+
+			continue
+		}
+
+		buf = append(buf, line)
+		text := strings.Join(buf, "\n")
+		if Depth(text) > 0 {
+			continue
+		}
+
+		buf = nil
+		if err := r.Exec(text); err != nil {
+			fmt.Fprintln(r.out, err)
+		}
+	}
+}
+
+// open reads the history and opens the file to append the input.
+func (r *REPL) open() (*os.File, error) {
+	if r.history == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(r.history)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+
+	if len(b) > 0 {
+		r.lines = strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	}
+
+	f, err := os.OpenFile(r.history, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open history: %w", err)
+	}
+
+	return f, nil
+}
+
+// Depth returns the number of the braces opened and not closed in the text.
+// The braces in the comments and the strings are ignored.
+func Depth(text string) int {
+	var depth int
+	for _, t := range xparser.Lex(text) {
+		switch t.GetText() {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+
+	return depth
+}
+
+// Exec runs the statements in the session.
+// The statements are kept for the save and the undo if they are executed without error.
+// Otherwise, the session is restored to the state before them.
+func (r *REPL) Exec(text string) error {
+	program, err := xparser.Parse(text)
+	if err != nil {
+		return err
+	}
+
+	u := undo{snapshot: r.session.Snapshot(), entries: len(r.entries)}
+	if err := r.v.Run(program); err != nil {
+		r.Restore(u)
+		return err
+	}
+
+	r.undo = append(r.undo, u)
+	if len(r.undo) > r.maxUndo {
+		r.undo = slices.Delete(r.undo, 0, len(r.undo)-r.maxUndo)
+	}
+
+	if stmts := Statements(program, text); stmts != "" {
+		r.entries = append(r.entries, stmts)
+	}
+
+	return nil
+}
+
+// Statements returns the text of the program without the version statement.
+func Statements(program parser.IProgramContext, text string) string {
+	if program.Version() == nil {
+		return strings.TrimSpace(text)
+	}
+
+	runes := []rune(text)
+	stop := program.Version().GetStop().GetStop() + 1
+	return strings.TrimSpace(string(runes[min(stop, len(runes)):]))
+}
+
+// Text returns the statements of the session as a program.
+func (r *REPL) Text() string {
+	return strings.Join(append([]string{Version}, r.entries...), "\n") + "\n"
+}
+
+// Command runs the command starting with a colon.
+func (r *REPL) Command(text string) error {
+	fields := strings.Fields(text)
+	switch cmd, args := fields[0], fields[1:]; cmd {
+	case ":exit", ":quit", ":q":
+		return ErrQuit
+	case ":reset", ":r":
+		r.Reset()
+	case ":print", ":p":
+		r.Print()
+	case ":load":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: :load file")
+		}
+
+		b, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("read file: %w", err)
+		}
+
+		return r.Exec(string(b))
+	case ":save":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: :save file")
+		}
+
+		if err := os.WriteFile(args[0], []byte(r.Text()), 0o644); err != nil {
+			return fmt.Errorf("write file: %w", err)
+		}
+	case ":svg":
+		diagram, err := svg.SVG(r.Text(), r.config)
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			fmt.Fprintln(r.out, diagram)
+			return nil
+		}
+
+		if err := os.WriteFile(args[0], []byte(diagram+"\n"), 0o644); err != nil {
+			return fmt.Errorf("write file: %w", err)
+		}
+	case ":gates":
+		for _, name := range slices.Sorted(maps.Keys(r.session.Env.Gate)) {
+			fmt.Fprintln(r.out, r.session.Env.Gate[name])
+		}
+	case ":undo", ":u":
+		return r.Undo()
+	case ":measure", ":m":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: :measure reg")
+		}
+
+		return r.Measure(args[0])
+	case ":top":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: :top N")
+		}
+
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid number %q", args[0])
+		}
+
+		r.top = n
+	case ":history":
+		for i, line := range r.lines {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, line)
+		}
+	case ":help", ":h":
+		fmt.Fprintln(r.out, Help)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+
+	return nil
+}
+
+// Help is the usage of the commands.
+const Help = `:print (:p)        print the state and the environment
+:measure (:m) reg  measure the qubit register and print the outcome
+:top N             print the N states of the highest probability (-1 is all)
+:gates             print the signatures of the gates
+:undo (:u)         undo the last input
+:load file         run the statements of the file
+:save file         write the statements of the session to the file
+:svg [file]        render the circuit of the session as an SVG
+:history           print the history of the input
+:reset (:r)        start a new session
+:quit (:q)         quit the REPL`
+
+// Undo restores the session to the state before the last input.
+func (r *REPL) Undo() error {
+	if len(r.undo) == 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+
+	r.Restore(r.undo[len(r.undo)-1])
+	r.undo = r.undo[:len(r.undo)-1]
+	return nil
+}
+
+// Measure measures the qubit register in the session and prints the outcome.
+func (r *REPL) Measure(name string) error {
+	if _, ok := r.session.Env.GetQubit(name); !ok {
+		return fmt.Errorf("qubit %q not found", name)
+	}
+
+	r.rec.last = nil
+	if err := r.Exec(fmt.Sprintf("measure %s;", name)); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	for _, v := range r.rec.last {
+		if v {
+			b.WriteByte('1')
+			continue
+		}
+
+		b.WriteByte('0')
+	}
+
+	fmt.Fprintf(r.out, "%s: %s\n", name, b.String())
+	return nil
+}
+
+// Print prints the states of the top and the environment.
+func (r *REPL) Print() {
+	fmt.Fprintln(r.out, "--- STATE ---")
+	states := r.session.Q.Qubit().State(r.session.Env.Index()...)
+	for _, s := range q.Top(states, r.top) {
+		fmt.Fprintln(r.out, s)
+	}
+
+	fmt.Fprintln(r.out, "--- ENVIRONMENT ---")
+	fmt.Fprintf(r.out, "%-10s: %v\n", "const", r.session.Env.Const)
+	fmt.Fprintf(r.out, "%-10s: %v\n", "variable", r.session.Env.Variable)
+	fmt.Fprintf(r.out, "%-10s: %v\n", "bit", r.session.Env.Bit)
+	fmt.Fprintf(r.out, "%-10s: %v\n", "bit[]", r.session.Env.BitArray)
+	fmt.Fprintf(r.out, "%-10s: %v\n", "qubit", r.session.Env.Qubit)
+	fmt.Fprintf(r.out, "%-10s: %v\n", "gate", slices.Sorted(maps.Keys(r.session.Env.Gate)))
+	fmt.Fprintf(r.out, "%-10s: %v\n", "subroutine", slices.Sorted(maps.Keys(r.session.Env.Subroutine)))
+}
@@ -0,0 +1,206 @@
+package repl_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itsubaki/qasm/repl"
+)
+
+func input(lines ...string) <-chan string {
+	in := make(chan string, len(lines))
+	for _, l := range lines {
+		in <- l
+	}
+
+	close(in)
+	return in
+}
+
+func ExampleREPL() {
+	r := repl.New(input(
+		"qubit[2] q;",
+		"gate bell a, b {",
+		"  U(pi/2.0, 0, pi) a;",
+		"  ctrl @ U(pi, 0, pi) a, b;",
+		"}",
+		"bell q[0], q[1];",
+		":gates",
+		":top 1",
+		":print",
+		":undo",
+		":print",
+	), os.Stdout)
+
+	if err := r.Run(); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// qasm> OPENQASM 3.0;
+	// qasm> qasm> ....> ....> ....> qasm> qasm> gate bell a, b
+	// qasm> qasm> --- STATE ---
+	// [00][  0]( 0.7071 0.0000i): 0.5000
+	// --- ENVIRONMENT ---
+	// const     : map[]
+	// variable  : map[]
+	// bit       : map[]
+	// bit[]     : map[]
+	// qubit     : map[q:[0 1]]
+	// gate      : [bell]
+	// subroutine: []
+	// qasm> qasm> --- STATE ---
+	// [00][  0]( 1.0000 0.0000i): 1.0000
+	// --- ENVIRONMENT ---
+	// const     : map[]
+	// variable  : map[]
+	// bit       : map[]
+	// bit[]     : map[]
+	// qubit     : map[q:[0 1]]
+	// gate      : [bell]
+	// subroutine: []
+	// qasm>
+}
+
+func ExampleREPL_measure() {
+	r := repl.New(input(
+		"qubit[2] q;",
+		"U(pi, 0, pi) q[1];",
+		":measure q",
+		":measure c",
+		":q",
+	), os.Stdout)
+
+	if err := r.Run(); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// qasm> OPENQASM 3.0;
+	// qasm> qasm> qasm> q: 01
+	// qasm> qubit "c" not found
+	// qasm>
+}
+
+func ExampleDepth() {
+	fmt.Println(repl.Depth("gate x q {"))
+	fmt.Println(repl.Depth("gate x q { U(pi, 0, pi) q; }"))
+	fmt.Println(repl.Depth("// {"))
+	fmt.Println(repl.Depth("}"))
+
+	// Output:
+	// 1
+	// 0
+	// 0
+	// -1
+}
+
+func TestREPL_save(t *testing.T) {
+	dir := t.TempDir()
+	saved := filepath.Join(dir, "saved.qasm")
+	loaded := filepath.Join(dir, "loaded.qasm")
+	if err := os.WriteFile(loaded, []byte("OPENQASM 3.0;\nint n = 2;\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	var out bytes.Buffer
+	r := repl.New(input(
+		"OPENQASM 3.0;",
+		"qubit q;",
+		":load "+loaded,
+		"n = n +",
+		"undefined;",
+		"def f(int a) -> int {",
+		"  return a * 2;",
+		"}",
+		":save "+saved,
+	), &out)
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	got, err := os.ReadFile(saved)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+
+	want := "OPENQASM 3.0;\nqubit q;\nint n = 2;\ndef f(int a) -> int {\n  return a * 2;\n}\n"
+	if string(got) != want {
+		t.Errorf("got=%q, want=%q", got, want)
+	}
+}
+
+func TestREPL_history(t *testing.T) {
+	history := filepath.Join(t.TempDir(), "history")
+
+	for _, lines := range [][]string{
+		{"qubit q;", ":undo"},
+		{":history"},
+	} {
+		var out bytes.Buffer
+		if err := repl.New(input(lines...), &out, repl.WithHistory(history)).Run(); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+
+		if lines[0] != ":history" {
+			continue
+		}
+
+		want := "   1  qubit q;\n   2  :undo\n   3  :history\n"
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("got=%q, want=%q", out.String(), want)
+		}
+	}
+}
+
+func TestREPL_Undo(t *testing.T) {
+	r := repl.New(input(), &bytes.Buffer{}, repl.WithMaxUndo(2))
+	for _, text := range []string{"int n = 0;", "n = 1;", "n = 2;", "n = 3;"} {
+		if err := r.Exec(text); err != nil {
+			t.Fatalf("exec: %v", err)
+		}
+	}
+
+	for range 2 {
+		if err := r.Undo(); err != nil {
+			t.Fatalf("undo: %v", err)
+		}
+	}
+
+	if err := r.Undo(); err == nil || err.Error() != "nothing to undo" {
+		t.Errorf("got=%v, want=nothing to undo", err)
+	}
+
+	want := "OPENQASM 3.0;\nint n = 0;\nn = 1;\n"
+	if got := r.Text(); got != want {
+		t.Errorf("got=%q, want=%q", got, want)
+	}
+}
+
+func TestREPL_Command(t *testing.T) {
+	cases := []struct {
+		command string
+		want    string
+	}{
+		{":undo", "nothing to undo"},
+		{":top", "usage: :top N"},
+		{":top x", `invalid number "x"`},
+		{":load", "usage: :load file"},
+		{":load not_found.qasm", "read file: open not_found.qasm: no such file or directory"},
+		{":save", "usage: :save file"},
+		{":measure", "usage: :measure reg"},
+		{":foo", `unknown command ":foo"`},
+	}
+
+	for _, c := range cases {
+		err := repl.New(input(), &bytes.Buffer{}).Command(c.command)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: got=%v, want=%v", c.command, err, c.want)
+		}
+	}
+}
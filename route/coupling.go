@@ -0,0 +1,213 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Qubit is a physical qubit such as 0 or "$0".
+type Qubit int
+
+// UnmarshalJSON accepts a number or a string such as "$0".
+func (q *Qubit) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	n, err := strconv.Atoi(strings.TrimPrefix(s, "$"))
+	if err != nil {
+		return fmt.Errorf("invalid physical qubit %s", b)
+	}
+
+	*q = Qubit(n)
+	return nil
+}
+
+// Edge is a pair of the adjacent physical qubits.
+type Edge [2]Qubit
+
+// UnmarshalJSON accepts a pair of the physical qubits.
+func (e *Edge) UnmarshalJSON(b []byte) error {
+	var pair []Qubit
+	if err := json.Unmarshal(b, &pair); err != nil {
+		return err
+	}
+
+	if len(pair) != 2 {
+		return fmt.Errorf("invalid edge %s", b)
+	}
+
+	*e = Edge{pair[0], pair[1]}
+	return nil
+}
+
+// CouplingMap is the undirected connectivity of the physical qubits.
+type CouplingMap struct {
+	Qubits int    `json:"qubits"`
+	Edges  []Edge `json:"edges"`
+}
+
+// Load returns the coupling map of the JSON or YAML file.
+func Load(path string) (*CouplingMap, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseYAML(b)
+	default:
+		return ParseJSON(b)
+	}
+}
+
+// ParseJSON returns the coupling map of the JSON.
+// e.g. {"qubits": 3, "edges": [[0, 1], [1, 2]]}
+func ParseJSON(b []byte) (*CouplingMap, error) {
+	var c CouplingMap
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("unmarshal coupling map: %w", err)
+	}
+
+	return c.validate()
+}
+
+// ParseYAML returns the coupling map of the YAML.
+// Only the keys qubits and edges are supported, and each edge is a flow sequence.
+//
+//	qubits: 3
+//	edges:
+//	  - [$0, $1]
+//	  - [$1, $2]
+func ParseYAML(b []byte) (*CouplingMap, error) {
+	var c CouplingMap
+	var key string
+	for i, line := range strings.Split(string(b), "\n") {
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || line == "---" {
+			continue
+		}
+
+		if item, ok := strings.CutPrefix(line, "-"); ok {
+			if key != "edges" {
+				return nil, fmt.Errorf("line %d: unexpected sequence item", i+1)
+			}
+
+			var edge Edge
+			if err := json.Unmarshal(flow(item), &edge); err != nil {
+				return nil, fmt.Errorf("line %d: invalid edge %q", i+1, strings.TrimSpace(item))
+			}
+
+			c.Edges = append(c.Edges, edge)
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: invalid line %q", i+1, line)
+		}
+
+		key, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		switch key {
+		case "qubits":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid qubits %q", i+1, v)
+			}
+
+			c.Qubits = n
+		case "edges":
+			if v == "" {
+				continue
+			}
+
+			if err := json.Unmarshal(flow(v), &c.Edges); err != nil {
+				return nil, fmt.Errorf("line %d: invalid edges %q", i+1, v)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q", i+1, key)
+		}
+	}
+
+	return c.validate()
+}
+
+// Neighbors returns the physical qubits adjacent to the qubit.
+func (c *CouplingMap) Neighbors(qubit int) []int {
+	var list []int
+	for _, e := range c.Edges {
+		switch qubit {
+		case int(e[0]):
+			list = append(list, int(e[1]))
+		case int(e[1]):
+			list = append(list, int(e[0]))
+		}
+	}
+
+	return list
+}
+
+// Distance returns the shortest path lengths between the physical qubits.
+// Unreachable pairs have math.MaxInt32.
+func (c *CouplingMap) Distance() [][]int {
+	d := make([][]int, c.Qubits)
+	for i := range d {
+		d[i] = make([]int, c.Qubits)
+		for j := range d[i] {
+			if i != j {
+				d[i][j] = math.MaxInt32
+			}
+		}
+	}
+
+	for _, e := range c.Edges {
+		d[e[0]][e[1]], d[e[1]][e[0]] = 1, 1
+	}
+
+	// Floyd-Warshall
+	for k := range c.Qubits {
+		for i := range c.Qubits {
+			for j := range c.Qubits {
+				if d[i][k]+d[k][j] < d[i][j] {
+					d[i][j] = d[i][k] + d[k][j]
+				}
+			}
+		}
+	}
+
+	return d
+}
+
+func (c *CouplingMap) validate() (*CouplingMap, error) {
+	var n int
+	for _, e := range c.Edges {
+		if e[0] < 0 || e[1] < 0 || e[0] == e[1] {
+			return nil, fmt.Errorf("invalid edge [$%d, $%d]", e[0], e[1])
+		}
+
+		n = max(n, int(e[0])+1, int(e[1])+1)
+	}
+
+	if c.Qubits == 0 {
+		c.Qubits = n
+	}
+
+	if n > c.Qubits {
+		return nil, fmt.Errorf("edge on $%d exceeds %d qubits", n-1, c.Qubits)
+	}
+
+	return c, nil
+}
+
+// flow returns the JSON of the YAML flow sequence.
+func flow(s string) []byte {
+	s = strings.NewReplacer(`"`, "", "'", "", "$", "").Replace(strings.TrimSpace(s))
+	return []byte(s)
+}
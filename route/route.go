@@ -0,0 +1,388 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/itsubaki/qasm/flatten"
+)
+
+const Swap = "swap"
+
+// SwapDefinition is the definition of the swap gate inserted by the router.
+const SwapDefinition = "gate swap a, b { ctrl @ U(pi, 0, pi) a, b; ctrl @ U(pi, 0, pi) b, a; ctrl @ U(pi, 0, pi) a, b; }"
+
+var ErrUnroutable = errors.New("unroutable")
+
+// Router maps the logical qubits onto the physical qubits of the coupling map.
+type Router struct {
+	coupling   *CouplingMap
+	dist       [][]int
+	trivial    bool
+	iterations int
+	extended   int
+	weight     float64
+	decay      float64
+}
+
+// Option is a function that modifies the Router.
+type Option func(*Router)
+
+// WithTrivialLayout maps the i-th logical qubit onto the physical qubit $i.
+func WithTrivialLayout() Option {
+	return func(r *Router) {
+		r.trivial = true
+	}
+}
+
+// WithIterations sets the number of forward and backward passes to choose the initial layout.
+func WithIterations(n int) Option {
+	return func(r *Router) {
+		r.iterations = n
+	}
+}
+
+// Result is the routed program and the layouts.
+// Initial[i] and Final[i] are the physical qubits of the i-th logical qubit
+// at the beginning and the end of the program.
+type Result struct {
+	Program *flatten.Program
+	Logical []string
+	Initial []int
+	Final   []int
+}
+
+// String returns the program as OpenQASM 3 followed by the layouts as comments.
+func (r *Result) String() string {
+	return r.Program.String() + r.Layout()
+}
+
+// Layout returns the initial and final layouts as comments.
+func (r *Result) Layout() string {
+	layout := func(list []int) string {
+		pairs := make([]string, len(list))
+		for i, p := range list {
+			pairs[i] = fmt.Sprintf("%s -> $%d", r.Logical[i], p)
+		}
+
+		return strings.Join(pairs, ", ")
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("// initial layout: %s\n", layout(r.Initial)))
+	b.WriteString(fmt.Sprintf("// final layout: %s\n", layout(r.Final)))
+	return b.String()
+}
+
+// New returns a new Router with the SABRE heuristic.
+// See https://arxiv.org/abs/1809.02573.
+func New(c *CouplingMap, opts ...Option) *Router {
+	r := &Router{
+		coupling:   c,
+		dist:       c.Distance(),
+		iterations: 1,
+		extended:   20,
+		weight:     0.5,
+		decay:      0.001,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Route returns the program routed onto the coupling map.
+func Route(p *flatten.Program, c *CouplingMap, opts ...Option) (*Result, error) {
+	return New(c, opts...).Route(p)
+}
+
+// Route returns the program routed onto the coupling map.
+// Every two-qubit op of the result acts on adjacent physical qubits.
+func (r *Router) Route(p *flatten.Program) (*Result, error) {
+	n := p.NumQubits()
+	for _, op := range p.Ops {
+		if op.Name == flatten.Barrier {
+			continue
+		}
+
+		if len(op.Qubits()) > 2 {
+			return nil, fmt.Errorf("%q on %d qubits, decompose it with a basis first: %w", p.Statement(op), len(op.Qubits()), ErrUnroutable)
+		}
+
+		for _, q := range op.Qubits() {
+			n = max(n, q+1)
+		}
+	}
+
+	if n > r.coupling.Qubits {
+		return nil, fmt.Errorf("%d qubits exceed %d physical qubits: %w", n, r.coupling.Qubits, ErrUnroutable)
+	}
+
+	layout := make([]int, n)
+	for i := range layout {
+		layout[i] = i
+	}
+
+	if !r.trivial {
+		// bidirectional passes over the gates to choose the initial layout.
+		var gates []flatten.Op
+		for _, op := range p.Ops {
+			if op.IsGate() {
+				gates = append(gates, op)
+			}
+		}
+
+		reversed := slices.Clone(gates)
+		slices.Reverse(reversed)
+
+		for range r.iterations {
+			_, forward, err := r.sabre(gates, layout)
+			if err != nil {
+				return nil, err
+			}
+
+			_, backward, err := r.sabre(reversed, forward)
+			if err != nil {
+				return nil, err
+			}
+
+			layout = backward
+		}
+	}
+
+	ops, final, err := r.sabre(p.Ops, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &flatten.Program{
+		Bits:  p.Bits,
+		Gates: p.Gates,
+		Ops:   ops,
+	}
+
+	if slices.ContainsFunc(ops, func(op flatten.Op) bool { return op.Name == Swap }) {
+		out.Gates = append(slices.Clone(p.Gates), SwapDefinition)
+	}
+
+	logical := make([]string, n)
+	for i := range logical {
+		logical[i] = p.QubitName(i)
+	}
+
+	return &Result{
+		Program: out,
+		Logical: logical,
+		Initial: layout,
+		Final:   final,
+	}, nil
+}
+
+// sabre returns the routed ops and the final layout.
+func (r *Router) sabre(ops []flatten.Op, initial []int) ([]flatten.Op, []int, error) {
+	layout := slices.Clone(initial)
+
+	// dependencies. measurements and conditional ops are ordered on the classical wire.
+	const classical = -1
+	succ, indeg := make([][]int, len(ops)), make([]int, len(ops))
+	last := make(map[int]int)
+	for i, op := range ops {
+		wires := op.Qubits()
+		if op.Name == flatten.Measure || op.Cond != "" {
+			wires = append(wires, classical)
+		}
+
+		for _, w := range wires {
+			if j, ok := last[w]; ok && !slices.Contains(succ[j], i) {
+				succ[j] = append(succ[j], i)
+				indeg[i]++
+			}
+
+			last[w] = i
+		}
+	}
+
+	var front []int
+	for i := range ops {
+		if indeg[i] == 0 {
+			front = append(front, i)
+		}
+	}
+
+	decay := make([]float64, r.coupling.Qubits)
+	reset := func() {
+		for i := range decay {
+			decay[i] = 1
+		}
+	}
+	reset()
+
+	var out []flatten.Op
+	var stuck int
+	for len(front) > 0 {
+		var next []int
+		var executed bool
+		for _, i := range front {
+			if !r.executable(ops[i], layout) {
+				next = append(next, i)
+				continue
+			}
+
+			out = append(out, mapped(ops[i], layout))
+			executed = true
+			for _, s := range succ[i] {
+				if indeg[s]--; indeg[s] == 0 {
+					next = append(next, s)
+				}
+			}
+		}
+
+		slices.Sort(next)
+		front = next
+		if executed {
+			reset()
+			stuck = 0
+			continue
+		}
+
+		a, b, err := r.choose(ops, front, succ, indeg, layout, decay, stuck > 2*r.coupling.Qubits)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		out = append(out, flatten.Op{Name: Swap, Target: []int{a, b}})
+		swap(layout, a, b)
+		decay[a] += r.decay
+		decay[b] += r.decay
+		stuck++
+	}
+
+	return out, layout, nil
+}
+
+// choose returns the swap that minimizes the heuristic cost.
+// If the search is stuck, it returns the swap along the shortest path of the first gate.
+func (r *Router) choose(ops []flatten.Op, front []int, succ [][]int, indeg []int, layout []int, decay []float64, stuck bool) (int, int, error) {
+	for _, i := range front {
+		q := ops[i].Qubits()
+		if r.dist[layout[q[0]]][layout[q[1]]] >= math.MaxInt32 {
+			return 0, 0, fmt.Errorf("$%d and $%d are not connected: %w", layout[q[0]], layout[q[1]], ErrUnroutable)
+		}
+	}
+
+	if stuck {
+		q := ops[front[0]].Qubits()
+		a, b := layout[q[0]], layout[q[1]]
+		for _, n := range r.coupling.Neighbors(a) {
+			if r.dist[n][b] < r.dist[a][b] {
+				return min(a, n), max(a, n), nil
+			}
+		}
+	}
+
+	// extended set of the upcoming two-qubit gates.
+	var extended []int
+	remain := slices.Clone(indeg)
+	queue := slices.Clone(front)
+	for len(queue) > 0 && len(extended) < r.extended {
+		i := queue[0]
+		queue = queue[1:]
+		for _, s := range succ[i] {
+			if remain[s]--; remain[s] > 0 {
+				continue
+			}
+
+			queue = append(queue, s)
+			if len(ops[s].Qubits()) == 2 && ops[s].Name != flatten.Barrier {
+				extended = append(extended, s)
+			}
+		}
+	}
+
+	cost := func(set []int, layout []int) float64 {
+		if len(set) == 0 {
+			return 0
+		}
+
+		var sum int
+		for _, i := range set {
+			q := ops[i].Qubits()
+			sum += r.dist[layout[q[0]]][layout[q[1]]]
+		}
+
+		return float64(sum) / float64(len(set))
+	}
+
+	var candidates [][2]int
+	for _, i := range front {
+		for _, q := range ops[i].Qubits() {
+			for _, n := range r.coupling.Neighbors(layout[q]) {
+				c := [2]int{min(layout[q], n), max(layout[q], n)}
+				if !slices.Contains(candidates, c) {
+					candidates = append(candidates, c)
+				}
+			}
+		}
+	}
+
+	best, score := candidates[0], math.Inf(1)
+	for _, c := range candidates {
+		trial := slices.Clone(layout)
+		swap(trial, c[0], c[1])
+
+		h := cost(front, trial) + r.weight*cost(extended, trial)
+		h *= max(decay[c[0]], decay[c[1]])
+		if h < score {
+			best, score = c, h
+		}
+	}
+
+	return best[0], best[1], nil
+}
+
+// executable returns true if the op acts on adjacent physical qubits.
+func (r *Router) executable(op flatten.Op, layout []int) bool {
+	q := op.Qubits()
+	if op.Name == flatten.Barrier || len(q) < 2 {
+		return true
+	}
+
+	return r.dist[layout[q[0]]][layout[q[1]]] == 1
+}
+
+// mapped returns the op on the physical qubits.
+func mapped(op flatten.Op, layout []int) flatten.Op {
+	physical := func(list []int) []int {
+		if list == nil {
+			return nil
+		}
+
+		out := make([]int, len(list))
+		for i, q := range list {
+			out[i] = layout[q]
+		}
+
+		return out
+	}
+
+	op.Control = physical(op.Control)
+	op.Target = physical(op.Target)
+	return op
+}
+
+// swap exchanges the logical qubits on the physical qubits a and b.
+func swap(layout []int, a, b int) {
+	for i, p := range layout {
+		switch p {
+		case a:
+			layout[i] = b
+		case b:
+			layout[i] = a
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package route_test
+
+import (
+	"errors"
+	"fmt"
+	"math/cmplx"
+	"os"
+	"testing"
+
+	"github.com/itsubaki/q/math/epsilon"
+	"github.com/itsubaki/qasm/flatten"
+	"github.com/itsubaki/qasm/route"
+	"github.com/itsubaki/qasm/transpile"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+func ExampleLoad() {
+	c, err := route.Load("../testdata/coupling_grid.yaml")
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(c.Qubits, c.Edges)
+	fmt.Println(c.Neighbors(1))
+
+	// Output:
+	// 6 [[0 1] [1 2] [3 4] [4 5] [0 3] [1 4] [2 5]]
+	// [0 2 4]
+}
+
+func ExampleRoute() {
+	p, err := flatten.Flatten(`
+	qubit[3] q;
+	U(pi/2.0, 0, pi) q[0];
+	ctrl @ U(pi, 0, pi) q[0], q[2];
+	ctrl @ U(pi, 0, pi) q[1], q[2];
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	c, err := route.ParseJSON([]byte(`{"edges": [["$0", "$1"], ["$1", "$2"]]}`))
+	if err != nil {
+		panic(err)
+	}
+
+	r, err := route.Route(p, c, route.WithTrivialLayout())
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(r)
+
+	// Output:
+	// OPENQASM 3.0;
+	// gate swap a, b { ctrl @ U(pi, 0, pi) a, b; ctrl @ U(pi, 0, pi) b, a; ctrl @ U(pi, 0, pi) a, b; }
+	// U(1.5707963267948966, 0, 3.141592653589793) $0;
+	// swap $1, $2;
+	// ctrl @ U(3.141592653589793, 0, 3.141592653589793) $0, $1;
+	// ctrl @ U(3.141592653589793, 0, 3.141592653589793) $2, $1;
+	// // initial layout: q[0] -> $0, q[1] -> $1, q[2] -> $2
+	// // final layout: q[0] -> $0, q[1] -> $2, q[2] -> $1
+}
+
+func TestRoute(t *testing.T) {
+	line, err := route.Load("../testdata/coupling_line.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grid, err := route.Load("../testdata/coupling_grid.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ring, err := route.ParseYAML([]byte(`
+	qubits: 12
+	edges: [[0, 1], [1, 2], [2, 3], [3, 4], [4, 5], [5, 6], [6, 7], [7, 8], [8, 9], [9, 10], [10, 11], [11, 0]]
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		coupling *route.CouplingMap
+		text     string
+	}{
+		{line, "../testdata/qft.qasm"},
+		{grid, "../testdata/qft.qasm"},
+		{ring, "../testdata/grover.qasm"},
+		{ring, "../testdata/quantum_counting.qasm"},
+		{
+			line,
+			`
+			qubit[5] q;
+			U(0.1, 0.2, 0.3) q;
+			ctrl @ U(pi, 0, pi) q[0], q[4];
+			ctrl @ U(0.4, 0.5, 0.6) q[3], q[1];
+			ctrl @ U(pi, 0, pi) q[2], q[0];
+			ctrl @ U(0.7, 0.8, 0.9) q[4], q[1];
+			U(0.3, 0.2, 0.1) q[4];
+			ctrl @ U(pi, 0, pi) q[1], q[3];
+			`,
+		},
+		{
+			grid,
+			`
+			qubit[6] q;
+			U(0.1, 0.2, 0.3) q;
+			ctrl @ U(pi, 0, pi) q[0], q[5];
+			ctrl @ U(0.4, 0.5, 0.6) q[2], q[3];
+			barrier q;
+			ctrl @ U(pi, 0, pi) q[5], q[0];
+			`,
+		},
+	}
+
+	for _, c := range cases {
+		text := c.text
+		if b, err := os.ReadFile(c.text); err == nil {
+			text = string(b)
+		}
+
+		p, err := flatten.Flatten(text)
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		// multi-controlled gates are decomposed first.
+		p, err = transpile.Transpile(p, []string{"u", "cx"})
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		want, _, err := visitor.Run(p.String())
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		dist := c.coupling.Distance()
+		for _, opts := range [][]route.Option{{route.WithTrivialLayout()}, nil, {route.WithIterations(3)}} {
+			r, err := route.Route(p, c.coupling, opts...)
+			if err != nil {
+				t.Fatalf("%s: %v", c.text, err)
+			}
+
+			for _, op := range r.Program.Ops {
+				q := op.Qubits()
+				if op.Name == flatten.Barrier || len(q) < 2 {
+					continue
+				}
+
+				if dist[q[0]][q[1]] != 1 {
+					t.Errorf("%s: %s is not adjacent", c.text, r.Program.Statement(op))
+				}
+			}
+
+			// simulate with a register of the physical qubits.
+			sim := *r.Program
+			sim.Qubits = []flatten.Register{{Name: "p", Size: c.coupling.Qubits}}
+			got, _, err := visitor.Run(sim.String())
+			if err != nil {
+				t.Fatalf("%s: %v", sim.String(), err)
+			}
+
+			n, m := len(r.Final), c.coupling.Qubits
+
+			var inner complex128
+			for i, a := range want.Amplitude() {
+				var j int
+				for k := range n {
+					if i&(1<<(n-1-k)) != 0 {
+						j |= 1 << (m - 1 - r.Final[k])
+					}
+				}
+
+				inner += cmplx.Conj(a) * got.Amplitude()[j]
+			}
+
+			if !epsilon.IsZeroF64(cmplx.Abs(inner)-1, 1e-8) {
+				t.Errorf("%s: |<want|got>|=%v", c.text, cmplx.Abs(inner))
+			}
+		}
+	}
+}
+
+func TestRoute_error(t *testing.T) {
+	line, err := route.Load("../testdata/coupling_line.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	split, err := route.ParseJSON([]byte(`{"edges": [[0, 1], [2, 3]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		coupling *route.CouplingMap
+		text     string
+	}{
+		{line, `qubit[6] q;`},
+		{line, `qubit[3] q; ctrl(2) @ U(pi, 0, pi) q[0], q[1], q[2];`},
+		{split, `qubit[3] q; ctrl @ U(pi, 0, pi) q[0], q[2];`},
+	}
+
+	for _, c := range cases {
+		p, err := flatten.Flatten(c.text)
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		if _, err := route.Route(p, c.coupling, route.WithTrivialLayout()); !errors.Is(err, route.ErrUnroutable) {
+			t.Errorf("%s: got=%v, want=%v", c.text, err, route.ErrUnroutable)
+		}
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	cases := []struct {
+		in     string
+		qubits int
+		edges  int
+		errMsg string
+	}{
+		{"edges:\n  - [0, 1]\n  - ['$1', \"$2\"] # comment\n", 3, 2, ""},
+		{"---\nqubits: 4\nedges: [[0, 1]]\n", 4, 1, ""},
+		{"qubits: 1\nedges: [[0, 1]]\n", 0, 0, "edge on $1 exceeds 1 qubits"},
+		{"qubits: x\n", 0, 0, `line 1: invalid qubits "x"`},
+		{"foo: 1\n", 0, 0, `line 1: unknown key "foo"`},
+		{"- [0, 1]\n", 0, 0, "line 1: unexpected sequence item"},
+		{"edges:\n  - [0, 1, 2]\n", 0, 0, `line 2: invalid edge "[0, 1, 2]"`},
+		{"edges:\n  - [1, 1]\n", 0, 0, "invalid edge [$1, $1]"},
+		{"edges\n", 0, 0, `line 1: invalid line "edges"`},
+	}
+
+	for _, c := range cases {
+		got, err := route.ParseYAML([]byte(c.in))
+		if err != nil {
+			if err.Error() != c.errMsg {
+				t.Errorf("got=%v, want=%v", err, c.errMsg)
+			}
+
+			continue
+		}
+
+		if c.errMsg != "" {
+			t.Errorf("%q: expected error", c.in)
+			continue
+		}
+
+		if got.Qubits != c.qubits || len(got.Edges) != c.edges {
+			t.Errorf("got=%v", got)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/antlr4-go/antlr/v4"
+	"github.com/itsubaki/q"
+	"github.com/itsubaki/qasm/environ"
+	"github.com/itsubaki/qasm/formatter"
+	"github.com/itsubaki/qasm/gen/parser"
+	"github.com/itsubaki/qasm/listener"
+	xparser "github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/svg"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+// MaxBytes is the maximum size of the request body.
+const MaxBytes = 1 << 20
+
+// Kinds of the errors.
+const (
+	KindRequest = "request"
+	KindSyntax  = "syntax"
+	KindRuntime = "runtime"
+	KindTimeout = "timeout"
+	KindBusy    = "busy"
+)
+
+// Server serves the JSON endpoints of the run, validate, svg, format, lex and parse.
+// Each request of the run is executed in its own simulator and environment.
+type Server struct {
+	mux       *http.ServeMux
+	sem       chan struct{}
+	maxQubits int
+	timeout   time.Duration
+	config    svg.Config
+}
+
+// Option is a function that modifies the Server.
+type Option func(*Server)
+
+// WithMaxQubits sets the maximum number of qubits of each run.
+func WithMaxQubits(n int) Option {
+	return func(s *Server) {
+		s.maxQubits = n
+	}
+}
+
+// WithTimeout sets the timeout of each request including the wait for the concurrency limit.
+func WithTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.timeout = d
+	}
+}
+
+// WithConcurrency sets the maximum number of the requests processed at the same time.
+// If n is not positive, the default of the number of CPUs is used.
+func WithConcurrency(n int) Option {
+	return func(s *Server) {
+		if n <= 0 {
+			return
+		}
+
+		s.sem = make(chan struct{}, n)
+	}
+}
+
+// WithConfig sets the config of the SVG.
+func WithConfig(config svg.Config) Option {
+	return func(s *Server) {
+		s.config = config
+	}
+}
+
+// New returns a new server.
+func New(opt ...Option) *Server {
+	s := &Server{
+		mux:     http.NewServeMux(),
+		sem:     make(chan struct{}, runtime.NumCPU()),
+		timeout: 10 * time.Second,
+		config:  svg.DefaultConfig,
+	}
+
+	for _, f := range opt {
+		f(s)
+	}
+
+	s.mux.HandleFunc("POST /run", s.handle(s.Run))
+	s.mux.HandleFunc("POST /validate", s.handle(s.Validate))
+	s.mux.HandleFunc("POST /svg", s.handle(s.SVG))
+	s.mux.HandleFunc("POST /format", s.handle(s.Format))
+	s.mux.HandleFunc("POST /lex", s.handle(s.Lex))
+	s.mux.HandleFunc("POST /parse", s.handle(s.Parse))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Request is the body of the requests.
+// Top is the number of the states of the run in the order of the probability (-1 is all).
+type Request struct {
+	Text string `json:"text"`
+	Top  *int   `json:"top,omitempty"`
+}
+
+// Error is the body of the responses of the errors.
+// Line and Column are the position of the syntax error.
+type Error struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// RunResponse is the state and the bits after the run.
+// Registers are the qubit registers in the order of env.Index().
+type RunResponse struct {
+	Registers []string          `json:"registers"`
+	States    []State           `json:"states"`
+	Bits      map[string]string `json:"bits"`
+}
+
+// State is the amplitude of the basis state.
+// Basis is the binary string of each register.
+type State struct {
+	Basis       []string `json:"basis"`
+	Real        float64  `json:"real"`
+	Imag        float64  `json:"imag"`
+	Probability float64  `json:"probability"`
+}
+
+// Token is the token of the lexer.
+type Token struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// Run runs the program in a new simulator and environment.
+func (s *Server) Run(ctx context.Context, req *Request) (any, error) {
+	program, err := xparser.Parse(req.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	qsim := q.New()
+	env := environ.New()
+	v := visitor.New(qsim, env,
+		visitor.WithContext(ctx),
+		visitor.WithMaxQubits(s.maxQubits),
+	)
+
+	if err := v.Run(program); err != nil {
+		return nil, err
+	}
+
+	top := -1
+	if req.Top != nil {
+		top = *req.Top
+	}
+
+	res := &RunResponse{
+		Registers: env.QubitOrder,
+		States:    []State{},
+		Bits:      make(map[string]string),
+	}
+
+	if len(env.QubitOrder) > 0 {
+		for _, st := range q.Top(qsim.Qubit().State(env.Index()...), top) {
+			res.States = append(res.States, State{
+				Basis:       st.BinaryString(),
+				Real:        real(st.Amplitude()),
+				Imag:        imag(st.Amplitude()),
+				Probability: st.Probability(),
+			})
+		}
+	}
+
+	for name, bit := range env.Bit {
+		res.Bits[name] = bits(bit)
+	}
+
+	for name, list := range env.BitArray {
+		res.Bits[name] = bits(list...)
+	}
+
+	return res, nil
+}
+
+// Validate parses the program without executing it.
+func (s *Server) Validate(ctx context.Context, req *Request) (any, error) {
+	if _, err := xparser.Parse(req.Text); err != nil {
+		return nil, err
+	}
+
+	return map[string]bool{"valid": true}, nil
+}
+
+// SVG renders the circuit of the program.
+func (s *Server) SVG(ctx context.Context, req *Request) (any, error) {
+	diagram, err := svg.SVG(req.Text, s.config)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"svg": diagram}, nil
+}
+
+// Format formats the program.
+func (s *Server) Format(ctx context.Context, req *Request) (any, error) {
+	text, err := formatter.Format(req.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"text": text}, nil
+}
+
+// Lex lexes the program into the tokens.
+func (s *Server) Lex(ctx context.Context, req *Request) (any, error) {
+	lexer := parser.Newqasm3Lexer(antlr.NewInputStream(""))
+
+	tokens := []Token{}
+	for _, t := range xparser.Lex(req.Text) {
+		var typ string
+		if t.GetTokenType() > 0 && t.GetTokenType() < len(lexer.SymbolicNames) {
+			typ = lexer.SymbolicNames[t.GetTokenType()]
+		}
+
+		tokens = append(tokens, Token{
+			Type:   typ,
+			Text:   t.GetText(),
+			Line:   t.GetLine(),
+			Column: t.GetColumn(),
+		})
+	}
+
+	return map[string][]Token{"tokens": tokens}, nil
+}
+
+// Parse parses the program into the string tree.
+func (s *Server) Parse(ctx context.Context, req *Request) (any, error) {
+	tree, err := xparser.StringTree(req.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"tree": tree}, nil
+}
+
+// handle decodes the request, waits for the concurrency limit and encodes the response or the error.
+func (s *Server) handle(f func(ctx context.Context, req *Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBytes)).Decode(&req); err != nil {
+			write(w, http.StatusBadRequest, &Error{Kind: KindRequest, Message: fmt.Sprintf("decode request: %v", err)})
+			return
+		}
+
+		ctx := r.Context()
+		if s.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.timeout)
+			defer cancel()
+		}
+
+		select {
+		case s.sem <- struct{}{}:
+			defer func() { <-s.sem }()
+		case <-ctx.Done():
+			write(w, http.StatusServiceUnavailable, &Error{Kind: KindBusy, Message: fmt.Sprintf("wait for the concurrency limit: %v", ctx.Err())})
+			return
+		}
+
+		res, err := f(ctx, &req)
+		if err != nil {
+			e := Wrap(err)
+			write(w, Status(e), e)
+			return
+		}
+
+		write(w, http.StatusOK, res)
+	}
+}
+
+// Wrap returns the structured error of the err.
+func Wrap(err error) *Error {
+	var serr *listener.SyntaxError
+	switch {
+	case errors.As(err, &serr):
+		return &Error{Kind: KindSyntax, Message: serr.Message, Line: serr.Line, Column: serr.Column}
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, visitor.ErrTimeout):
+		return &Error{Kind: KindTimeout, Message: err.Error()}
+	default:
+		return &Error{Kind: KindRuntime, Message: err.Error()}
+	}
+}
+
+// Status returns the HTTP status code of the error.
+func Status(e *Error) int {
+	switch e.Kind {
+	case KindRequest:
+		return http.StatusBadRequest
+	case KindTimeout:
+		return http.StatusRequestTimeout
+	case KindBusy:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+func write(w http.ResponseWriter, status int, v any) {
+	if e, ok := v.(*Error); ok {
+		v = map[string]*Error{"error": e}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	// the svg and the messages are not escaped.
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+func bits(list ...bool) string {
+	var b []byte
+	for _, v := range list {
+		if v {
+			b = append(b, '1')
+			continue
+		}
+
+		b = append(b, '0')
+	}
+
+	return string(b)
+}
@@ -0,0 +1,202 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsubaki/qasm/server"
+)
+
+func post(h http.Handler, path, body string) (int, string) {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func ExampleServer_run() {
+	s := server.New()
+	code, body := post(s, "/run", `{"text": "qubit[2] q; bit[2] c; U(pi, 0, pi) q[0]; ctrl @ U(pi, 0, pi) q[0], q[1]; c = measure q;"}`)
+	fmt.Println(code)
+
+	var res server.RunResponse
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(res.Registers, len(res.States), res.Bits)
+
+	// Output:
+	// 200
+	// [q] 1 map[c:11]
+}
+
+func ExampleServer_validate() {
+	s := server.New()
+	fmt.Println(post(s, "/validate", `{"text": "qubit q;\nqubit q0 q1;"}`))
+	fmt.Println(post(s, "/validate", `{"text": "qubit q;"}`))
+
+	// Output:
+	// 422 {"error":{"kind":"syntax","message":"extraneous input 'q1' expecting ';'","line":2,"column":9}}
+	// 200 {"valid":true}
+}
+
+func ExampleServer_lex() {
+	s := server.New()
+	fmt.Println(post(s, "/lex", `{"text": "qubit q;"}`))
+
+	// Output:
+	// 200 {"tokens":[{"type":"QUBIT","text":"qubit","line":1,"column":0},{"type":"Identifier","text":"q","line":1,"column":6},{"type":"SEMICOLON","text":";","line":1,"column":7}]}
+}
+
+func TestServer(t *testing.T) {
+	cases := []struct {
+		opt  []server.Option
+		path string
+		body string
+		code int
+		want string
+	}{
+		{
+			path: "/run",
+			body: `{"text": "qubit q; U(pi, 0, pi) q;", "top": 1}`,
+			code: http.StatusOK,
+			want: `{"registers":["q"],"states":[{"basis":["1"],"real":`,
+		},
+		{
+			path: "/run",
+			body: `{"text": "bit c;"}`,
+			code: http.StatusOK,
+			want: `{"registers":null,"states":[],"bits":{"c":"0"}}`,
+		},
+		{
+			opt:  []server.Option{server.WithMaxQubits(2)},
+			path: "/run",
+			body: `{"text": "qubit[3] q;"}`,
+			code: http.StatusUnprocessableEntity,
+			want: `{"error":{"kind":"runtime","message":"need=3, max=2: too many qubits"}}`,
+		},
+		{
+			opt:  []server.Option{server.WithTimeout(10 * time.Millisecond)},
+			path: "/run",
+			body: `{"text": "while (true) { }"}`,
+			code: http.StatusRequestTimeout,
+			want: `{"error":{"kind":"timeout","message":"context deadline exceeded"}}`,
+		},
+		{
+			opt:  []server.Option{server.WithConcurrency(0)},
+			path: "/run",
+			body: `{"text": "qubit q;"}`,
+			code: http.StatusOK,
+			want: `{"registers":["q"]`,
+		},
+		{
+			opt:  []server.Option{server.WithConcurrency(-1)},
+			path: "/run",
+			body: `{"text": "qubit q;"}`,
+			code: http.StatusOK,
+			want: `{"registers":["q"]`,
+		},
+		{
+			path: "/run",
+			body: `{"text": `,
+			code: http.StatusBadRequest,
+			want: `{"error":{"kind":"request","message":"decode request: unexpected EOF"}}`,
+		},
+		{
+			path: "/svg",
+			body: `{"text": "qubit q; U(pi, 0, pi) q;"}`,
+			code: http.StatusOK,
+			want: `{"svg":"<svg`,
+		},
+		{
+			path: "/format",
+			body: `{"text": "qubit   q;"}`,
+			code: http.StatusOK,
+			want: `{"text":"qubit q;`,
+		},
+		{
+			path: "/parse",
+			body: `{"text": "qubit q;"}`,
+			code: http.StatusOK,
+			want: `{"tree":"(program`,
+		},
+		{
+			path: "/parse",
+			body: `{"text": "qubit q"}`,
+			code: http.StatusUnprocessableEntity,
+			want: `{"error":{"kind":"syntax","message":"missing ';' at '<EOF>'","line":1,"column":7}}`,
+		},
+		{
+			path: "/notfound",
+			body: `{}`,
+			code: http.StatusNotFound,
+			want: `404 page not found`,
+		},
+	}
+
+	for _, c := range cases {
+		code, body := post(server.New(c.opt...), c.path, c.body)
+		if code != c.code {
+			t.Errorf("%s %s: got=%v, want=%v", c.path, c.body, code, c.code)
+		}
+
+		if !strings.HasPrefix(body, c.want) {
+			t.Errorf("%s %s: got=%v, want=%v", c.path, c.body, body, c.want)
+		}
+	}
+}
+
+func TestServer_busy(t *testing.T) {
+	s := server.New(server.WithTimeout(0), server.WithConcurrency(1))
+
+	// the running request holds the concurrency limit until it is canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(`{"text": "while (true) { }"}`))
+		s.ServeHTTP(httptest.NewRecorder(), r.WithContext(ctx))
+	}()
+	defer func() { cancel(); <-done }()
+
+	want := `{"error":{"kind":"busy","message":"wait for the concurrency limit: context deadline exceeded"}}`
+	for range 100 {
+		wctx, wcancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		r := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(`{"text": "qubit q;"}`))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r.WithContext(wctx))
+		wcancel()
+
+		if w.Code != http.StatusServiceUnavailable {
+			// the running request has not started yet.
+			time.Sleep(time.Millisecond)
+			continue
+		}
+
+		if got := strings.TrimSpace(w.Body.String()); got != want {
+			t.Errorf("got=%v, want=%v", got, want)
+		}
+
+		return
+	}
+
+	t.Errorf("the request is not busy")
+}
+
+func TestServer_method(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/run", nil)
+	w := httptest.NewRecorder()
+	server.New().ServeHTTP(w, r)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got=%v, want=%v", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,69 @@
+package session
+
+import (
+	"slices"
+
+	"github.com/itsubaki/q"
+	"github.com/itsubaki/qasm/environ"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+// Session is the simulator and the environment of a program.
+type Session struct {
+	Q   *q.Q
+	Env *environ.Environ
+}
+
+// New returns a new session with a new simulator and environment.
+func New() *Session {
+	return &Session{
+		Q:   q.New(),
+		Env: environ.New(),
+	}
+}
+
+// Visitor returns a new visitor of the session.
+func (s *Session) Visitor(opt ...visitor.Option) *visitor.Visitor {
+	return visitor.New(s.Q, s.Env, opt...)
+}
+
+// Snapshot is a deep copy of the state vector and the environment.
+// State is the amplitudes of the simulator in the order of its qubits.
+type Snapshot struct {
+	State []complex128
+	Env   *environ.Environ
+}
+
+// Snapshot returns a deep copy of the session.
+// The session can be modified after the snapshot without changing it.
+func (s *Session) Snapshot() *Snapshot {
+	var state []complex128
+	if s.Q.NumQubits() > 0 {
+		state = slices.Clone(s.Q.Amplitude())
+	}
+
+	return &Snapshot{
+		State: state,
+		Env:   s.Env.Clone(),
+	}
+}
+
+// Restore replaces the simulator and the environment of the session with a copy of the snapshot.
+// The snapshot can be restored any number of times.
+// The visitors of the previous simulator and environment are not affected, so create a new one after the restore.
+func (s *Session) Restore(snapshot *Snapshot) {
+	qsim := q.New()
+	if len(snapshot.State) > 0 {
+		qsim.New(snapshot.State...)
+	}
+
+	s.Q, s.Env = qsim, snapshot.Env.Clone()
+}
+
+// Clone returns a new session with a deep copy of the session.
+// It is used to branch the simulation from the current state.
+func (s *Session) Clone() *Session {
+	c := &Session{}
+	c.Restore(s.Snapshot())
+	return c
+}
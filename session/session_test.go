@@ -0,0 +1,96 @@
+package session_test
+
+import (
+	"fmt"
+
+	"github.com/itsubaki/q"
+	xparser "github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/session"
+)
+
+func run(s *session.Session, text string) {
+	program, err := xparser.Parse(text)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := s.Visitor().Run(program); err != nil {
+		panic(err)
+	}
+}
+
+func show(s *session.Session) {
+	for _, st := range q.Top(s.Q.Qubit().State(s.Env.Index()...), -1) {
+		fmt.Println(st)
+	}
+
+	fmt.Println(s.Env.Variable)
+}
+
+func ExampleSession_Snapshot() {
+	s := session.New()
+	run(s, `
+		qubit[2] q;
+		int n = 1;
+		U(pi/2.0, 0, pi) q[0];
+		ctrl @ U(pi, 0, pi) q[0], q[1];
+	`)
+
+	snapshot := s.Snapshot()
+	run(s, `
+		U(pi, 0, pi) q[1];
+		n = 2;
+	`)
+	show(s)
+
+	s.Restore(snapshot)
+	show(s)
+
+	// Output:
+	// [01][  1]( 0.7071 0.0000i): 0.5000
+	// [10][  2]( 0.7071 0.0000i): 0.5000
+	// map[n:2]
+	// [00][  0]( 0.7071 0.0000i): 0.5000
+	// [11][  3]( 0.7071 0.0000i): 0.5000
+	// map[n:1]
+}
+
+func ExampleSession_Clone() {
+	s := session.New()
+	run(s, `
+		qubit q;
+		bit c;
+		U(0, 0, 0) q;
+	`)
+
+	for _, text := range []string{
+		"U(pi, 0, pi) q; c = measure q;",
+		"c = measure q;",
+	} {
+		branch := s.Clone()
+		run(branch, text)
+		fmt.Println(branch.Env.Bit)
+	}
+
+	fmt.Println(s.Env.Bit)
+
+	// Output:
+	// map[c:true]
+	// map[c:false]
+	// map[c:false]
+}
+
+func ExampleSession_Restore() {
+	s := session.New()
+	snapshot := s.Snapshot()
+
+	run(s, "qubit q; int[8] a = 3;")
+	s.Restore(snapshot)
+	run(s, "qubit[2] q; int[8] a = 4;")
+	s.Restore(snapshot)
+
+	fmt.Println(s.Q.NumQubits(), s.Env.Qubit, s.Env.Variable)
+
+	// Output:
+	// 0 map[] map[]
+}
@@ -0,0 +1,292 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"reflect"
+	"slices"
+
+	"github.com/itsubaki/q"
+	"github.com/itsubaki/qasm/angle"
+	"github.com/itsubaki/qasm/environ"
+)
+
+// FormatVersion is the version of the format of the saved state.
+const FormatVersion = 1
+
+// State is the JSON document of the saved state.
+//
+//	{
+//	  "version": 1,
+//	  "amplitudes": [[0.7071067811865476, 0], [0, 0], [0, 0], [0.7071067811865476, 0]],
+//	  "registers": [{"name": "q", "qubits": [0, 1]}],
+//	  "bits": {"b": true},
+//	  "bit_arrays": {"c": [true, true]},
+//	  "variables": {"n": {"type": "int64", "value": 3}, "a": {"type": "[]float64", "value": [0.5, 1]}}
+//	}
+//
+// Amplitudes are the [real, imag] pairs of the state vector in the order of the qubits of the simulator,
+// and the first qubit is the most significant bit of the index.
+// Registers are the qubit registers in the order of the declaration, and Qubits are the indices of the qubits of the simulator.
+// Variables are the values with the Go type names such as int64, float64, bool, *angle.Angle, []int8 and []interface {}.
+// The constants, the gates and the subroutines are not saved, so include or define them again in the later program.
+type State struct {
+	Version    int               `json:"version"`
+	Amplitudes [][2]float64      `json:"amplitudes"`
+	Registers  []Register        `json:"registers"`
+	Bits       map[string]bool   `json:"bits"`
+	BitArrays  map[string][]bool `json:"bit_arrays"`
+	Variables  map[string]Value  `json:"variables"`
+}
+
+// Register is the name and the qubits of the qubit register.
+type Register struct {
+	Name   string `json:"name"`
+	Qubits []int  `json:"qubits"`
+}
+
+// Value is the value of the variable and its type.
+type Value struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// types are the types of the values of the variables.
+var types = func() map[string]reflect.Type {
+	m := make(map[string]reflect.Type)
+	for _, v := range []any{
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0), false, &angle.Angle{},
+		[]int8{}, []int16{}, []int32{}, []int64{},
+		[]uint8{}, []uint16{}, []uint32{}, []uint64{},
+		[]float32{}, []float64{}, []bool{}, []any{},
+	} {
+		t := reflect.TypeOf(v)
+		m[t.String()] = t
+	}
+
+	return m
+}()
+
+// Save writes the state vector, the qubit registers, the bits, the bit arrays and the variables of the snapshot as JSON.
+// Only the environment of the snapshot is saved, not the outer ones.
+func Save(w io.Writer, snapshot *Snapshot) error {
+	state := State{
+		Version:    FormatVersion,
+		Amplitudes: make([][2]float64, len(snapshot.State)),
+		Registers:  []Register{},
+		Bits:       snapshot.Env.Bit,
+		BitArrays:  snapshot.Env.BitArray,
+		Variables:  make(map[string]Value),
+	}
+
+	for i, a := range snapshot.State {
+		state.Amplitudes[i] = [2]float64{real(a), imag(a)}
+	}
+
+	for _, name := range snapshot.Env.QubitOrder {
+		state.Registers = append(state.Registers, Register{
+			Name:   name,
+			Qubits: q.Index(snapshot.Env.Qubit[name]...),
+		})
+	}
+
+	for name, v := range snapshot.Env.Variable {
+		value, err := encode(v)
+		if err != nil {
+			return fmt.Errorf("variable %q: %w", name, err)
+		}
+
+		state.Variables[name] = value
+	}
+
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+
+	return nil
+}
+
+// Load reads the state written by Save and returns the snapshot of it.
+func Load(r io.Reader) (*Snapshot, error) {
+	var state State
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+
+	if state.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported version %d", state.Version)
+	}
+
+	n := len(state.Amplitudes)
+	if n == 1 || n&(n-1) != 0 {
+		return nil, fmt.Errorf("invalid number of amplitudes %d", n)
+	}
+
+	snapshot := &Snapshot{
+		Env: environ.New(),
+	}
+
+	if n > 0 {
+		snapshot.State = make([]complex128, n)
+		for i, a := range state.Amplitudes {
+			snapshot.State[i] = complex(a[0], a[1])
+		}
+	}
+
+	qubits := bits.Len(uint(n)) - 1
+	for _, reg := range state.Registers {
+		if _, ok := snapshot.Env.Qubit[reg.Name]; ok {
+			return nil, fmt.Errorf("register %q redeclared", reg.Name)
+		}
+
+		list := make([]q.Qubit, len(reg.Qubits))
+		for i, idx := range reg.Qubits {
+			if idx < 0 || idx >= qubits {
+				return nil, fmt.Errorf("register %q: qubit %d out of range %d", reg.Name, idx, qubits)
+			}
+
+			list[i] = q.Qubit(idx)
+		}
+
+		snapshot.Env.SetQubit(reg.Name, list)
+	}
+
+	for name, b := range state.Bits {
+		snapshot.Env.Bit[name] = b
+	}
+
+	for name, list := range state.BitArrays {
+		snapshot.Env.BitArray[name] = slices.Clone(list)
+	}
+
+	for name, value := range state.Variables {
+		v, err := decode(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable %q: %w", name, err)
+		}
+
+		snapshot.Env.Variable[name] = v
+	}
+
+	return snapshot, nil
+}
+
+// SaveFile writes the state of the snapshot to the file.
+func SaveFile(path string, snapshot *Snapshot) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+
+	if err := Save(f, snapshot); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// LoadFile reads the state from the file.
+func LoadFile(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+func encode(v any) (Value, error) {
+	t := reflect.TypeOf(v)
+	if t == nil || types[t.String()] != t {
+		return Value{}, fmt.Errorf("unsupported type %T", v)
+	}
+
+	if list, ok := v.([]any); ok {
+		values := make([]Value, len(list))
+		for i, e := range list {
+			value, err := encode(e)
+			if err != nil {
+				return Value{}, err
+			}
+
+			values[i] = value
+		}
+
+		v = values
+	}
+
+	if list, ok := v.([]uint8); ok {
+		// the numbers instead of base64
+		numbers := make([]uint16, len(list))
+		for i, e := range list {
+			numbers[i] = uint16(e)
+		}
+
+		v = numbers
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Value{}, err
+	}
+
+	return Value{Type: t.String(), Value: b}, nil
+}
+
+func decode(value Value) (any, error) {
+	t, ok := types[value.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %q", value.Type)
+	}
+
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Interface {
+		var values []Value
+		if err := json.Unmarshal(value.Value, &values); err != nil {
+			return nil, err
+		}
+
+		list := make([]any, len(values))
+		for i, e := range values {
+			v, err := decode(e)
+			if err != nil {
+				return nil, err
+			}
+
+			list[i] = v
+		}
+
+		return list, nil
+	}
+
+	if t == reflect.TypeOf([]uint8{}) {
+		var numbers []uint16
+		if err := json.Unmarshal(value.Value, &numbers); err != nil {
+			return nil, err
+		}
+
+		list := make([]uint8, len(numbers))
+		for i, e := range numbers {
+			if e > 255 {
+				return nil, fmt.Errorf("value %d out of range of uint8", e)
+			}
+
+			list[i] = uint8(e)
+		}
+
+		return list, nil
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(value.Value, v.Interface()); err != nil {
+		return nil, err
+	}
+
+	return v.Elem().Interface(), nil
+}
@@ -0,0 +1,134 @@
+package session_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itsubaki/qasm/session"
+)
+
+func ExampleSave() {
+	s := session.New()
+	run(s, `
+		qubit[2] q;
+		bit[2] c;
+		int n = 3;
+		array[float[64], 2] xs = {0.5, 1.0};
+	`)
+
+	if err := session.Save(os.Stdout, s.Snapshot()); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// {"version":1,"amplitudes":[[1,0],[0,0],[0,0],[0,0]],"registers":[{"name":"q","qubits":[0,1]}],"bits":{},"bit_arrays":{"c":[false,false]},"variables":{"n":{"type":"int64","value":3},"xs":{"type":"[]interface {}","value":[{"type":"float64","value":0.5},{"type":"float64","value":1}]}}}
+}
+
+func ExampleLoad() {
+	s := session.New()
+	run(s, `
+		qubit[2] q;
+		int n = 1;
+		U(pi/2.0, 0, pi) q[0];
+	`)
+
+	var buf bytes.Buffer
+	if err := session.Save(&buf, s.Snapshot()); err != nil {
+		panic(err)
+	}
+
+	snapshot, err := session.Load(&buf)
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := session.New()
+	loaded.Restore(snapshot)
+	run(loaded, `
+		qubit r;
+		ctrl @ U(pi, 0, pi) q[0], q[1];
+		n = n + 1;
+	`)
+	show(loaded)
+
+	// Output:
+	// [00 0][  0   0]( 0.7071 0.0000i): 0.5000
+	// [11 0][  3   0]( 0.7071 0.0000i): 0.5000
+	// map[n:2]
+}
+
+func TestSaveFile(t *testing.T) {
+	s := session.New()
+	run(s, `
+		qubit q;
+		bit b;
+		angle[4] a = pi;
+		array[uint[8], 2] u = {1, 255};
+		array[int[16], 2] i;
+		U(pi, 0, pi) q;
+		b = measure q;
+	`)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := session.SaveFile(path, s.Snapshot()); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	snapshot, err := session.LoadFile(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	want := s.Snapshot()
+	if fmt.Sprint(snapshot.State) != fmt.Sprint(want.State) {
+		t.Errorf("got=%v, want=%v", snapshot.State, want.State)
+	}
+
+	for _, c := range []struct {
+		got, want any
+	}{
+		{snapshot.Env.QubitOrder, want.Env.QubitOrder},
+		{snapshot.Env.Qubit, want.Env.Qubit},
+		{snapshot.Env.Bit, want.Env.Bit},
+		{snapshot.Env.BitArray, want.Env.BitArray},
+		{snapshot.Env.Variable, want.Env.Variable},
+	} {
+		if fmt.Sprintf("%T %v", c.got, c.got) != fmt.Sprintf("%T %v", c.want, c.want) {
+			t.Errorf("got=%T %v, want=%T %v", c.got, c.got, c.want, c.want)
+		}
+	}
+
+	for name, v := range want.Env.Variable {
+		if fmt.Sprintf("%T", snapshot.Env.Variable[name]) != fmt.Sprintf("%T", v) {
+			t.Errorf("%s: got=%T, want=%T", name, snapshot.Env.Variable[name], v)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		{`{`, "read state: unexpected EOF"},
+		{`{"version": 2}`, "unsupported version 2"},
+		{`{"version": 1, "amplitudes": [[1, 0], [0, 0], [0, 0]]}`, "invalid number of amplitudes 3"},
+		{`{"version": 1, "amplitudes": [[1, 0]]}`, "invalid number of amplitudes 1"},
+		{`{"version": 1, "amplitudes": [[1, 0], [0, 0]], "registers": [{"name": "q", "qubits": [1]}]}`, `register "q": qubit 1 out of range 1`},
+		{`{"version": 1, "amplitudes": [[1, 0], [0, 0]], "registers": [{"name": "q", "qubits": [0]}, {"name": "q", "qubits": [0]}]}`, `register "q" redeclared`},
+		{`{"version": 1, "variables": {"x": {"type": "complex128", "value": 1}}}`, `variable "x": unsupported type "complex128"`},
+		{`{"version": 1, "variables": {"x": {"type": "[]uint8", "value": [256]}}}`, `variable "x": value 256 out of range of uint8`},
+		{`{"version": 1, "variables": {"x": {"type": "int64", "value": "1"}}}`, `variable "x": json: cannot unmarshal string into Go value of type int64`},
+	}
+
+	for _, c := range cases {
+		_, err := session.Load(strings.NewReader(c.text))
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: got=%v, want=%v", c.text, err, c.want)
+		}
+	}
+}
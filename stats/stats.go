@@ -0,0 +1,185 @@
+package stats
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/itsubaki/q/math/epsilon"
+	"github.com/itsubaki/qasm/flatten"
+	"github.com/itsubaki/qasm/transpile"
+)
+
+// CliffordT is the basis used to count the T gates.
+var CliffordT = []string{"rz", "sx", "x", "cx"}
+
+// Stats is the resource estimation of a program.
+type Stats struct {
+	Qubits        []flatten.Register `json:"qubits"`
+	Gates         []Count            `json:"gates"`
+	NumGates      int                `json:"num_gates"`
+	TwoQubit      int                `json:"two_qubit"`
+	Depth         int                `json:"depth"`
+	TwoQubitDepth int                `json:"two_qubit_depth"`
+	Measurements  int                `json:"measurements"`
+	TCount        int                `json:"t_count"`
+	Rotations     int                `json:"rotations"`
+}
+
+// Count is the number of gates with the name and the number of controls.
+type Count struct {
+	Name     string `json:"name"`
+	Controls int    `json:"controls"`
+	Count    int    `json:"count"`
+}
+
+// Estimate returns the stats of the input text without simulating it.
+func Estimate(text string) (*Stats, error) {
+	p, err := flatten.Flatten(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(p)
+}
+
+// New returns the stats of the program.
+// A call of the user-defined gate is counted once, and a two-qubit gate is a call acting on two qubits.
+// The T-count is of the decomposition into CliffordT.
+// Rotations by angles other than multiples of pi/4 are not approximated and are counted in Rotations.
+func New(p *flatten.Program) (*Stats, error) {
+	s := &Stats{
+		Qubits:        p.Qubits,
+		Depth:         p.Depth(),
+		TwoQubitDepth: flatten.Depth(p.Ops, TwoQubit),
+	}
+
+	// the ops of a call of the user-defined gate are counted once.
+	var calls []*call
+	seen := make(map[int]*call)
+	for _, op := range p.Ops {
+		if op.Name == flatten.Measure {
+			s.Measurements += len(op.Target)
+		}
+
+		if !op.IsGate() {
+			continue
+		}
+
+		if c, ok := seen[op.Call]; ok && op.Call > 0 {
+			c.add(op)
+			continue
+		}
+
+		c := &call{name: op.Name, controls: len(op.Control), qubits: make(map[int]bool)}
+		if op.Gate != "" {
+			c.name = op.Gate
+		}
+
+		c.add(op)
+		calls = append(calls, c)
+		if op.Call > 0 {
+			seen[op.Call] = c
+		}
+	}
+
+	counts := make(map[Count]int)
+	for _, c := range calls {
+		counts[Count{Name: c.name, Controls: c.controls}]++
+		s.NumGates++
+
+		if len(c.qubits) == 2 {
+			s.TwoQubit++
+		}
+	}
+
+	for c, n := range counts {
+		c.Count = n
+		s.Gates = append(s.Gates, c)
+	}
+
+	slices.SortFunc(s.Gates, func(a, b Count) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Controls, b.Controls))
+	})
+
+	ct, err := transpile.Transpile(p, CliffordT)
+	if err != nil {
+		return nil, fmt.Errorf("clifford+t: %w", err)
+	}
+
+	for _, op := range ct.Ops {
+		if op.Name != "rz" {
+			continue
+		}
+
+		// rz(k*pi/4) is a Clifford gate for even k and a T gate up to Clifford gates for odd k.
+		k := flatten.Wrap(op.Params[0]) / (math.Pi / 4)
+		switch r := math.Round(k); {
+		case !epsilon.IsZeroF64(k - r):
+			s.Rotations++
+		case int(r)%2 != 0:
+			s.TCount++
+		}
+	}
+
+	return s, nil
+}
+
+// call is the ops of a call of the gate.
+// The controls are the fewest controls of the ops, which are the ones of the modifiers.
+type call struct {
+	name     string
+	controls int
+	qubits   map[int]bool
+}
+
+func (c *call) add(op flatten.Op) {
+	c.controls = min(c.controls, len(op.Control))
+	for _, q := range op.Qubits() {
+		c.qubits[q] = true
+	}
+}
+
+// TwoQubit returns true if the op is a gate acting on two qubits.
+func TwoQubit(op flatten.Op) bool {
+	return op.IsGate() && len(op.Qubits()) == 2
+}
+
+// NumQubits returns the number of qubits.
+func (s *Stats) NumQubits() int {
+	var n int
+	for _, r := range s.Qubits {
+		n += r.Size
+	}
+
+	return n
+}
+
+// String returns the report of the stats.
+func (s *Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "qubits: %d\n", s.NumQubits())
+	for _, r := range s.Qubits {
+		fmt.Fprintf(&b, "  %s: %d\n", r.Name, r.Size)
+	}
+
+	fmt.Fprintf(&b, "gates: %d\n", s.NumGates)
+	for _, c := range s.Gates {
+		if c.Controls == 0 {
+			fmt.Fprintf(&b, "  %s: %d\n", c.Name, c.Count)
+			continue
+		}
+
+		fmt.Fprintf(&b, "  %s (ctrl=%d): %d\n", c.Name, c.Controls, c.Count)
+	}
+
+	fmt.Fprintf(&b, "two-qubit gates: %d\n", s.TwoQubit)
+	fmt.Fprintf(&b, "depth: %d\n", s.Depth)
+	fmt.Fprintf(&b, "two-qubit depth: %d\n", s.TwoQubitDepth)
+	fmt.Fprintf(&b, "measurements: %d\n", s.Measurements)
+	fmt.Fprintf(&b, "T-count: %d\n", s.TCount)
+	fmt.Fprintf(&b, "rotations: %d\n", s.Rotations)
+	return b.String()
+}
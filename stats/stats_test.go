@@ -0,0 +1,111 @@
+package stats_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/itsubaki/qasm/stats"
+)
+
+func ExampleEstimate() {
+	s, err := stats.Estimate(`
+	gate h q { U(pi/2.0, 0, pi) q; }
+	gate x q { U(pi, 0, pi) q; }
+	gate t q { U(0, 0, pi/4) q; }
+	qubit[2] q;
+	qubit a;
+	bit[2] c;
+	h q;
+	for int i in [0:2] { t a; }
+	ctrl(2) @ x q[0], q[1], a;
+	c = measure q;
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(s)
+
+	// Output:
+	// qubits: 3
+	//   q: 2
+	//   a: 1
+	// gates: 6
+	//   h: 2
+	//   t: 3
+	//   x (ctrl=2): 1
+	// two-qubit gates: 0
+	// depth: 5
+	// two-qubit depth: 0
+	// measurements: 2
+	// T-count: 10
+	// rotations: 0
+}
+
+func TestEstimate(t *testing.T) {
+	cases := []struct {
+		text          string
+		qubits        int
+		gates         int
+		twoQubit      int
+		depth         int
+		twoQubitDepth int
+		tcount        int
+		rotations     int
+	}{
+		{
+			text:   `qubit[1000] q; U(pi/2.0, 0, pi) q;`,
+			qubits: 1000,
+			gates:  1000,
+			depth:  1,
+		},
+		{
+			text: `
+			qubit[3] q;
+			for int i in [0:1] { ctrl @ U(pi, 0, pi) q[i], q[i+1]; }
+			ctrl @ U(0, 0, pi/2) q[0], q[2];
+			`,
+			qubits:        3,
+			gates:         3,
+			twoQubit:      3,
+			depth:         3,
+			twoQubitDepth: 3,
+			tcount:        3,
+		},
+		{
+			text: `
+			gate cz a, b { U(pi/2.0, 0, pi) b; ctrl @ U(pi, 0, pi) a, b; U(pi/2.0, 0, pi) b; }
+			gate hs a { U(pi/2.0, 0, pi) a; U(0, 0, pi/2.0) a; }
+			qubit[2] q;
+			qubit[2] r;
+			cz q[0], q[1];
+			hs r;
+			`,
+			qubits:        4,
+			gates:         3,
+			twoQubit:      1,
+			depth:         3,
+			twoQubitDepth: 1,
+		},
+		{
+			text:      `qubit q; U(0.1, 0.2, 0.3) q; U(0, 0, pi) $0;`,
+			qubits:    2,
+			gates:     2,
+			depth:     1,
+			rotations: 3,
+		},
+	}
+
+	for _, c := range cases {
+		s, err := stats.Estimate(c.text)
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		got := []int{s.NumQubits(), s.NumGates, s.TwoQubit, s.Depth, s.TwoQubitDepth, s.TCount, s.Rotations}
+		want := []int{c.qubits, c.gates, c.twoQubit, c.depth, c.twoQubitDepth, c.tcount, c.rotations}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: got=%v, want=%v", c.text, got, want)
+		}
+	}
+}
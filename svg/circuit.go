@@ -1,33 +1,135 @@
 package svg
 
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
 var (
 	_ Op = (*Gate)(nil)
+	_ Op = (*Subroutine)(nil)
 	_ Op = (*Measurement)(nil)
+	_ Op = (*Reset)(nil)
+	_ Op = (*Barrier)(nil)
+	_ Op = (*Group)(nil)
 )
 
+// Circuit is the wires and the ops in the order of the program.
+// The ops added by an execution of a statement share the step of it.
 type Circuit struct {
 	Wires []Wire `json:"wires"`
 	Ops   []Op   `json:"ops"`
+	steps map[Op]step
 }
 
 type Wire struct {
-	Name string `json:"name"`
+	Name      string `json:"name"`
+	Classical bool   `json:"classical,omitempty"`
 }
 
 type Op interface {
 	Wires() []int
 }
 
+// Gate is a gate applied to the targets.
+// A conditional gate has the classical wires of the condition in Bit and the condition in Cond,
+// where the classical wires, the loop variables and the arguments of the expanded calls are resolved.
 type Gate struct {
-	Name    string `json:"name"`
-	Control []int  `json:"control,omitempty"`
-	Target  []int  `json:"target,omitempty"`
+	Name       string     `json:"name"`
+	Params     []float64  `json:"params,omitempty"`
+	Modifiers  []Modifier `json:"modifiers,omitempty"`
+	Control    []int      `json:"control,omitempty"`
+	NegControl []int      `json:"negcontrol,omitempty"`
+	Target     []int      `json:"target,omitempty"`
+	Bit        []int      `json:"bit,omitempty"`
+	Cond       string     `json:"cond,omitempty"`
+}
+
+// Modifier is an inv or pow modifier of the gate, in the order they are written.
+type Modifier struct {
+	Name     string  `json:"name"`
+	Exponent float64 `json:"exponent,omitempty"`
+}
+
+// Label returns the name of the gate with the params formatted in the precision and the modifiers.
+// e.g. U(π/2, 0, π), S†, X^0.5
+func (g *Gate) Label(precision int) string {
+	return g.label(precision, "π", "†", "^%s")
+}
+
+func (g *Gate) label(precision int, pi, dagger, pow string) string {
+	label := g.Name
+	if len(g.Params) > 0 {
+		params := make([]string, len(g.Params))
+		for i, p := range g.Params {
+			params[i] = FormatParam(p, precision, pi)
+		}
+
+		label = fmt.Sprintf("%s(%s)", label, strings.Join(params, ", "))
+	}
+
+	// modifiers are applied from the innermost one.
+	for _, m := range slices.Backward(g.Modifiers) {
+		switch m.Name {
+		case "inv":
+			label += dagger
+		case "pow":
+			label += fmt.Sprintf(pow, FormatParam(m.Exponent, precision, ""))
+		}
+	}
+
+	return label
+}
+
+// FormatParam returns the param formatted as a multiple of pi such as π/2 if possible,
+// or as a decimal in the precision otherwise. An empty pi disables the symbolic formatting.
+func FormatParam(v float64, precision int, pi string) string {
+	if pi != "" && math.Abs(v) > 1e-12 {
+		for d := 1; d <= 16; d++ {
+			n := v / math.Pi * float64(d)
+			if math.Abs(n-math.Round(n)) > 1e-9 {
+				continue
+			}
+
+			var s string
+			switch k := int(math.Round(n)); k {
+			case 1:
+				s = pi
+			case -1:
+				s = "-" + pi
+			default:
+				s = fmt.Sprintf("%d%s", k, pi)
+			}
+
+			if d > 1 {
+				s = fmt.Sprintf("%s/%d", s, d)
+			}
+
+			return s
+		}
+	}
+
+	s := strconv.FormatFloat(v, 'f', precision, 64)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+
+	if s == "-0" {
+		return "0"
+	}
+
+	return s
 }
 
 func (g *Gate) Wires() []int {
 	var wires []int
 	wires = append(wires, g.Control...)
+	wires = append(wires, g.NegControl...)
 	wires = append(wires, g.Target...)
+	wires = append(wires, g.Bit...)
 	return wires
 }
 
@@ -52,6 +154,14 @@ func (m *Measurement) Wires() []int {
 	return wires
 }
 
+type Reset struct {
+	Wire []int `json:"wire"`
+}
+
+func (r *Reset) Wires() []int {
+	return r.Wire
+}
+
 type Barrier struct {
 	Wire []int `json:"wire"`
 }
@@ -59,3 +169,20 @@ type Barrier struct {
 func (b *Barrier) Wires() []int {
 	return b.Wire
 }
+
+// Group is the ops of the control flow such as for, while, switch and box.
+type Group struct {
+	Label string `json:"label"`
+	Ops   []Op   `json:"ops"`
+}
+
+// Wires returns the wires of the ops in ascending order.
+func (g *Group) Wires() []int {
+	var wires []int
+	for _, op := range g.Ops {
+		wires = append(wires, op.Wires()...)
+	}
+
+	slices.Sort(wires)
+	return slices.Compact(wires)
+}
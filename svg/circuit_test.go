@@ -2,6 +2,8 @@ package svg_test
 
 import (
 	"fmt"
+	"math"
+	"testing"
 
 	"github.com/itsubaki/qasm/svg"
 )
@@ -19,6 +21,57 @@ func ExampleGate_Wires() {
 	// [0 1]
 }
 
+func ExampleGate_Label() {
+	g := &svg.Gate{
+		Name:   "U",
+		Params: []float64{math.Pi / 2, 0, -3 * math.Pi / 4},
+		Modifiers: []svg.Modifier{
+			{Name: "pow", Exponent: 0.5},
+			{Name: "inv"},
+		},
+	}
+
+	fmt.Println(g.Label(2))
+
+	// Output:
+	// U(π/2, 0, -3π/4)†^0.5
+}
+
+func TestFormatParam(t *testing.T) {
+	cases := []struct {
+		in        float64
+		precision int
+		pi        string
+		want      string
+	}{
+		{0, 2, "π", "0"},
+		{math.Pi, 2, "π", "π"},
+		{-math.Pi, 2, "π", "-π"},
+		{math.Pi / 2, 2, "π", "π/2"},
+		{2 * math.Pi / 3, 2, "π", "2π/3"},
+		{math.Pi / 8, 2, `\pi`, `\pi/8`},
+		{math.Pi / 2, 3, "", "1.571"},
+		{0.1, 2, "π", "0.1"},
+		{1.23456, 3, "π", "1.235"},
+		{2, 2, "π", "2"},
+		{-0.001, 2, "π", "0"},
+	}
+
+	for _, c := range cases {
+		got := svg.FormatParam(c.in, c.precision, c.pi)
+		if got != c.want {
+			t.Errorf("FormatParam(%v, %v, %q)=%q, want=%q", c.in, c.precision, c.pi, got, c.want)
+		}
+	}
+}
+
+func ExampleRuns() {
+	fmt.Println(svg.Runs([]int{4, 0, 2, 1}))
+
+	// Output:
+	// [[0 1 2] [4]]
+}
+
 func ExampleSubroutine_Wires() {
 	s := &svg.Subroutine{
 		Name: "qft",
@@ -0,0 +1,136 @@
+package svg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config is the geometry, the font and the colours of the SVG diagram.
+// The layers are folded into the rows of Fold layers, and the Fold of 0 disables folding.
+type Config struct {
+	WireGap    int     `json:"wire_gap"`
+	WireStartX int     `json:"wire_start_x"`
+	WireStartY int     `json:"wire_start_y"`
+	OpWidth    int     `json:"op_width"`
+	OpHeight   int     `json:"op_height"`
+	OpRX       int     `json:"op_rx"`
+	FontSize   int     `json:"font_size"`
+	FontFamily string  `json:"font_family"`
+	Precision  int     `json:"precision"`
+	WireStroke float64 `json:"wire_stroke"`
+	OpStroke   float64 `json:"op_stroke"`
+	Fold       int     `json:"fold"`
+	Theme      Theme   `json:"theme"`
+}
+
+var DefaultConfig = Config{
+	WireGap:    56,
+	WireStartX: 80,
+	WireStartY: 42,
+	OpWidth:    36,
+	OpHeight:   36,
+	OpRX:       8,
+	FontSize:   13,
+	FontFamily: "ui-monospace, monospace",
+	Precision:  2,
+	WireStroke: 2,
+	OpStroke:   2,
+	Theme:      LightTheme,
+}
+
+// Theme is the colours of the SVG diagram.
+// The empty Background is transparent, and Surface is the colour behind the labels and the hollow controls.
+type Theme struct {
+	Background string `json:"background"`
+	Surface    string `json:"surface"`
+	Wire       string `json:"wire"`
+	Text       string `json:"text"`
+	GateFill   string `json:"gate_fill"`
+	GateText   string `json:"gate_text"`
+	Gate       string `json:"gate"`
+	Subroutine string `json:"subroutine"`
+	Measure    string `json:"measure"`
+	Reset      string `json:"reset"`
+	Barrier    string `json:"barrier"`
+	Region     string `json:"region"`
+	RegionText string `json:"region_text"`
+}
+
+var LightTheme = Theme{
+	Background: "",
+	Surface:    "#ffffff",
+	Wire:       "#4b5563",
+	Text:       "#4b5563",
+	GateFill:   "#1f2937",
+	GateText:   "#e5e7eb",
+	Gate:       "#0ea5e9",
+	Subroutine: "#8b5cf6",
+	Measure:    "#10b981",
+	Reset:      "#64748b",
+	Barrier:    "#f59e0b",
+	Region:     "#94a3b8",
+	RegionText: "#64748b",
+}
+
+var DarkTheme = Theme{
+	Background: "#0f172a",
+	Surface:    "#0f172a",
+	Wire:       "#94a3b8",
+	Text:       "#cbd5e1",
+	GateFill:   "#1e293b",
+	GateText:   "#f1f5f9",
+	Gate:       "#38bdf8",
+	Subroutine: "#a78bfa",
+	Measure:    "#34d399",
+	Reset:      "#94a3b8",
+	Barrier:    "#fbbf24",
+	Region:     "#64748b",
+	RegionText: "#94a3b8",
+}
+
+// Themes is the themes by name.
+var Themes = map[string]Theme{
+	"light": LightTheme,
+	"dark":  DarkTheme,
+}
+
+// UnmarshalJSON sets the theme by name such as "dark",
+// or overrides the colours of the theme with the object.
+func (t *Theme) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		theme, ok := Themes[name]
+		if !ok {
+			return fmt.Errorf("unsupported theme %q", name)
+		}
+
+		*t = theme
+		return nil
+	}
+
+	type colours Theme
+	return json.Unmarshal(b, (*colours)(t))
+}
+
+// LoadConfig returns the config of the JSON file.
+// The keys that are not in the file are the ones of DefaultConfig.
+// e.g. {"theme": "dark", "fold": 20, "font_size": 14}
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read file %s: %w", path, err)
+	}
+
+	return ParseConfig(b)
+}
+
+// ParseConfig returns the config of the JSON.
+func ParseConfig(b []byte) (Config, error) {
+	config := DefaultConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return Config{}, fmt.Errorf("unmarshal config: %w", err)
+	}
+
+	return config, nil
+}
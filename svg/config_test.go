@@ -0,0 +1,68 @@
+package svg_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itsubaki/qasm/svg"
+)
+
+func ExampleParseConfig() {
+	config, err := svg.ParseConfig([]byte(`{"theme": "dark", "fold": 20, "font_size": 14}`))
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(config.Theme == svg.DarkTheme, config.Fold, config.FontSize, config.WireGap)
+
+	config, err = svg.ParseConfig([]byte(`{"theme": {"gate": "#ff0000"}, "op_stroke": 1.5}`))
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(config.Theme.Gate, config.Theme.Wire, config.OpStroke, config.WireStroke)
+
+	// Output:
+	// true 20 14 56
+	// #ff0000 #4b5563 1.5 2
+}
+
+func TestParseConfig(t *testing.T) {
+	cases := []struct {
+		json   string
+		errMsg string
+	}{
+		{`{"theme": "foo"}`, `unmarshal config: unsupported theme "foo"`},
+		{`{"fold": "3"}`, `unmarshal config: json: cannot unmarshal string into Go struct field Config.fold of type int`},
+		{`{`, `unmarshal config: unexpected end of JSON input`},
+	}
+
+	for _, c := range cases {
+		_, err := svg.ParseConfig([]byte(c.json))
+		if err == nil || err.Error() != c.errMsg {
+			t.Errorf("got=%v, want=%v", err, c.errMsg)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"theme": "dark"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := svg.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Theme != svg.DarkTheme {
+		t.Errorf("got=%v, want=%v", config.Theme, svg.DarkTheme)
+	}
+
+	if _, err := svg.LoadConfig(filepath.Join(t.TempDir(), "not_found.json")); err == nil {
+		t.Errorf("expected error")
+	}
+}
@@ -0,0 +1,119 @@
+package svg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// HTML returns the self-contained HTML of the diagram and the state after each layer of the input text.
+// Clicking a layer shows the amplitudes and the probabilities after it in the order of env.Index().
+func HTML(text string, config Config, opt ...Option) (string, error) {
+	sim, err := Simulate(text, opt...)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(sim)
+	if err != nil {
+		return "", fmt.Errorf("marshal simulation: %w", err)
+	}
+
+	theme := config.Theme
+	diagram := strings.TrimSuffix(Render(sim.Layout, config), `</svg>`) + columnRects(sim.Layout, config) + `</svg>`
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n")
+	b.WriteString(`<html lang="en">` + "\n")
+	b.WriteString(`<head>` + "\n")
+	b.WriteString(`<meta charset="utf-8">` + "\n")
+	b.WriteString(`<title>qasm</title>` + "\n")
+	b.WriteString(`<style>` + "\n")
+	fmt.Fprintf(&b, "body { margin: 16px; font-family: %s; background: %s; color: %s; }\n", config.FontFamily, theme.Surface, theme.Text)
+	b.WriteString(".diagram { overflow-x: auto; }\n")
+	b.WriteString(".layer { fill: transparent; cursor: pointer; }\n")
+	fmt.Fprintf(&b, ".layer:hover, .layer.selected { fill: %s; fill-opacity: 0.15; }\n", theme.Gate)
+	b.WriteString("table { border-collapse: collapse; }\n")
+	fmt.Fprintf(&b, "th, td { padding: 2px 12px; text-align: right; border-bottom: 1px solid %s; }\n", theme.Region)
+	fmt.Fprintf(&b, ".bar { display: inline-block; height: 10px; background: %s; }\n", theme.Gate)
+	b.WriteString(`</style>` + "\n")
+	b.WriteString(`</head>` + "\n")
+	b.WriteString(`<body>` + "\n")
+	b.WriteString(`<div class="diagram">` + diagram + `</div>` + "\n")
+	b.WriteString(`<p id="caption"></p>` + "\n")
+	b.WriteString(`<table id="state"></table>` + "\n")
+
+	// json.Marshal escapes <, > and & so that the data does not close the script.
+	b.WriteString(`<script type="application/json" id="simulation">` + string(data) + `</script>` + "\n")
+	b.WriteString(`<script>` + "\n")
+	b.WriteString(script)
+	b.WriteString(`</script>` + "\n")
+	b.WriteString(`</body>` + "\n")
+	b.WriteString(`</html>` + "\n")
+	return b.String(), nil
+}
+
+// columnRects returns the transparent rects over the layers of each row, which are clicked to show the state.
+func columnRects(layout *Layout, config Config) string {
+	var b strings.Builder
+	gap := config.WireGap - config.OpWidth
+	height := config.WireStartY + len(layout.Wires)*config.WireGap
+
+	var offset int
+	for r, row := range layout.Fold(config.Fold) {
+		lefts, widths, _ := columns(row, config)
+		for i := range row.Layers {
+			fmt.Fprintf(&b, `<rect class="layer" data-layer="%d" x="%d" y="%d" width="%d" height="%d" />`,
+				offset+i,
+				lefts[i]-gap/2, r*height,
+				widths[i]+gap, height,
+			)
+		}
+
+		offset += len(row.Layers)
+	}
+
+	return b.String()
+}
+
+const script = `const sim = JSON.parse(document.getElementById("simulation").textContent);
+const rects = document.querySelectorAll(".layer");
+
+function show(layer) {
+  rects.forEach(r => r.classList.toggle("selected", Number(r.dataset.layer) === layer));
+
+  const snapshot = sim.snapshots[layer];
+  document.getElementById("caption").textContent = "layer " + layer + " / " + (sim.snapshots.length - 1);
+
+  const table = document.getElementById("state");
+  table.replaceChildren();
+
+  const head = table.insertRow();
+  for (const name of [...sim.registers, "amplitude", "probability", ""]) {
+    const th = document.createElement("th");
+    th.textContent = name;
+    head.appendChild(th);
+  }
+
+  for (const a of snapshot.amplitudes || []) {
+    const row = table.insertRow();
+    for (const basis of a.basis) {
+      row.insertCell().textContent = basis;
+    }
+
+    const sign = a.imag < 0 ? "-" : "+";
+    row.insertCell().textContent = a.real.toFixed(4) + " " + sign + " " + Math.abs(a.imag).toFixed(4) + "i";
+    row.insertCell().textContent = a.probability.toFixed(4);
+
+    const bar = document.createElement("span");
+    bar.className = "bar";
+    bar.style.width = (a.probability * 200).toFixed(1) + "px";
+    row.insertCell().appendChild(bar);
+  }
+}
+
+rects.forEach(r => r.addEventListener("click", () => show(Number(r.dataset.layer))));
+if (sim.snapshots.length > 0) {
+  show(sim.snapshots.length - 1);
+}
+`
@@ -0,0 +1,157 @@
+package svg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RenderLaTeX returns the standalone LaTeX document of the layout drawn with quantikz.
+// A barrier is drawn as a slice across all wires, a global phase without qubits is a comment,
+// a conditional gate is connected to its first classical bit with a classical wire,
+// and a region of the control flow is a dashed gate group.
+func RenderLaTeX(layout *Layout) string {
+	rows := len(layout.Wires)
+	cols := len(layout.Layers) + 2
+
+	grid := make([][]string, rows)
+	for i, w := range layout.Wires {
+		grid[i] = make([]string, cols)
+		grid[i][0] = fmt.Sprintf(`\lstick{\texttt{%s}}`, escape(w.Name))
+		for j := 1; j < cols; j++ {
+			grid[i][j] = `\qw`
+			if w.Classical {
+				grid[i][j] = `\cw`
+			}
+		}
+	}
+
+	var comments []string
+	for j, layer := range layout.Layers {
+		col := j + 1
+		for _, op := range layer.Ops {
+			switch o := op.(type) {
+			case *Gate:
+				if len(o.Target) == 0 && len(o.Control)+len(o.NegControl) == 0 {
+					// gphase without qubits
+					comments = append(comments, fmt.Sprintf("%% %s", latexLabel(o)))
+					continue
+				}
+
+				if len(o.Target) == 0 {
+					// controlled gphase is a phase on the first control
+					top := slices.Min(append(slices.Clone(o.Control), o.NegControl...))
+					for _, c := range o.Control {
+						grid[c][col] = fmt.Sprintf(`\ctrl{%d}`, top-c)
+					}
+
+					for _, c := range o.NegControl {
+						grid[c][col] = fmt.Sprintf(`\octrl{%d}`, top-c)
+					}
+
+					grid[top][col] = fmt.Sprintf(`\phase{%s}`, latexLabel(o))
+					continue
+				}
+
+				top := slices.Min(o.Target)
+				switch {
+				case oplus(o):
+					grid[top][col] = `\targ{}`
+				case CZ(o):
+					grid[top][col] = `\control{}`
+				case Swap(o):
+					bottom := slices.Max(o.Target)
+					grid[top][col] = fmt.Sprintf(`\swap{%d}`, bottom-top)
+					grid[bottom][col] = `\targX{}`
+				case len(o.Target) > 1:
+					grid[top][col] = fmt.Sprintf(`\gate[wires=%d]{%s}`, slices.Max(o.Target)-top+1, latexLabel(o))
+				default:
+					grid[top][col] = fmt.Sprintf(`\gate{%s}`, latexLabel(o))
+				}
+
+				for _, c := range o.Control {
+					grid[c][col] = fmt.Sprintf(`\ctrl{%d}`, top-c)
+				}
+
+				for _, c := range o.NegControl {
+					grid[c][col] = fmt.Sprintf(`\octrl{%d}`, top-c)
+				}
+
+				if len(o.Bit) > 0 {
+					grid[top][col] += fmt.Sprintf(` \vcw{%d}`, o.Bit[0]-top)
+				}
+			case *Reset:
+				for _, w := range o.Wire {
+					grid[w][col] = `\gate{\lvert 0\rangle}`
+				}
+			case *Subroutine:
+				top := slices.Min(o.Wire)
+				grid[top][col] = fmt.Sprintf(`\gate[wires=%d]{%s}`, slices.Max(o.Wire)-top+1, escape(o.Name))
+			case *Measurement:
+				for _, w := range o.Wire {
+					grid[w][col] = `\meter{}`
+					for _, t := range o.Target {
+						grid[w][col] += fmt.Sprintf(` \vcw{%d}`, t-w)
+					}
+				}
+			case *Barrier:
+				grid[slices.Min(o.Wire)][col] += ` \slice{}`
+			}
+		}
+	}
+
+	// regions are the dashed groups on their top-left cell
+	for _, r := range layout.Regions {
+		top := slices.Min(r.Wire)
+		grid[top][r.Begin+1] += fmt.Sprintf(` \gategroup[wires=%d,steps=%d,style={dashed,rounded corners,inner xsep=2pt},background]{%s}`,
+			slices.Max(r.Wire)-top+1,
+			r.End-r.Begin,
+			escape(r.Label),
+		)
+	}
+
+	var b strings.Builder
+	b.WriteString(`\documentclass[border=2pt]{standalone}` + "\n")
+	b.WriteString(`\usepackage{quantikz}` + "\n")
+	b.WriteString(`\begin{document}` + "\n")
+	for _, c := range comments {
+		b.WriteString(c + "\n")
+	}
+
+	b.WriteString(`\begin{quantikz}` + "\n")
+	for i, row := range grid {
+		b.WriteString(strings.Join(row, " & "))
+		if i < len(grid)-1 {
+			b.WriteString(` \\`)
+		}
+
+		b.WriteString("\n")
+	}
+
+	b.WriteString(`\end{quantikz}` + "\n")
+	b.WriteString(`\end{document}` + "\n")
+	return b.String()
+}
+
+// latexLabel returns the label of the gate in math mode.
+func latexLabel(g *Gate) string {
+	c := *g
+	c.Name = escape(g.Name)
+	return c.label(DefaultConfig.Precision, `\pi`, `^{\dagger}`, `^{%s}`)
+}
+
+// escape returns the text with the LaTeX special characters escaped.
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\textbackslash{}`,
+		`$`, `\$`,
+		`_`, `\_`,
+		`&`, `\&`,
+		`%`, `\%`,
+		`#`, `\#`,
+		`{`, `\{`,
+		`}`, `\}`,
+		`^`, `\^{}`,
+		`~`, `\~{}`,
+	).Replace(s)
+}
@@ -0,0 +1,59 @@
+package svg_test
+
+import (
+	"fmt"
+
+	"github.com/itsubaki/qasm/svg"
+)
+
+func ExampleRenderLaTeX() {
+	layout, err := svg.Parse(`
+	qubit[3] q;
+	bit[2] c;
+	h q[0];
+	ctrl @ x q[0], q[1];
+	negctrl @ ctrl @ u q[1], q[0], q[2];
+	barrier q;
+	measure q[0] -> c[0];
+	if (c[0]) { z q[2]; }
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(svg.RenderLaTeX(layout))
+
+	// Output:
+	// \documentclass[border=2pt]{standalone}
+	// \usepackage{quantikz}
+	// \begin{document}
+	// \begin{quantikz}
+	// \lstick{\texttt{q[0]}} & \gate{H} & \ctrl{1} & \ctrl{2} & \qw \slice{} & \meter{} \vcw{3} & \qw & \qw \\
+	// \lstick{\texttt{q[1]}} & \qw & \targ{} & \octrl{1} & \qw & \qw & \qw & \qw \\
+	// \lstick{\texttt{q[2]}} & \qw & \qw & \gate{U} & \qw & \qw & \gate{Z} \vcw{1} & \qw \\
+	// \lstick{\texttt{c[0]}} & \cw & \cw & \cw & \cw & \cw & \cw & \cw \\
+	// \lstick{\texttt{c[1]}} & \cw & \cw & \cw & \cw & \cw & \cw & \cw
+	// \end{quantikz}
+	// \end{document}
+}
+
+func ExampleRenderLaTeX_multi() {
+	layout, err := svg.Parse(`qubit[3] q; ctrl @ qft q[2], q[0], q[1]; U(1, 2, 3) $0;`)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(svg.RenderLaTeX(layout))
+
+	// Output:
+	// \documentclass[border=2pt]{standalone}
+	// \usepackage{quantikz}
+	// \begin{document}
+	// \begin{quantikz}
+	// \lstick{\texttt{\$0}} & \qw & \gate{U(1, 2, 3)} & \qw \\
+	// \lstick{\texttt{q[0]}} & \gate[wires=2]{QFT} & \qw & \qw \\
+	// \lstick{\texttt{q[1]}} & \qw & \qw & \qw \\
+	// \lstick{\texttt{q[2]}} & \ctrl{-2} & \qw & \qw
+	// \end{quantikz}
+	// \end{document}
+}
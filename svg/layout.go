@@ -1,11 +1,53 @@
 package svg
 
 type Layout struct {
-	Wires  []Wire  `json:"wires"`
-	Layers []Layer `json:"layers"`
+	Wires    []Wire   `json:"wires"`
+	Layers   []Layer  `json:"layers"`
+	Regions  []Region `json:"regions,omitempty"`
+	reserved bool
+	depth    int
+}
+
+// Region is the layers from Begin to End (exclusive) reserved for the group.
+// Depth is the number of the regions enclosing it.
+type Region struct {
+	Label string `json:"label"`
+	Wire  []int  `json:"wire"`
+	Begin int    `json:"begin"`
+	End   int    `json:"end"`
+	Depth int    `json:"depth,omitempty"`
+}
+
+// NewRegion places the ops of the group in the new layers reserved for the region.
+// The ops before and after the region are never placed in its layers.
+func (l *Layout) NewRegion(g *Group) {
+	begin := len(l.Layers)
+
+	l.reserved = true
+	l.depth++
+	for _, op := range g.Ops {
+		l.Add(op)
+	}
+	l.depth--
+	l.reserved = true
+
+	if len(l.Layers) == begin {
+		return
+	}
+
+	l.Regions = append(l.Regions, Region{
+		Label: g.Label,
+		Wire:  g.Wires(),
+		Begin: begin,
+		End:   len(l.Layers),
+		Depth: l.depth,
+	})
 }
 
 func (l *Layout) NewLayer(ops []Op, separated ...bool) {
+	// the reserved region starts from this layer
+	l.reserved = false
+
 	wires := make(map[int]bool)
 	for _, op := range ops {
 		for _, w := range op.Wires() {
@@ -77,43 +119,85 @@ func NewLayout(circuit *Circuit) *Layout {
 	}
 
 	for _, cur := range circuit.Ops {
-		// controlled gates must be in their own layer
-		if g, ok := cur.(*Gate); ok && len(g.Control) > 0 {
-			layout.NewLayer([]Op{cur}, true)
-			continue
-		}
+		layout.Add(cur)
+	}
 
-		if s, ok := cur.(*Subroutine); ok && len(s.Wire) > 0 {
-			layout.NewLayer([]Op{cur}, true)
-			continue
-		}
+	return layout
+}
 
-		// arrow measurements must be in their own layer
-		if m, ok := cur.(*Measurement); ok && len(m.Target) > 0 {
-			layout.NewLayer([]Op{cur}, true)
-			continue
-		}
+// Add places the op in the last layer if possible, or in a new layer.
+func (l *Layout) Add(cur Op) {
+	if g, ok := cur.(*Group); ok {
+		l.NewRegion(g)
+		return
+	}
 
-		// barriers must be in their own layer
-		if _, ok := cur.(*Barrier); ok {
-			layout.NewLayer([]Op{cur}, true)
-			continue
-		}
+	// controlled, conditional, multi-qubit and global phase gates must be in their own layer
+	if g, ok := cur.(*Gate); ok && (len(g.Control) > 0 || len(g.NegControl) > 0 || len(g.Bit) > 0 || len(g.Target) != 1) {
+		l.NewLayer([]Op{cur}, true)
+		return
+	}
+
+	if s, ok := cur.(*Subroutine); ok && len(s.Wire) > 0 {
+		l.NewLayer([]Op{cur}, true)
+		return
+	}
+
+	// arrow measurements must be in their own layer
+	if m, ok := cur.(*Measurement); ok && len(m.Target) > 0 {
+		l.NewLayer([]Op{cur}, true)
+		return
+	}
 
-		last := len(layout.Layers) - 1
-		if last < 0 {
-			// if there are no layers yet, create the first layer
-			layout.NewLayer([]Op{cur})
-			continue
+	// barriers must be in their own layer
+	if _, ok := cur.(*Barrier); ok {
+		l.NewLayer([]Op{cur}, true)
+		return
+	}
+
+	last := len(l.Layers) - 1
+	if last < 0 || l.reserved {
+		// if there are no layers yet or the region begins or ends, create a new layer
+		l.NewLayer([]Op{cur})
+		return
+	}
+
+	if l.Layers[last].Conflicts(cur) {
+		l.NewLayer([]Op{cur})
+		return
+	}
+
+	l.Layers[last].Add(cur)
+}
+
+// Fold returns the layouts of the rows of n layers each.
+// The regions across the rows are split into each row.
+// The n of 0 or less returns the layout itself.
+func (l *Layout) Fold(n int) []*Layout {
+	if n <= 0 || len(l.Layers) <= n {
+		return []*Layout{l}
+	}
+
+	var rows []*Layout
+	for begin := 0; begin < len(l.Layers); begin += n {
+		end := min(begin+n, len(l.Layers))
+
+		row := &Layout{
+			Wires:  l.Wires,
+			Layers: l.Layers[begin:end],
 		}
 
-		if layout.Layers[last].Conflicts(cur) {
-			layout.NewLayer([]Op{cur})
-			continue
+		for _, r := range l.Regions {
+			if r.End <= begin || r.Begin >= end {
+				continue
+			}
+
+			r.Begin, r.End = max(r.Begin, begin)-begin, min(r.End, end)-begin
+			row.Regions = append(row.Regions, r)
 		}
 
-		layout.Layers[last].Add(cur)
+		rows = append(rows, row)
 	}
 
-	return layout
+	return rows
 }
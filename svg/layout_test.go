@@ -13,8 +13,8 @@ func ExampleNewLayout() {
 			{Name: "q1"},
 			{Name: "q2"},
 			{Name: "q3"},
-			{Name: "c0"},
-			{Name: "c1"},
+			{Name: "c0", Classical: true},
+			{Name: "c1", Classical: true},
 		},
 		Ops: []svg.Op{
 			&svg.Gate{
@@ -141,5 +141,83 @@ func ExampleNewLayout() {
 	fmt.Println(layout.Wires)
 
 	// Output:
-	// [{q0} {q1} {q2} {q3} {c0} {c1}]
+	// [{q0 false} {q1 false} {q2 false} {q3 false} {c0 true} {c1 true}]
+}
+
+func ExampleLayout_NewRegion() {
+	circuit := &svg.Circuit{
+		Wires: []svg.Wire{
+			{Name: "q0"},
+			{Name: "q1"},
+			{Name: "q2"},
+		},
+		Ops: []svg.Op{
+			&svg.Gate{Name: "H", Target: []int{0}},
+			&svg.Group{
+				Label: "for i in [0:1]",
+				Ops: []svg.Op{
+					&svg.Gate{Name: "X", Target: []int{1}},
+					&svg.Group{
+						Label: "box",
+						Ops: []svg.Op{
+							&svg.Gate{Name: "Y", Target: []int{1}},
+							&svg.Gate{Name: "Z", Target: []int{2}},
+						},
+					},
+				},
+			},
+			&svg.Gate{Name: "H", Target: []int{2}},
+			&svg.Group{Label: "while (c)"},
+		},
+	}
+
+	layout := svg.NewLayout(circuit)
+	for i, layer := range layout.Layers {
+		for _, op := range layer.Ops {
+			fmt.Println(i, op.(*svg.Gate).Name)
+		}
+	}
+
+	for _, r := range layout.Regions {
+		fmt.Printf("%q %v [%d, %d) %d\n", r.Label, r.Wire, r.Begin, r.End, r.Depth)
+	}
+
+	// Output:
+	// 0 H
+	// 1 X
+	// 2 Y
+	// 2 Z
+	// 3 H
+	// "box" [1 2] [2, 3) 1
+	// "for i in [0:1]" [1 2] [1, 3) 0
+}
+
+func ExampleLayout_Fold() {
+	layout := &svg.Layout{
+		Wires: []svg.Wire{{Name: "q"}},
+		Layers: []svg.Layer{
+			{Ops: []svg.Op{&svg.Gate{Name: "H", Target: []int{0}}}},
+			{Ops: []svg.Op{&svg.Gate{Name: "X", Target: []int{0}}}},
+			{Ops: []svg.Op{&svg.Gate{Name: "Y", Target: []int{0}}}},
+			{Ops: []svg.Op{&svg.Gate{Name: "Z", Target: []int{0}}}},
+			{Ops: []svg.Op{&svg.Gate{Name: "S", Target: []int{0}}}},
+		},
+		Regions: []svg.Region{
+			{Label: "box", Wire: []int{0}, Begin: 1, End: 4},
+		},
+	}
+
+	for _, row := range layout.Fold(2) {
+		var names []string
+		for _, layer := range row.Layers {
+			names = append(names, layer.Ops[0].(*svg.Gate).Name)
+		}
+
+		fmt.Println(names, row.Regions)
+	}
+
+	// Output:
+	// [H X] [{box [0] 1 2 0}]
+	// [Y Z] [{box [0] 0 2 0}]
+	// [S] []
 }
@@ -2,34 +2,24 @@ package svg
 
 import (
 	"fmt"
+	"html"
+	"slices"
 	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
-type Config struct {
-	WireGap    int
-	WireStartX int
-	WireStartY int
-	OpWidth    int
-	OpHeight   int
-	OpRX       int
-	FontSize   int
-}
-
-var DefaultConfig = Config{
-	WireGap:    56,
-	WireStartX: 80,
-	WireStartY: 42,
-	OpWidth:    36,
-	OpHeight:   36,
-	OpRX:       8,
-	FontSize:   13,
-}
-
 func Render(layout *Layout, config Config) string {
-	// the size of the SVG canvas
-	width := config.WireStartX + len(layout.Layers)*config.WireGap + config.WireGap/2
-	height := config.WireStartY + len(layout.Wires)*config.WireGap
+	// the rows are stacked vertically
+	var body strings.Builder
+	var width, height int
+	for _, row := range layout.Fold(config.Fold) {
+		c := config
+		c.WireStartY += height
+
+		width = max(width, renderRow(&body, row, c))
+		height += config.WireStartY + len(layout.Wires)*config.WireGap
+	}
 
 	// svg
 	var b strings.Builder
@@ -40,70 +30,83 @@ func Render(layout *Layout, config Config) string {
 
 	// style
 	b.WriteString(`<style>`)
-	fmt.Fprintf(&b, `.gate-label { font-family: ui-monospace, monospace; font-size: %dpx; font-weight: 600; }`, config.FontSize)
-	fmt.Fprintf(&b, `.wire-label { font-family: ui-monospace, monospace; font-size: %dpx; font-weight: 500; }`, config.FontSize)
+	fmt.Fprintf(&b, `.gate-label { font-family: %s; font-size: %dpx; font-weight: 600; }`, config.FontFamily, config.FontSize)
+	fmt.Fprintf(&b, `.wire-label { font-family: %s; font-size: %dpx; font-weight: 500; }`, config.FontFamily, config.FontSize)
+	fmt.Fprintf(&b, `.cond-label { font-family: %s; font-size: %dpx; font-weight: 500; }`, config.FontFamily, config.FontSize-3)
+	fmt.Fprintf(&b, `.note-label { font-family: %s; font-size: %dpx; font-weight: 500; }`, config.FontFamily, config.FontSize-3)
+	fmt.Fprintf(&b, `.region-label { font-family: %s; font-size: %dpx; font-weight: 500; }`, config.FontFamily, config.FontSize-3)
 	b.WriteString(`</style>`)
 
+	if config.Theme.Background != "" {
+		fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s" />`, config.Theme.Background)
+	}
+
+	b.WriteString(body.String())
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// renderRow draws the wires and the layers of the row, and returns the width of the row.
+func renderRow(b *strings.Builder, layout *Layout, config Config) int {
+	theme := config.Theme
+	lefts, widths, width := columns(layout, config)
+
 	// wires
 	for i, w := range layout.Wires {
 		y := config.WireStartY + i*config.WireGap
-		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#4b5563" stroke-width="2" />`,
-			config.WireStartX, y,
-			width, y,
-		)
+		if w.Classical {
+			// double line
+			for _, dy := range []int{-2, 2} {
+				fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="%g" />`,
+					config.WireStartX, y+dy,
+					width, y+dy,
+					theme.Wire, config.WireStroke/2,
+				)
+			}
+		} else {
+			fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="%g" />`,
+				config.WireStartX, y,
+				width, y,
+				theme.Wire, config.WireStroke,
+			)
+		}
 
-		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="#4b5563" class="wire-label">%s</text>`,
+		fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end" fill="%s" class="wire-label">%s</text>`,
 			config.WireStartX-8, y+5,
+			theme.Text,
 			w.Name,
 		)
 	}
 
+	// regions are drawn from the outermost one
+	for _, r := range slices.Backward(layout.Regions) {
+		renderRegion(b, r, lefts, widths, config)
+	}
+
 	// ops
-	x := config.WireStartX + config.WireGap/2
-	for _, layer := range layout.Layers {
+	for i, layer := range layout.Layers {
+		// the ops are centered in the layer
+		x := lefts[i] + widths[i]/2 - config.OpWidth/2
 		for _, op := range layer.Ops {
 			switch o := op.(type) {
 			case *Gate:
-				// wires
-				for _, c := range o.Control {
-					for _, t := range o.Target {
-						cy := config.WireStartY + c*config.WireGap
-						ty := config.WireStartY + t*config.WireGap
-
-						fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#0ea5e9" stroke-width="2" />`,
-							x+config.OpWidth/2, cy,
-							x+config.OpWidth/2, ty,
-						)
+				renderGate(b, o, x+config.OpWidth/2, config)
+			case *Reset:
+				for _, w := range o.Wire {
+					y := config.WireStartY + w*config.WireGap
+					bw := BoxWidth("|0⟩", config)
 
-						fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="6" fill="#0ea5e9" />`,
-							x+config.OpWidth/2, cy,
-						)
-					}
-				}
+					fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="%s" stroke="%s" stroke-width="%g" />`,
+						x+config.OpWidth/2-bw/2, y-config.OpHeight/2,
+						bw, config.OpHeight, config.OpRX,
+						theme.GateFill, theme.Reset, config.OpStroke,
+					)
 
-				// operation box
-				minY, maxY := o.Target[0], o.Target[0]
-				for _, t := range o.Target {
-					minY, maxY = min(minY, t), max(maxY, t)
+					fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="middle" fill="%s" class="gate-label">|0⟩</text>`,
+						x+config.OpWidth/2, y+5,
+						theme.GateText,
+					)
 				}
-
-				topY := config.WireStartY + minY*config.WireGap
-				bottomY := config.WireStartY + maxY*config.WireGap
-				centerY := (topY + bottomY) / 2
-				height := (bottomY - topY) + config.OpHeight
-
-				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="#1f2937" stroke="#0ea5e9" stroke-width="2" />`,
-					x,
-					centerY-height/2,
-					config.OpWidth,
-					height,
-					config.OpRX,
-				)
-
-				fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" fill="#e5e7eb" class="gate-label">%s</text>`,
-					x+config.OpWidth/2, centerY+config.OpHeight/2-13,
-					o.Name,
-				)
 			case *Subroutine:
 				// operation box
 				minY, maxY := o.Wire[0], o.Wire[0]
@@ -116,16 +119,20 @@ func Render(layout *Layout, config Config) string {
 				centerY := (topY + bottomY) / 2
 				height := (bottomY - topY) + config.OpHeight
 
-				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="#1f2937" stroke="#8b5cf6" stroke-width="2" />`,
-					x,
+				w := BoxWidth(o.Name, config)
+
+				fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="%s" stroke="%s" stroke-width="%g" />`,
+					x+config.OpWidth/2-w/2,
 					centerY-height/2,
-					config.OpWidth,
+					w,
 					height,
 					config.OpRX,
+					theme.GateFill, theme.Subroutine, config.OpStroke,
 				)
 
-				fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" fill="#e5e7eb" class="gate-label">%s</text>`,
+				fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="middle" fill="%s" class="gate-label">%s</text>`,
 					x+config.OpWidth/2, centerY+config.OpHeight/2-13,
+					theme.GateText,
 					o.Name,
 				)
 			case *Measurement:
@@ -135,15 +142,17 @@ func Render(layout *Layout, config Config) string {
 						cy := config.WireStartY + w*config.WireGap
 						ty := config.WireStartY + t*config.WireGap
 
-						fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#10b981" stroke-width="2" />`,
+						fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="%g" />`,
 							x+config.OpWidth/2, cy+config.OpHeight/2,
 							x+config.OpWidth/2, ty-4,
+							theme.Measure, config.OpStroke,
 						)
 
-						fmt.Fprintf(&b, `<polygon points="%d,%d %d,%d %d,%d" fill="#10b981" />`,
+						fmt.Fprintf(b, `<polygon points="%d,%d %d,%d %d,%d" fill="%s" />`,
 							x+config.OpWidth/2, ty,
 							x+config.OpWidth/2-4, ty-6,
 							x+config.OpWidth/2+4, ty-6,
+							theme.Measure,
 						)
 					}
 				}
@@ -151,19 +160,22 @@ func Render(layout *Layout, config Config) string {
 				// operation box
 				for _, w := range o.Wire {
 					y := config.WireStartY + w*config.WireGap
-					fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="#1f2937" stroke="#10b981" stroke-width="2" />`,
+					fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="%s" stroke="%s" stroke-width="%g" />`,
 						x, y-config.OpHeight/2,
 						config.OpWidth, config.OpHeight, config.OpRX,
+						theme.GateFill, theme.Measure, config.OpStroke,
 					)
 
-					fmt.Fprintf(&b, `<path d="M %d %d A 10 10 0 0 1 %d %d" fill="none" stroke="#10b981" stroke-width="2" />`,
+					fmt.Fprintf(b, `<path d="M %d %d A 10 10 0 0 1 %d %d" fill="none" stroke="%s" stroke-width="%g" />`,
 						x+10, y,
 						x+30, y,
+						theme.Measure, config.OpStroke,
 					)
 
-					fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#10b981" stroke-width="2" />`,
+					fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="%g" />`,
 						x+20, y,
 						x+26, y-10,
+						theme.Measure, config.OpStroke,
 					)
 				}
 			case *Barrier:
@@ -177,9 +189,10 @@ func Render(layout *Layout, config Config) string {
 						y1 := config.WireStartY + start*config.WireGap
 						y2 := config.WireStartY + prev*config.WireGap
 
-						fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#f59e0b" stroke-width="2" stroke-dasharray="4 2" />`,
+						fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="%g" stroke-dasharray="4 2" />`,
 							x+config.OpWidth/2, y1-config.OpHeight/2,
 							x+config.OpWidth/2, y2+config.OpHeight/2,
+							theme.Barrier, config.OpStroke,
 						)
 
 						if i < len(wires) {
@@ -193,11 +206,234 @@ func Render(layout *Layout, config Config) string {
 				}
 			}
 		}
+	}
+
+	return width
+}
 
-		// next layer
-		x += config.WireGap
+// columns returns the left and the width of each layer, and the width of the row.
+func columns(layout *Layout, config Config) ([]int, []int, int) {
+	// the width of the row
+	widths := make([]int, len(layout.Layers))
+	for i, layer := range layout.Layers {
+		widths[i] = LayerWidth(layer, config)
 	}
 
-	b.WriteString(`</svg>`)
-	return b.String()
+	// the regions are wide enough for the labels, from the innermost one
+	gap := config.WireGap - config.OpWidth
+	for _, r := range layout.Regions {
+		span := -8 * r.Depth
+		for i := r.Begin; i < r.End; i++ {
+			span += widths[i] + gap
+		}
+
+		if need := RegionLabelWidth(r.Label, config) + 16; need > span {
+			widths[r.End-1] += need - span
+		}
+	}
+
+	lefts := make([]int, len(layout.Layers))
+	width := config.WireStartX + config.WireGap/2
+	for i := range layout.Layers {
+		lefts[i] = width
+		width += widths[i] + gap
+	}
+
+	return lefts, widths, width
+}
+
+// BoxWidth returns the width of the box that fits the label.
+func BoxWidth(label string, config Config) int {
+	// a monospace glyph is about 0.6 em wide.
+	w := utf8.RuneCountInString(label)*config.FontSize*3/5 + 16
+	return max(config.OpWidth, w)
+}
+
+// RegionLabelWidth returns the width of the label of the region including its background.
+func RegionLabelWidth(label string, config Config) int {
+	return utf8.RuneCountInString(label)*(config.FontSize-3)*3/5 + 8
+}
+
+// LayerWidth returns the width of the widest box in the layer.
+func LayerWidth(layer Layer, config Config) int {
+	width := config.OpWidth
+	for _, op := range layer.Ops {
+		switch o := op.(type) {
+		case *Gate:
+			width = max(width, BoxWidth(o.Label(config.Precision), config))
+		case *Reset:
+			width = max(width, BoxWidth("|0⟩", config))
+		case *Subroutine:
+			width = max(width, BoxWidth(o.Name, config))
+		}
+	}
+
+	return width
+}
+
+// renderRegion draws the dashed frame around the layers of the region and its label on the top edge.
+// The label of the nested region is aligned to the right so that it does not overlap the enclosing one.
+func renderRegion(b *strings.Builder, r Region, lefts, widths []int, config Config) {
+	gap := config.WireGap - config.OpWidth
+	inset := 4 * r.Depth
+
+	x1 := lefts[r.Begin] - gap/2 + inset
+	x2 := lefts[r.End-1] + widths[r.End-1] + gap/2 - inset
+	y1 := config.WireStartY + slices.Min(r.Wire)*config.WireGap - config.WireGap/2 + 4 + inset
+	y2 := config.WireStartY + slices.Max(r.Wire)*config.WireGap + config.WireGap/2 - 4 - inset
+
+	fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" rx="6" fill="none" stroke="%s" stroke-width="%g" stroke-dasharray="6 4" />`,
+		x1, y1,
+		x2-x1, y2-y1,
+		config.Theme.Region, config.OpStroke*3/4,
+	)
+
+	// the label on a background so that the frame does not strike through it
+	w := RegionLabelWidth(r.Label, config)
+	lx := x1 + 8
+	if r.Depth%2 == 1 {
+		lx = x2 - 8 - w
+	}
+
+	fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" />`,
+		lx, y1-7,
+		w, 14,
+		config.Theme.Surface,
+	)
+
+	fmt.Fprintf(b, `<text x="%d" y="%d" fill="%s" class="region-label">%s</text>`,
+		lx+4, y1+4,
+		config.Theme.RegionText,
+		html.EscapeString(r.Label),
+	)
+}
+
+// renderGate draws the gate centered at cx.
+func renderGate(b *strings.Builder, o *Gate, cx int, config Config) {
+	theme := config.Theme
+	y := func(wire int) int {
+		return config.WireStartY + wire*config.WireGap
+	}
+
+	var qubits []int
+	qubits = append(qubits, o.Control...)
+	qubits = append(qubits, o.NegControl...)
+	qubits = append(qubits, o.Target...)
+
+	// the line through the controls and the targets
+	if len(qubits) > 1 {
+		fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="%g" />`,
+			cx, y(slices.Min(qubits)),
+			cx, y(slices.Max(qubits)),
+			theme.Gate, config.OpStroke,
+		)
+	}
+
+	for _, c := range o.Control {
+		fmt.Fprintf(b, `<circle cx="%d" cy="%d" r="6" fill="%s" />`, cx, y(c), theme.Gate)
+	}
+
+	for _, c := range o.NegControl {
+		fmt.Fprintf(b, `<circle cx="%d" cy="%d" r="6" fill="%s" stroke="%s" stroke-width="%g" />`, cx, y(c), theme.Surface, theme.Gate, config.OpStroke)
+	}
+
+	// classical conditions
+	if len(qubits) > 0 {
+		for _, c := range o.Bit {
+			for _, dx := range []int{-2, 2} {
+				fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="%g" />`,
+					cx+dx, y(qubits[len(qubits)-1]),
+					cx+dx, y(c),
+					theme.Gate, config.OpStroke/2,
+				)
+			}
+
+			fmt.Fprintf(b, `<circle cx="%d" cy="%d" r="4" fill="%s" />`, cx, y(c), theme.Gate)
+		}
+
+		if len(o.Bit) > 0 && o.Cond != "" {
+			// the label under the last bit
+			fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="middle" fill="%s" class="cond-label">%s</text>`,
+				cx, y(o.Bit[len(o.Bit)-1])+18,
+				theme.Text,
+				html.EscapeString(o.Cond),
+			)
+		}
+	}
+
+	label := o.Label(config.Precision)
+	switch {
+	case len(o.Target) == 0:
+		// gphase is a note above the controls or the wires
+		ny := config.WireStartY - config.OpHeight/2 - 6
+		if len(qubits) > 0 {
+			ny = y(slices.Min(qubits)) - 12
+		}
+
+		fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="middle" fill="%s" class="note-label">%s</text>`,
+			cx, ny,
+			theme.Text,
+			html.EscapeString(label),
+		)
+	case Swap(o):
+		for _, t := range o.Target {
+			fmt.Fprintf(b, `<path d="M %d %d L %d %d M %d %d L %d %d" stroke="%s" stroke-width="%g" />`,
+				cx-7, y(t)-7, cx+7, y(t)+7,
+				cx-7, y(t)+7, cx+7, y(t)-7,
+				theme.Gate, config.OpStroke,
+			)
+		}
+	case CZ(o):
+		fmt.Fprintf(b, `<circle cx="%d" cy="%d" r="6" fill="%s" />`, cx, y(o.Target[0]), theme.Gate)
+	default:
+		// a tall box for each run of the contiguous targets
+		w := BoxWidth(label, config)
+		for _, run := range Runs(o.Target) {
+			topY, bottomY := y(run[0]), y(run[len(run)-1])
+			centerY := (topY + bottomY) / 2
+			height := (bottomY - topY) + config.OpHeight
+
+			fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="%s" stroke="%s" stroke-width="%g" />`,
+				cx-w/2,
+				centerY-height/2,
+				w,
+				height,
+				config.OpRX,
+				theme.GateFill, theme.Gate, config.OpStroke,
+			)
+
+			fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="middle" fill="%s" class="gate-label">%s</text>`,
+				cx, centerY+config.OpHeight/2-13,
+				theme.GateText,
+				html.EscapeString(label),
+			)
+		}
+	}
+}
+
+// Swap returns true if the gate is drawn as a swap.
+func Swap(g *Gate) bool {
+	return g.Name == "SWAP" && len(g.Target) == 2 && len(g.Params) == 0 && len(g.Modifiers) == 0
+}
+
+// CZ returns true if the gate is drawn as a controlled-Z with dots on every qubit.
+func CZ(g *Gate) bool {
+	return g.Name == "Z" && len(g.Target) == 1 && len(g.Control)+len(g.NegControl) > 0 && len(g.Modifiers) == 0
+}
+
+// Runs returns the runs of the contiguous wires in ascending order.
+func Runs(wires []int) [][]int {
+	sorted := slices.Sorted(slices.Values(wires))
+
+	var runs [][]int
+	for i, w := range sorted {
+		if i > 0 && w == sorted[i-1]+1 {
+			runs[len(runs)-1] = append(runs[len(runs)-1], w)
+			continue
+		}
+
+		runs = append(runs, []int{w})
+	}
+
+	return runs
 }
@@ -2,6 +2,8 @@ package svg_test
 
 import (
 	"fmt"
+	"strings"
+	"testing"
 
 	"github.com/itsubaki/qasm/svg"
 )
@@ -46,3 +48,43 @@ func ExampleRender() {
 	// Output:
 	// <svg ... </svg>
 }
+
+func TestRender_config(t *testing.T) {
+	layout, err := svg.Parse(`qubit q; h q; x q; y q; z q; s q;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dark := svg.DefaultConfig
+	dark.Theme = svg.DarkTheme
+
+	folded := svg.DefaultConfig
+	folded.Fold = 2
+
+	cases := []struct {
+		config   svg.Config
+		contains []string
+	}{
+		{
+			config:   svg.DefaultConfig,
+			contains: []string{`height="98"`, `fill="#1f2937" stroke="#0ea5e9" stroke-width="2"`},
+		},
+		{
+			config:   dark,
+			contains: []string{`<rect width="100%" height="100%" fill="#0f172a" />`, `fill="#1e293b" stroke="#38bdf8"`},
+		},
+		{
+			config:   folded,
+			contains: []string{`height="294"`, `y1="42"`, `y1="140"`, `y1="238"`},
+		},
+	}
+
+	for _, c := range cases {
+		got := svg.Render(layout, c.config)
+		for _, s := range c.contains {
+			if !strings.Contains(got, s) {
+				t.Errorf("%q not in %q", s, got)
+			}
+		}
+	}
+}
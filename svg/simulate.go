@@ -0,0 +1,242 @@
+package svg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/itsubaki/q"
+	"github.com/itsubaki/qasm/environ"
+	xparser "github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+// Simulation is the layout and the state after each layer of it.
+// Registers are the qubit registers in the order of env.Index().
+type Simulation struct {
+	Layout    *Layout    `json:"-"`
+	Registers []string   `json:"registers"`
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+// Snapshot is the state after the layer.
+type Snapshot struct {
+	Layer      int         `json:"layer"`
+	Amplitudes []Amplitude `json:"amplitudes"`
+}
+
+// Amplitude is the amplitude of the basis state.
+// Basis is the binary string of each register.
+type Amplitude struct {
+	Basis       []string `json:"basis"`
+	Real        float64  `json:"real"`
+	Imag        float64  `json:"imag"`
+	Probability float64  `json:"probability"`
+}
+
+// step is the execution of the statement that adds the ops.
+type step struct {
+	id       int
+	position visitor.Position
+}
+
+// Simulate returns the state after each layer of the layout of the input text.
+// The states are taken from the run of the visitor, where the ops are applied in the order of the layers.
+// The control flow is unrolled and the subroutines are expanded, and while and switch are not supported.
+// The layers of an op that is applied at once such as the broadcast over registers share the state after it.
+func Simulate(text string, opt ...Option) (*Simulation, error) {
+	program, err := xparser.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var subroutines []string
+	for _, s := range program.AllStatementOrScope() {
+		if s.Statement() != nil && s.Statement().DefStatement() != nil {
+			subroutines = append(subroutines, s.Statement().DefStatement().Identifier().GetText())
+		}
+	}
+
+	circuit, err := Build(program, slices.Concat(opt, []Option{WithMode(ModeUnroll), WithExpand(subroutines...)})...)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := NewLayout(circuit)
+	conds := make(map[Op]bool)
+	ops, err := unroll(circuit.Ops, conds, false)
+	if err != nil {
+		return nil, err
+	}
+
+	qsim := q.New()
+	env := environ.New()
+	o := &observer{
+		qsim:  qsim,
+		env:   env,
+		steps: schedule(circuit, layout, ops, conds),
+	}
+
+	if err := visitor.New(qsim, env, visitor.WithObserver(o)).Run(program); err != nil {
+		return nil, err
+	}
+
+	for _, s := range o.steps[o.next:] {
+		if !s.cond {
+			return nil, fmt.Errorf("layer %d: not applied in the run", s.layer)
+		}
+	}
+
+	o.snapshot(len(layout.Layers))
+	return &Simulation{
+		Layout:    layout,
+		Registers: env.QubitOrder,
+		Snapshots: zeros(o.snapshots, env),
+	}, nil
+}
+
+// unroll returns the ops of the groups in order.
+// The ops of while and switch are rejected since their bodies are drawn once.
+// The ops of the conditional groups are added to conds.
+func unroll(ops []Op, conds map[Op]bool, cond bool) ([]Op, error) {
+	var list []Op
+	for _, op := range ops {
+		switch o := op.(type) {
+		case *Group:
+			if strings.HasPrefix(o.Label, "while") || strings.HasPrefix(o.Label, "switch") {
+				return nil, fmt.Errorf("unroll %q: %w", o.Label, visitor.ErrNotImplemented)
+			}
+
+			inner, err := unroll(o.Ops, conds, cond || strings.HasPrefix(o.Label, "if"))
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, inner...)
+		case *Subroutine:
+			return nil, fmt.Errorf("unsupported subroutine %q: expand it", o.Name)
+		default:
+			if cond {
+				conds[op] = true
+			}
+
+			list = append(list, op)
+		}
+	}
+
+	return list, nil
+}
+
+// pending is the step of the ops that is not applied yet.
+// Layer is the first layer of the ops, and cond is true for the conditional ops.
+type pending struct {
+	position visitor.Position
+	layer    int
+	cond     bool
+}
+
+// schedule returns the steps of the ops in order.
+// The steps of the layers are in order since an op is placed in the last layer or a new one.
+func schedule(circuit *Circuit, layout *Layout, ops []Op, conds map[Op]bool) []pending {
+	layers := make(map[Op]int)
+	for i, l := range layout.Layers {
+		for _, op := range l.Ops {
+			layers[op] = i
+		}
+	}
+
+	var list []pending
+	var last int
+	for _, op := range ops {
+		s := circuit.steps[op]
+		if len(list) > 0 && s.id == last {
+			continue
+		}
+
+		g, ok := op.(*Gate)
+		list = append(list, pending{
+			position: s.position,
+			layer:    layers[op],
+			cond:     ok && g.Cond != "" || conds[op],
+		})
+
+		last = s.id
+	}
+
+	return list
+}
+
+// observer takes the state before each step of the run as the state after the layers before it.
+// The conditional steps that are not applied are skipped.
+type observer struct {
+	visitor.NopObserver
+	qsim      *q.Q
+	env       *environ.Environ
+	steps     []pending
+	next      int
+	snapshots []Snapshot
+}
+
+func (o *observer) EnterStatement(s visitor.Statement) error {
+	for i := o.next; i < len(o.steps); i++ {
+		if o.steps[i].position == s.Position {
+			o.snapshot(o.steps[i].layer)
+			o.next = i + 1
+			return nil
+		}
+
+		if !o.steps[i].cond {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// snapshot takes the current state as the state after the layers up to the layer (exclusive).
+func (o *observer) snapshot(layer int) {
+	for i := len(o.snapshots); i < layer; i++ {
+		o.snapshots = append(o.snapshots, Snapshot{
+			Layer:      i,
+			Amplitudes: amplitudes(o.qsim, o.env),
+		})
+	}
+}
+
+func amplitudes(qsim *q.Q, env *environ.Environ) []Amplitude {
+	if len(env.QubitOrder) == 0 {
+		return nil
+	}
+
+	var list []Amplitude
+	for _, s := range qsim.Qubit().State(env.Index()...) {
+		list = append(list, Amplitude{
+			Basis:       s.BinaryString(),
+			Real:        real(s.Amplitude()),
+			Imag:        imag(s.Amplitude()),
+			Probability: s.Probability(),
+		})
+	}
+
+	return list
+}
+
+// zeros appends the registers declared after the snapshots in the zero state.
+func zeros(snapshots []Snapshot, env *environ.Environ) []Snapshot {
+	basis := make([]string, len(env.QubitOrder))
+	for i, name := range env.QubitOrder {
+		basis[i] = strings.Repeat("0", len(env.Qubit[name]))
+	}
+
+	for i, s := range snapshots {
+		if len(s.Amplitudes) == 0 && len(basis) > 0 {
+			snapshots[i].Amplitudes = []Amplitude{{Real: 1, Probability: 1}}
+		}
+
+		for j, a := range snapshots[i].Amplitudes {
+			snapshots[i].Amplitudes[j].Basis = append(a.Basis, basis[len(a.Basis):]...)
+		}
+	}
+
+	return snapshots
+}
@@ -0,0 +1,185 @@
+package svg_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/itsubaki/qasm/svg"
+)
+
+func ExampleSimulate() {
+	sim, err := svg.Simulate(`
+	OPENQASM 3.0;
+	gate h q { U(pi/2.0, 0, pi) q; }
+	gate cx c, t { ctrl @ U(pi, 0, pi) c, t; }
+	qubit[2] q;
+	qubit a;
+	h q[0];
+	cx q[0], q[1];
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(sim.Registers)
+	for _, s := range sim.Snapshots {
+		for _, a := range s.Amplitudes {
+			fmt.Printf("%d %v %.4f\n", s.Layer, a.Basis, a.Probability)
+		}
+	}
+
+	// Output:
+	// [q a]
+	// 0 [00 0] 0.5000
+	// 0 [10 0] 0.5000
+	// 1 [00 0] 0.5000
+	// 1 [11 0] 0.5000
+}
+
+func ExampleSimulate_conditional() {
+	sim, err := svg.Simulate(`
+	OPENQASM 3.0;
+	qubit[2] q;
+	bit c;
+	int n = 0;
+	U(pi, 0, pi) q[0];
+	c = measure q[0];
+	n = 1;
+	if (c) { U(pi, 0, pi) q[1]; }
+	if (n == 0) { U(pi, 0, pi) q[1]; }
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, s := range sim.Snapshots {
+		for _, a := range s.Amplitudes {
+			fmt.Printf("%d %v %.4f\n", s.Layer, a.Basis, a.Probability)
+		}
+	}
+
+	// Output:
+	// 0 [10] 1.0000
+	// 1 [10] 1.0000
+	// 2 [11] 1.0000
+}
+
+func TestSimulate(t *testing.T) {
+	cases := []struct {
+		text   string
+		errMsg string
+	}{
+		{
+			text: "../testdata/qft.qasm",
+		},
+		{
+			text: "../testdata/quantum_teleportation.qasm",
+		},
+		{
+			text: "../testdata/grover.qasm",
+		},
+		{
+			text: `qubit a; U(pi/2, 0, pi) a; qubit[2] b; U(pi, 0, pi) b[1];`,
+		},
+		{
+			text: `qubit[2] q; bit c; U(pi, 0, pi) q[0]; c = measure q[0]; if (c) { reset q[0]; U(pi, 0, pi) q[1]; }`,
+		},
+		{
+			text: `qubit[2] q; bit c; c = measure q[0]; if (c) { reset q[0]; } else { measure q[1]; } U(pi, 0, pi) q[1];`,
+		},
+		{
+			text:   `gate x q { U(pi, 0, pi) q; } qubit[2] q; ctrl @ x q[0], q[1];`,
+			errMsg: `user-defined call with modifier: not implemented`,
+		},
+		{
+			text:   `qubit q; oracle(q);`,
+			errMsg: `unsupported subroutine "ORACLE": expand it`,
+		},
+		{
+			text:   `qubit q; bit c; while (c == false) { U(pi, 0, pi) q; c = measure q; }`,
+			errMsg: `unroll "while (c == false)": not implemented`,
+		},
+		{
+			text:   `qubit q; int n = 1; switch (n) { case 1 { U(pi, 0, pi) q; } }`,
+			errMsg: `unroll "switch (n)": not implemented`,
+		},
+		{
+			text:   `qubit q; U(pi, 0, pi) q; end; U(pi, 0, pi) q;`,
+			errMsg: `layer 1: not applied in the run`,
+		},
+	}
+
+	for _, c := range cases {
+		text := c.text
+		if b, err := os.ReadFile(c.text); err == nil {
+			text = string(b)
+		}
+
+		sim, err := svg.Simulate(text)
+		if err != nil {
+			if err.Error() != c.errMsg {
+				t.Errorf("%s: got=%v, want=%v", c.text, err, c.errMsg)
+			}
+
+			continue
+		}
+
+		if c.errMsg != "" {
+			t.Errorf("%s: got=nil, want=%v", c.text, c.errMsg)
+			continue
+		}
+
+		if len(sim.Snapshots) != len(sim.Layout.Layers) {
+			t.Errorf("%s: got=%d snapshots, want=%d", c.text, len(sim.Snapshots), len(sim.Layout.Layers))
+		}
+
+		// the states are normalized after every layer
+		for _, s := range sim.Snapshots {
+			var sum float64
+			for _, a := range s.Amplitudes {
+				sum += a.Probability
+
+				if len(a.Basis) != len(sim.Registers) {
+					t.Errorf("%s: layer %d: basis=%v, registers=%v", c.text, s.Layer, a.Basis, sim.Registers)
+				}
+			}
+
+			if sum < 1-1e-8 || sum > 1+1e-8 {
+				t.Errorf("%s: layer %d: sum=%v", c.text, s.Layer, sum)
+			}
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	text, err := os.ReadFile("../testdata/qft.qasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	folded := svg.DefaultConfig
+	folded.Fold = 4
+
+	got, err := svg.HTML(string(text), folded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		`<!DOCTYPE html>`,
+		`<rect class="layer" data-layer="0" `,
+		`<rect class="layer" data-layer="9" `,
+		`"registers":["q"]`,
+		`"layer":9,"amplitudes":[{"basis":["000"],"real":0.35355`,
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("%q not in the html", s)
+		}
+	}
+
+	if strings.Contains(got, "<script src") || strings.Contains(got, "<link") {
+		t.Errorf("the html is not self-contained")
+	}
+}
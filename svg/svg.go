@@ -1,19 +1,83 @@
 package svg
 
-import xparser "github.com/itsubaki/qasm/parser"
+import (
+	"github.com/antlr4-go/antlr/v4"
+	"github.com/itsubaki/qasm/environ"
+	xparser "github.com/itsubaki/qasm/parser"
+)
 
-func SVG(text string, config Config) (string, error) {
-	program, err := xparser.Parse(text)
+func SVG(text string, config Config, opt ...Option) (string, error) {
+	layout, err := Parse(text, opt...)
 	if err != nil {
 		return "", err
 	}
 
-	circuit, err := Build(program)
+	diagram := Render(layout, config)
+	return diagram, nil
+}
+
+// Parse returns the layout of the input text.
+func Parse(text string, opt ...Option) (*Layout, error) {
+	program, err := xparser.Parse(text)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	layout := NewLayout(circuit)
-	diagram := Render(layout, config)
-	return diagram, nil
+	circuit, err := Build(program, opt...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLayout(circuit), nil
+}
+
+// Definition is the layout of the body of the gate or subroutine definition.
+type Definition struct {
+	Name   string
+	Layout *Layout
+}
+
+// Definitions returns the layouts of the gate and subroutine definitions in the input text in order.
+// The calls in the bodies are expanded with the options as in the program.
+func Definitions(text string, opt ...Option) ([]Definition, error) {
+	program, err := xparser.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	// the definitions and the constants referred to by the bodies
+	env := environ.New()
+	if _, err := NewVisitor(env, opt...).Build(program); err != nil {
+		return nil, err
+	}
+
+	var defs []Definition
+	for _, s := range program.AllStatementOrScope() {
+		if s.Statement() == nil {
+			continue
+		}
+
+		var def antlr.ParserRuleContext
+		var name string
+		switch {
+		case s.Statement().GateStatement() != nil:
+			def, name = s.Statement().GateStatement(), s.Statement().GateStatement().Identifier().GetText()
+		case s.Statement().DefStatement() != nil:
+			def, name = s.Statement().DefStatement(), s.Statement().DefStatement().Identifier().GetText()
+		default:
+			continue
+		}
+
+		circuit, err := NewVisitor(env.NewEnclosed(), opt...).Define(def)
+		if err != nil {
+			return nil, err
+		}
+
+		defs = append(defs, Definition{
+			Name:   name,
+			Layout: NewLayout(circuit),
+		})
+	}
+
+	return defs, nil
 }
@@ -2,6 +2,8 @@ package svg_test
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/itsubaki/qasm/svg"
@@ -16,6 +18,26 @@ func TestSVG(t *testing.T) {
 			text:   `OPENQASM 3.0; qubit[2] q; h q[0]; ctrl @ x q[0], q[1]; measure q;`,
 			hasErr: false,
 		},
+		{
+			text:   "../testdata/quantum_teleportation.qasm",
+			hasErr: false,
+		},
+		{
+			text:   "../testdata/error_correction.qasm",
+			hasErr: false,
+		},
+		{
+			text:   "../testdata/qsp.qasm",
+			hasErr: false,
+		},
+		{
+			text:   "../testdata/grover.qasm",
+			hasErr: false,
+		},
+		{
+			text:   `def f(int k) {} qubit q; f(1); h q;`,
+			hasErr: false,
+		},
 		{
 			text:   `qubit[ q;`,
 			hasErr: true,
@@ -27,7 +49,12 @@ func TestSVG(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		diagram, err := svg.SVG(c.text, svg.DefaultConfig)
+		text := c.text
+		if b, err := os.ReadFile(c.text); err == nil {
+			text = string(b)
+		}
+
+		diagram, err := svg.SVG(text, svg.DefaultConfig)
 		if c.hasErr && err != nil {
 			continue
 		}
@@ -43,3 +70,105 @@ func TestSVG(t *testing.T) {
 		}
 	}
 }
+
+func ExampleDefinitions() {
+	defs, err := svg.Definitions(`
+	gate cr(theta) c, t { ctrl @ U(0, 0, theta) c, t; }
+	def qft(qubit[2] q) { U(pi/2, 0, pi) q[1]; cr(pi/2) q[0], q[1]; }
+	qubit[2] q;
+	qft(q);
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, d := range defs {
+		fmt.Println(d.Name)
+		fmt.Print(svg.RenderText(d.Layout, 0))
+	}
+
+	// Output:
+	// cr
+	//
+	// c: ──────────●─────────
+	//              │
+	//     ┌────────┴───────┐
+	// t: ─┤ U(0, 0, theta) ├─
+	//     └────────────────┘
+	// qft
+	//
+	// q[0]: ───────────────────────●─────
+	//                              │
+	//        ┌──────────────┐ ┌────┴───┐
+	// q[1]: ─┤ U(π/2, 0, π) ├─┤ R(π/2) ├─
+	//        └──────────────┘ └────────┘
+}
+
+func TestDefinitions(t *testing.T) {
+	b, err := os.ReadFile("../testdata/quantum_counting.qasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defs, err := svg.Definitions(string(b), svg.WithExpand("xor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, d := range defs {
+		names = append(names, d.Name)
+	}
+
+	want := "[x h cr cx xor ccccz cccccx oracle diffuser controlledG inv_qft]"
+	if fmt.Sprint(names) != want {
+		t.Errorf("got=%v, want=%v", names, want)
+	}
+
+	for _, d := range defs {
+		if d.Name != "oracle" {
+			continue
+		}
+
+		// 8 xor gates are expanded into 16 controlled X and 1 cccccx
+		if len(d.Layout.Layers) != 17 {
+			t.Errorf("got=%v, want=%v", len(d.Layout.Layers), 17)
+		}
+	}
+
+	if _, err := svg.Definitions(`qubit[ q;`); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestSVG_mode(t *testing.T) {
+	b, err := os.ReadFile("../testdata/grover.qasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		mode   svg.Mode
+		frame  bool
+		errMsg string
+	}{
+		{mode: svg.ModeGroup, frame: true},
+		{mode: svg.ModeUnroll, frame: false},
+		{mode: "foo", errMsg: `unsupported mode "foo"`},
+	}
+
+	for _, c := range cases {
+		diagram, err := svg.SVG(string(b), svg.DefaultConfig, svg.WithMode(c.mode))
+		if err != nil {
+			if err.Error() != c.errMsg {
+				t.Errorf("got=%v, want=%v", err, c.errMsg)
+			}
+
+			continue
+		}
+
+		if got := strings.Contains(diagram, "for i in [0:R-1]"); got != c.frame {
+			t.Errorf("%s: got=%v, want=%v", c.mode, got, c.frame)
+		}
+	}
+}
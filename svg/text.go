@@ -0,0 +1,321 @@
+package svg
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// RenderText returns the diagram of the layout drawn with box-drawing characters.
+// Each wire takes three rows. The layers are folded so that each line fits in the width,
+// and the width of 0 or less disables folding.
+func RenderText(layout *Layout, width int) string {
+	var margin int
+	for _, w := range layout.Wires {
+		margin = max(margin, utf8.RuneCountInString(w.Name)+2)
+	}
+
+	// fold the layers
+	var chunks [][][][]rune
+	var chunk [][][]rune
+	used := margin + 2
+	for _, layer := range layout.Layers {
+		block := textLayer(layout.Wires, layer)
+		w := len(block[0]) + 1
+		if width > 0 && len(chunk) > 0 && used+w > width {
+			chunks = append(chunks, chunk)
+			chunk, used = nil, margin+2
+		}
+
+		chunk = append(chunk, block)
+		used += w
+	}
+	chunks = append(chunks, chunk)
+
+	var b strings.Builder
+	for i, chunk := range chunks {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		for r := range 3 * len(layout.Wires) {
+			w := layout.Wires[r/3]
+			fill := fillRune(layout.Wires, r)
+
+			var line strings.Builder
+			switch {
+			case r%3 != 1:
+				line.WriteString(strings.Repeat(" ", margin))
+				line.WriteRune(fill)
+			case i > 0:
+				line.WriteString(pad(w.Name+": ", margin) + "«")
+			default:
+				line.WriteString(pad(w.Name+": ", margin))
+				line.WriteRune(fill)
+			}
+
+			for _, block := range chunk {
+				line.WriteString(string(block[r]))
+				line.WriteRune(fill)
+			}
+
+			if r%3 == 1 && i < len(chunks)-1 {
+				line.WriteString("»")
+			}
+
+			b.WriteString(strings.TrimRight(line.String(), " ") + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+// textLayer returns the rows of the layer.
+func textLayer(wires []Wire, layer Layer) [][]rune {
+	label := 1
+	for _, op := range layer.Ops {
+		switch o := op.(type) {
+		case *Gate:
+			if !oplus(o) && !Swap(o) && !CZ(o) {
+				label = max(label, utf8.RuneCountInString(o.Label(DefaultConfig.Precision)))
+			}
+
+			if len(o.Bit) > 0 {
+				label = max(label, utf8.RuneCountInString(o.Cond)-2)
+			}
+		case *Subroutine:
+			label = max(label, utf8.RuneCountInString(o.Name))
+		case *Reset:
+			label = max(label, utf8.RuneCountInString("|0⟩"))
+		}
+	}
+
+	width := label + 4
+	grid := make([][]rune, 3*len(wires))
+	for r := range grid {
+		grid[r] = []rune(strings.Repeat(string(fillRune(wires, r)), width))
+	}
+
+	c := width / 2
+	for _, op := range layer.Ops {
+		switch o := op.(type) {
+		case *Gate:
+			top, bottom := textGate(wires, grid, c, o)
+			if top < 0 {
+				// gphase without qubits
+				continue
+			}
+
+			var rows []int
+			for _, q := range o.Control {
+				grid[3*q+1][c] = '●'
+				rows = append(rows, 3*q+1)
+			}
+
+			for _, q := range o.NegControl {
+				grid[3*q+1][c] = '○'
+				rows = append(rows, 3*q+1)
+			}
+
+			textConnect(wires, grid, c, top, bottom, rows, false)
+
+			var bits []int
+			for _, q := range o.Bit {
+				grid[3*q+1][c] = '■'
+				bits = append(bits, 3*q+1)
+			}
+
+			textConnect(wires, grid, c, top, bottom, bits, true)
+			if len(o.Bit) > 0 && o.Cond != "" {
+				// the label under the last bit
+				textLabel(grid[3*o.Bit[len(o.Bit)-1]+2], o.Cond)
+			}
+		case *Subroutine:
+			textBox(wires, grid, o.Wire, o.Name)
+		case *Reset:
+			for _, q := range o.Wire {
+				textBox(wires, grid, []int{q}, "|0⟩")
+			}
+		case *Measurement:
+			for _, q := range o.Wire {
+				top, bottom := textBox(wires, grid, []int{q}, "M")
+
+				var rows []int
+				for _, t := range o.Target {
+					grid[3*t+1][c] = '╩'
+					rows = append(rows, 3*t+1)
+				}
+
+				textConnect(wires, grid, c, top, bottom, rows, true)
+			}
+		case *Barrier:
+			for _, q := range o.Wire {
+				for r := 3 * q; r < 3*q+3; r++ {
+					grid[r][c] = '░'
+				}
+			}
+		}
+	}
+
+	return grid
+}
+
+// textGate draws the targets of the gate and returns the top and bottom rows.
+// The rows are negative if the gate has no qubits.
+func textGate(wires []Wire, grid [][]rune, c int, g *Gate) (int, int) {
+	label := g.Label(DefaultConfig.Precision)
+	switch {
+	case len(g.Target) == 0:
+		// gphase is a note above the controls or the wires
+		qubits := append(slices.Clone(g.Control), g.NegControl...)
+		if len(qubits) == 0 {
+			textLabel(grid[0], label)
+			return -1, -1
+		}
+
+		q := slices.Min(qubits)
+		textLabel(grid[3*q], label)
+		return 3*q + 1, 3*q + 1
+	case oplus(g):
+		r := 3*g.Target[0] + 1
+		grid[r][c] = '⊕'
+		return r, r
+	case CZ(g):
+		r := 3*g.Target[0] + 1
+		grid[r][c] = '●'
+		return r, r
+	case Swap(g):
+		top, bottom := 3*g.Target[0]+1, 3*g.Target[1]+1
+		grid[top][c], grid[bottom][c] = '×', '×'
+		textConnect(wires, grid, c, top, top, []int{bottom}, false)
+		return top, top
+	}
+
+	// a box for each run of the contiguous targets
+	runs := Runs(g.Target)
+	top, _ := textBox(wires, grid, runs[0], label)
+	bottom := top
+	for i, run := range runs {
+		t, b := textBox(wires, grid, run, label)
+		if i > 0 {
+			textConnect(wires, grid, c, bottom, bottom, []int{t}, false)
+			grid[bottom][c], grid[t][c] = '┬', '┴'
+		}
+
+		bottom = b
+	}
+
+	return top, bottom
+}
+
+// textBox draws the box over the wires and returns the top and bottom rows.
+func textBox(wires []Wire, grid [][]rune, targets []int, label string) (int, int) {
+	top, bottom := 3*slices.Min(targets), 3*slices.Max(targets)+2
+	width := utf8.RuneCountInString(label) + 4
+	left := len(grid[0])/2 - width/2
+
+	for r := top; r <= bottom; r++ {
+		l, rt := '│', '│'
+		if r%3 == 1 && slices.Contains(targets, r/3) {
+			l, rt = '┤', '├'
+			if wires[r/3].Classical {
+				l, rt = '╡', '╞'
+			}
+		}
+
+		inner := ' '
+		switch r {
+		case top:
+			l, rt, inner = '┌', '┐', '─'
+		case bottom:
+			l, rt, inner = '└', '┘', '─'
+		}
+
+		row := grid[r][left : left+width]
+		row[0], row[width-1] = l, rt
+		for i := 1; i < width-1; i++ {
+			row[i] = inner
+		}
+	}
+
+	textLabel(grid[(top+bottom)/2][left+1:left+width-1], label)
+	return top, bottom
+}
+
+// textConnect draws the vertical line from the op between the top and bottom rows to the rows.
+func textConnect(wires []Wire, grid [][]rune, c, top, bottom int, rows []int, double bool) {
+	if len(rows) == 0 {
+		return
+	}
+
+	lo, hi := min(top, slices.Min(rows)), max(bottom, slices.Max(rows))
+	for r := lo + 1; r < hi; r++ {
+		if (r >= top && r <= bottom) || slices.Contains(rows, r) {
+			continue
+		}
+
+		switch {
+		case r%3 != 1 && double:
+			grid[r][c] = '║'
+		case r%3 != 1:
+			grid[r][c] = '│'
+		case wires[r/3].Classical && double:
+			grid[r][c] = '╬'
+		case wires[r/3].Classical:
+			grid[r][c] = '╪'
+		case double:
+			grid[r][c] = '╫'
+		default:
+			grid[r][c] = '┼'
+		}
+	}
+
+	if top == bottom {
+		// no box
+		return
+	}
+
+	up, down := '┴', '┬'
+	if double {
+		up, down = '╨', '╥'
+	}
+
+	if lo < top {
+		grid[top][c] = up
+	}
+
+	if hi > bottom {
+		grid[bottom][c] = down
+	}
+}
+
+// textLabel writes the label at the center of the row.
+func textLabel(row []rune, label string) {
+	runes := []rune(label)
+	start := max(0, (len(row)-len(runes))/2)
+	for i, r := range runes {
+		if start+i < len(row) {
+			row[start+i] = r
+		}
+	}
+}
+
+// oplus returns true if the gate is drawn as the target of a controlled X.
+func oplus(g *Gate) bool {
+	return g.Name == "X" && len(g.Target) == 1 && len(g.Control)+len(g.NegControl) > 0
+}
+
+func fillRune(wires []Wire, r int) rune {
+	switch {
+	case r%3 != 1:
+		return ' '
+	case wires[r/3].Classical:
+		return '═'
+	default:
+		return '─'
+	}
+}
+
+func pad(s string, n int) string {
+	return s + strings.Repeat(" ", max(0, n-utf8.RuneCountInString(s)))
+}
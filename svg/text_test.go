@@ -0,0 +1,85 @@
+package svg_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/itsubaki/qasm/svg"
+)
+
+func ExampleRenderText() {
+	layout, err := svg.Parse(`
+	qubit[2] q;
+	bit c;
+	h q[0];
+	negctrl @ x q[0], q[1];
+	barrier q;
+	c = measure q[1];
+	if (c) { z q[0]; }
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(svg.RenderText(layout, 0))
+
+	// Output:
+	//        ┌───┐         ░         ┌───┐
+	// q[0]: ─┤ H ├───○─────░─────────┤ Z ├─
+	//        └───┘   │     ░         └─╥─┘
+	//                │     ░   ┌───┐   ║
+	// q[1]: ─────────⊕─────░───┤ M ├───╫───
+	//                      ░   └─╥─┘   ║
+	//                            ║     ║
+	// c:    ═════════════════════╩═════■═══
+	//                                  c
+}
+
+func ExampleRenderText_symbols() {
+	layout, err := svg.Parse(`
+	gate g a, b { U(pi, 0, pi) a; }
+	qubit[3] q;
+	reset q[0];
+	swap q[0], q[1];
+	cz q[1], q[2];
+	g q[0], q[2];
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(svg.RenderText(layout, 0))
+
+	// Output:
+	//        ┌─────┐             ┌───┐
+	// q[0]: ─┤ |0⟩ ├───×─────────┤ G ├─
+	//        └─────┘   │         └─┬─┘
+	//                  │           │
+	// q[1]: ───────────×─────●─────┼───
+	//                        │     │
+	//                        │   ┌─┴─┐
+	// q[2]: ─────────────────●───┤ G ├─
+	//                            └───┘
+}
+
+func TestRenderText_fold(t *testing.T) {
+	layout, err := svg.Parse(`qubit[2] q; h q; x q; y q; z q; s q; t q; h q; x q;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, width := range []int{20, 30, 40} {
+		got := svg.RenderText(layout, width)
+		for _, line := range strings.Split(strings.TrimRight(got, "\n"), "\n") {
+			if utf8.RuneCountInString(line) > width {
+				t.Errorf("width=%d: %q", width, line)
+			}
+		}
+
+		if strings.Count(got, "┤ ") != 16 {
+			t.Errorf("width=%d: got=%d boxes", width, strings.Count(got, "┤ "))
+		}
+	}
+}
@@ -2,35 +2,115 @@ package svg
 
 import (
 	"fmt"
+	"maps"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/antlr4-go/antlr/v4"
+	"github.com/itsubaki/q"
 	"github.com/itsubaki/qasm/environ"
 	"github.com/itsubaki/qasm/gen/parser"
+	xparser "github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/value"
+	"github.com/itsubaki/qasm/visitor"
 )
 
+// Mode is how the control flow such as for, while, switch and box is drawn.
+type Mode string
+
+const (
+	// ModeGroup draws the body once inside a dashed frame labelled with the statement.
+	// The loop variable of the for statement is bound to its first value.
+	ModeGroup Mode = "group"
+
+	// ModeUnroll draws every iteration of the for statement.
+	// The other statements are drawn as in ModeGroup since their conditions are not constant.
+	ModeUnroll Mode = "unroll"
+)
+
+// MaxDepth is the maximum depth of the expansion of the calls.
+const MaxDepth = 64
+
+// MaxIterations is the maximum number of iterations of each loop unrolled.
+const MaxIterations = 1 << 16
+
 type Visitor struct {
 	*parser.Baseqasm3ParserVisitor
-	env     *environ.Environ
-	circuit *Circuit
-	wire    map[string]int
+	env      *environ.Environ
+	eval     *visitor.Visitor
+	circuit  *Circuit
+	wire     map[string]int
+	mode     Mode
+	depth    int
+	expand   map[string]bool
+	level    int
+	symbolic map[string]bool
+	steps    int
+}
+
+type Option func(*Visitor)
+
+// WithMode sets the mode of the control flow. The default is ModeGroup.
+func WithMode(mode Mode) Option {
+	return func(v *Visitor) {
+		v.mode = mode
+	}
+}
+
+// WithDepth expands the calls of the gates and subroutines inline up to the depth.
+// The calls with modifiers are not expanded.
+func WithDepth(depth int) Option {
+	return func(v *Visitor) {
+		v.depth = depth
+	}
+}
+
+// WithExpand expands the calls of the named gates and subroutines inline at any depth.
+func WithExpand(name ...string) Option {
+	return func(v *Visitor) {
+		for _, n := range name {
+			v.expand[n] = true
+		}
+	}
 }
 
-func NewVisitor(env *environ.Environ) *Visitor {
-	return &Visitor{
+func NewVisitor(env *environ.Environ, opt ...Option) *Visitor {
+	v := &Visitor{
 		Baseqasm3ParserVisitor: &parser.Baseqasm3ParserVisitor{},
 		env:                    env,
+		eval:                   visitor.New(q.New(), env, visitor.WithMaxIterations(MaxIterations)),
 		circuit:                &Circuit{},
 		wire:                   make(map[string]int),
+		mode:                   ModeGroup,
+		expand:                 make(map[string]bool),
+		symbolic:               make(map[string]bool),
+	}
+
+	for _, o := range opt {
+		o(v)
 	}
+
+	return v
 }
 
-func Build(tree antlr.ParseTree) (*Circuit, error) {
-	return NewVisitor(environ.New()).Build(tree)
+func Build(tree antlr.ParseTree, opt ...Option) (*Circuit, error) {
+	return NewVisitor(environ.New(), opt...).Build(tree)
 }
 
 func (v *Visitor) Build(tree antlr.ParseTree) (*Circuit, error) {
+	if v.mode != ModeGroup && v.mode != ModeUnroll {
+		return nil, fmt.Errorf("unsupported mode %q", v.mode)
+	}
+
+	// physical qubits are placed in ascending order.
+	for _, id := range PhysicalQubits(tree) {
+		if err := v.AddWire(id); err != nil {
+			return nil, err
+		}
+	}
+
 	if err, ok := v.Visit(tree).(error); ok && err != nil {
 		return nil, err
 	}
@@ -51,6 +131,16 @@ func (v *Visitor) AddWire(wireID string) error {
 	return nil
 }
 
+// AddBitWire adds the classical wire.
+func (v *Visitor) AddBitWire(wireID string) error {
+	if err := v.AddWire(wireID); err != nil {
+		return err
+	}
+
+	v.circuit.Wires[len(v.circuit.Wires)-1].Classical = true
+	return nil
+}
+
 func (v *Visitor) GetWire(wireID string, index ...int64) ([]int, bool) {
 	if len(index) > 0 {
 		id := fmt.Sprintf("%s[%d]", wireID, index[0])
@@ -85,6 +175,32 @@ func (v *Visitor) GetWire(wireID string, index ...int64) ([]int, bool) {
 	return nil, false
 }
 
+// PhysicalQubits returns the physical qubits such as $0 used in the tree in ascending order.
+func PhysicalQubits(tree antlr.Tree) []string {
+	seen := make(map[int]bool)
+	var walk func(t antlr.Tree)
+	walk = func(t antlr.Tree) {
+		if ctx, ok := t.(*parser.GateOperandContext); ok && ctx.HardwareQubit() != nil {
+			n, err := strconv.Atoi(strings.TrimPrefix(ctx.HardwareQubit().GetText(), "$"))
+			if err == nil {
+				seen[n] = true
+			}
+		}
+
+		for _, c := range t.GetChildren() {
+			walk(c)
+		}
+	}
+	walk(tree)
+
+	var ids []string
+	for _, n := range slices.Sorted(maps.Keys(seen)) {
+		ids = append(ids, fmt.Sprintf("$%d", n))
+	}
+
+	return ids
+}
+
 func (v *Visitor) Visit(tree antlr.ParseTree) any {
 	return tree.Accept(v)
 }
@@ -150,12 +266,42 @@ func (v *Visitor) VisitStatement(ctx *parser.StatementContext) any {
 			continue
 		}
 
-		return v.Visit(s)
+		begin := len(v.circuit.Ops)
+		result := v.Visit(s)
+		v.Step(ctx, begin)
+		return result
 	}
 
 	return fmt.Errorf("unsupported statement %q", ctx.GetText())
 }
 
+// Step records the ops added since begin as the step of the statement.
+// The ops of the inner statements are recorded by them.
+func (v *Visitor) Step(ctx *parser.StatementContext, begin int) {
+	if len(v.circuit.Ops) <= begin {
+		return
+	}
+
+	if v.circuit.steps == nil {
+		v.circuit.steps = make(map[Op]step)
+	}
+
+	v.steps++
+	for _, op := range v.circuit.Ops[begin:] {
+		if _, ok := v.circuit.steps[op]; ok {
+			continue
+		}
+
+		v.circuit.steps[op] = step{
+			id: v.steps,
+			position: visitor.Position{
+				Line:   ctx.GetStart().GetLine(),
+				Column: ctx.GetStart().GetColumn(),
+			},
+		}
+	}
+}
+
 func (v *Visitor) VisitMeasureExpression(ctx *parser.MeasureExpressionContext) any {
 	wireIDs, err := cast[[]int](v.Visit(ctx.GateOperand()))
 	if err != nil {
@@ -195,6 +341,46 @@ func (v *Visitor) VisitMeasureArrowAssignmentStatement(ctx *parser.MeasureArrowA
 		return fmt.Errorf("undefined %q", cargs)
 	}
 
+	v.Measure(wireIDs, targetIDs)
+	return nil
+}
+
+func (v *Visitor) VisitAssignmentStatement(ctx *parser.AssignmentStatementContext) any {
+	if ctx.MeasureExpression() == nil {
+		if _, ok := v.GetWire(ctx.IndexedIdentifier().Identifier().GetText()); ok {
+			// the assignments to the classical bits are not drawn.
+			return nil
+		}
+
+		return v.Evaluate(ctx, ctx.IndexedIdentifier().Identifier().GetText(), ctx.Expression())
+	}
+
+	wireIDs, err := cast[[]int](v.Visit(ctx.MeasureExpression()))
+	if err != nil {
+		return err
+	}
+
+	index, err := cast[[]int64](v.Visit(ctx.IndexedIdentifier()))
+	if err != nil {
+		return err
+	}
+
+	cargs, err := cast[string](v.Visit(ctx.IndexedIdentifier().Identifier()))
+	if err != nil {
+		return err
+	}
+
+	targetIDs, ok := v.GetWire(cargs, index...)
+	if !ok {
+		return fmt.Errorf("undefined %q", cargs)
+	}
+
+	v.Measure(wireIDs, targetIDs)
+	return nil
+}
+
+// Measure adds the measurements of the qubit wires into the classical wires.
+func (v *Visitor) Measure(wireIDs, targetIDs []int) {
 	if len(targetIDs) > 1 {
 		for i := range wireIDs {
 			v.circuit.Ops = append(v.circuit.Ops, &Measurement{
@@ -203,33 +389,466 @@ func (v *Visitor) VisitMeasureArrowAssignmentStatement(ctx *parser.MeasureArrowA
 			})
 		}
 
-		return nil
+		return
 	}
 
 	v.circuit.Ops = append(v.circuit.Ops, &Measurement{
 		Wire:   wireIDs,
 		Target: targetIDs,
 	})
+}
+
+func (v *Visitor) VisitIfStatement(ctx *parser.IfStatementContext) any {
+	bits := v.Bits(ctx.Expression())
+	if len(bits) == 0 && !v.Symbolic(ctx.Expression()) {
+		// the condition without the classical bits is evaluated, and only the branch taken is drawn.
+		taken, err := v.Taken(ctx)
+		if err != nil {
+			return err
+		}
+
+		if taken == nil {
+			return nil
+		}
+
+		return v.Body(taken)
+	}
+
+	cond := v.Condition(ctx.Expression())
+
+	if err := v.Conditional(ctx.GetIf_body(), bits, cond); err != nil {
+		return err
+	}
+
+	if ctx.GetElse_body() == nil {
+		return nil
+	}
+
+	return v.Conditional(ctx.GetElse_body(), bits, fmt.Sprintf("!(%s)", cond))
+}
+
+// Taken returns the branch of the if statement taken by the condition, or nil if none is taken.
+func (v *Visitor) Taken(ctx *parser.IfStatementContext) (parser.IStatementOrScopeContext, error) {
+	cond := v.eval.Visit(ctx.Expression())
+	if err, ok := cond.(error); ok {
+		return nil, err
+	}
+
+	b, ok := cond.(bool)
+	if !ok {
+		return nil, fmt.Errorf("condition must be a bool %q", ctx.Expression().GetText())
+	}
+
+	if b {
+		return ctx.GetIf_body(), nil
+	}
+
+	return ctx.GetElse_body(), nil
+}
+
+// Condition returns the condition with the classical wires and the values resolved,
+// so it refers to neither the loop variables nor the arguments of the expanded calls.
+// The expressions that can not be evaluated such as the unbound params are kept as they are.
+func (v *Visitor) Condition(x parser.IExpressionContext) string {
+	if len(v.Bits(x)) == 0 && !v.Symbolic(x) {
+		switch val := v.eval.Visit(x).(type) {
+		case bool:
+			return strconv.FormatBool(val)
+		case int64:
+			return strconv.FormatInt(val, 10)
+		case float64:
+			return strconv.FormatFloat(val, 'g', -1, 64)
+		}
+	}
+
+	switch x := x.(type) {
+	case *parser.LiteralExpressionContext:
+		// c
+		ids, _ := v.GetWire(x.GetText())
+		switch {
+		case len(ids) == 1:
+			return v.circuit.Wires[ids[0]].Name
+		case len(ids) > 1:
+			// the name of the register of the wires c[0], c[1], ...
+			name, _, _ := strings.Cut(v.circuit.Wires[ids[0]].Name, "[")
+			return name
+		}
+	case *parser.IndexExpressionContext:
+		// c[i]
+		if bits := v.Bits(x); len(bits) == 1 {
+			return v.circuit.Wires[bits[0]].Name
+		}
+	case *parser.ParenthesisExpressionContext:
+		return fmt.Sprintf("(%s)", v.Condition(x.Expression()))
+	case *parser.UnaryExpressionContext:
+		return x.GetOp().GetText() + v.Condition(x.Expression())
+	case interface {
+		AllExpression() []parser.IExpressionContext
+		GetOp() antlr.Token
+	}:
+		// c[0] == 1, c[0] && c[1], ...
+		list := x.AllExpression()
+		return fmt.Sprintf("%s %s %s", v.Condition(list[0]), x.GetOp().GetText(), v.Condition(list[1]))
+	}
+
+	return xparser.Text(x)
+}
+
+// Conditional adds the gates of the body under the condition on the classical wires.
+// The body of the other ops such as reset, measure and the loops is drawn as the group labelled with the condition.
+func (v *Visitor) Conditional(body parser.IStatementOrScopeContext, bits []int, cond string) error {
+	begin := len(v.circuit.Ops)
+	if err := v.Body(body); err != nil {
+		return err
+	}
+
+	ops := v.circuit.Ops[begin:]
+	if slices.ContainsFunc(ops, func(op Op) bool {
+		_, ok := op.(*Gate)
+		return !ok
+	}) {
+		// if (c == 1) { reset q; }
+		v.Group(begin, fmt.Sprintf("if (%s)", cond))
+		return nil
+	}
+
+	for _, op := range ops {
+		g := op.(*Gate)
+		c := cond
+		if g.Cond != "" {
+			// nested if statements
+			c = fmt.Sprintf("(%s) && (%s)", cond, g.Cond)
+		}
+
+		g.Bit = slices.Sorted(maps.Keys(set(append(g.Bit, bits...))))
+		g.Cond = c
+	}
 
 	return nil
 }
 
-func (v *Visitor) VisitGateCallStatement(ctx *parser.GateCallStatementContext) any {
-	gate, err := cast[string](v.Visit(ctx.Identifier()))
+// Body visits the statements of the body.
+func (v *Visitor) Body(body parser.IStatementOrScopeContext) error {
+	statements := []parser.IStatementOrScopeContext{body}
+	if body.Scope() != nil {
+		statements = body.Scope().AllStatementOrScope()
+	}
+
+	for _, s := range statements {
+		if err, ok := v.Visit(s).(error); ok && err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Enclosed calls f with the enclosed environment.
+func (v *Visitor) Enclosed(f func() error) error {
+	env, eval := v.env, v.eval
+	defer func() {
+		v.env, v.eval = env, eval
+	}()
+
+	v.env = env.NewEnclosed()
+	v.eval = visitor.New(q.New(), v.env, visitor.WithMaxIterations(MaxIterations))
+	return f()
+}
+
+// Group replaces the ops added since begin with the group labelled.
+// Nothing is added if there are no ops.
+func (v *Visitor) Group(begin int, label string) {
+	if len(v.circuit.Ops) == begin {
+		return
+	}
+
+	ops := slices.Clone(v.circuit.Ops[begin:])
+	v.circuit.Ops = append(v.circuit.Ops[:begin], &Group{
+		Label: label,
+		Ops:   ops,
+	})
+}
+
+func (v *Visitor) VisitForStatement(ctx *parser.ForStatementContext) any {
+	id, err := cast[string](v.Visit(ctx.Identifier()))
 	if err != nil {
 		return err
 	}
 
-	qargs, err := cast[[]int](v.Visit(ctx.GateOperandList()))
+	// the body is drawn once in ModeGroup.
+	n := 1
+	if v.mode == ModeUnroll {
+		n = math.MaxInt
+	}
+
+	values, err := v.Values(ctx, n)
 	if err != nil {
 		return err
 	}
 
+	iterate := func(values []int64) error {
+		for _, i := range values {
+			if err := v.Enclosed(func() error {
+				v.env.SetVariable(id, i)
+				return v.Body(ctx.StatementOrScope())
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if v.mode == ModeUnroll {
+		return iterate(values)
+	}
+
+	// for i in [0:3] { ... }
+	begin := len(v.circuit.Ops)
+	if err := iterate(values); err != nil {
+		return err
+	}
+
+	label := fmt.Sprintf("for %s in [%s]", id, xparser.Text(ctx.RangeExpression()))
+	if ctx.SetExpression() != nil {
+		label = fmt.Sprintf("for %s in %s", id, xparser.Text(ctx.SetExpression()))
+	}
+
+	v.Group(begin, label)
+	return nil
+}
+
+// Values returns the first n values of the loop variable of the for statement.
+// The range of more than MaxIterations values is an error.
+func (v *Visitor) Values(ctx *parser.ForStatementContext, n int) ([]int64, error) {
+	switch {
+	case ctx.RangeExpression() != nil:
+		// [start:stop], [start:step:stop]
+		rx, err := cast[[]int64](v.eval.Visit(ctx.RangeExpression()))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rx) < 2 {
+			return nil, fmt.Errorf("unsupported range %q", ctx.RangeExpression().GetText())
+		}
+
+		start, step, stop := rx[0], int64(1), rx[len(rx)-1]
+		if len(rx) == 3 {
+			step = rx[1]
+		}
+
+		if step == 0 {
+			return nil, fmt.Errorf("invalid step %q", ctx.RangeExpression().GetText())
+		}
+
+		var values []int64
+		for i := start; len(values) < n && ((step > 0 && i <= stop) || (step < 0 && i >= stop)); i += step {
+			if err := v.eval.Iterate(len(values) + 1); err != nil {
+				return nil, err
+			}
+
+			values = append(values, i)
+			if (step > 0 && i > math.MaxInt64-step) || (step < 0 && i < math.MinInt64-step) {
+				// the next value overflows.
+				break
+			}
+		}
+
+		return values, nil
+	case ctx.SetExpression() != nil:
+		// {0, 2, 5}
+		var values []int64
+		for _, x := range ctx.SetExpression().AllExpression() {
+			val, err := value.New(v.eval.Visit(x)).Int64()
+			if err != nil {
+				return nil, fmt.Errorf("int64(%v): %w", x.GetText(), err)
+			}
+
+			values = append(values, val.Value().(int64))
+		}
+
+		return values[:min(n, len(values))], nil
+	default:
+		return nil, fmt.Errorf("unsupported loop %q", ctx.GetText())
+	}
+}
+
+func (v *Visitor) VisitWhileStatement(ctx *parser.WhileStatementContext) any {
+	// the condition depends on the measurements in general.
+	begin := len(v.circuit.Ops)
+	if err := v.Enclosed(func() error {
+		return v.Body(ctx.GetBody())
+	}); err != nil {
+		return err
+	}
+
+	v.Group(begin, fmt.Sprintf("while (%s)", xparser.Text(ctx.Expression())))
+	return nil
+}
+
+func (v *Visitor) VisitSwitchStatement(ctx *parser.SwitchStatementContext) any {
+	begin := len(v.circuit.Ops)
+	for _, item := range ctx.AllSwitchCaseItem() {
+		label := "default"
+		if item.DEFAULT() == nil {
+			label = fmt.Sprintf("case %s", xparser.Text(item.ExpressionList()))
+		}
+
+		// each case is grouped in the switch.
+		cbegin := len(v.circuit.Ops)
+		if err := v.Enclosed(func() error {
+			for _, s := range item.Scope().AllStatementOrScope() {
+				if err := v.Body(s); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		v.Group(cbegin, label)
+	}
+
+	v.Group(begin, fmt.Sprintf("switch (%s)", xparser.Text(ctx.Expression())))
+	return nil
+}
+
+func (v *Visitor) VisitBoxStatement(ctx *parser.BoxStatementContext) any {
+	begin := len(v.circuit.Ops)
+	if err := v.Enclosed(func() error {
+		for _, s := range ctx.Scope().AllStatementOrScope() {
+			if err := v.Body(s); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	label := "box"
+	if ctx.Designator() != nil {
+		label = fmt.Sprintf("box%s", xparser.Text(ctx.Designator()))
+	}
+
+	v.Group(begin, label)
+	return nil
+}
+
+// Bits returns the classical wires that the expression refers to in ascending order.
+func (v *Visitor) Bits(tree antlr.Tree) []int {
+	wires := make(map[int]bool)
+	var walk func(t antlr.Tree)
+	walk = func(t antlr.Tree) {
+		switch x := t.(type) {
+		case *parser.IndexExpressionContext:
+			// c[0]
+			lit, ok := x.Expression().(*parser.LiteralExpressionContext)
+			if ok && lit.Identifier() != nil {
+				index, ok := v.Visit(x.IndexOperator()).([]any)
+				if ok && len(index) == 1 {
+					if idx, ok := index[0].(int64); ok {
+						ids, _ := v.GetWire(lit.Identifier().GetText(), idx)
+						for _, w := range ids {
+							wires[w] = v.circuit.Wires[w].Classical
+						}
+
+						return
+					}
+				}
+			}
+		case *parser.LiteralExpressionContext:
+			// c
+			if x.Identifier() != nil {
+				ids, _ := v.GetWire(x.Identifier().GetText())
+				for _, w := range ids {
+					wires[w] = v.circuit.Wires[w].Classical
+				}
+			}
+
+			return
+		}
+
+		for _, c := range t.GetChildren() {
+			walk(c)
+		}
+	}
+	walk(tree)
+
+	var bits []int
+	for _, w := range slices.Sorted(maps.Keys(wires)) {
+		if wires[w] {
+			bits = append(bits, w)
+		}
+	}
+
+	return bits
+}
+
+func (v *Visitor) VisitGateCallStatement(ctx *parser.GateCallStatementContext) any {
+	gate := "gphase"
+	if ctx.Identifier() != nil {
+		id, err := cast[string](v.Visit(ctx.Identifier()))
+		if err != nil {
+			return err
+		}
+
+		gate = id
+	}
+
+	var operands [][]int
+	if ctx.GateOperandList() != nil {
+		for _, operand := range ctx.GateOperandList().AllGateOperand() {
+			wireIDs, err := cast[[]int](v.Visit(operand))
+			if err != nil {
+				return err
+			}
+
+			operands = append(operands, wireIDs)
+		}
+	}
+
+	// U(pi/2, 0, pi) q;
+	var params []float64
+	var unbound string
+	switch {
+	case ctx.ExpressionList() != nil && v.Symbolic(ctx.ExpressionList()):
+		// the params of the definition are drawn as written.
+		unbound = fmt.Sprintf("(%s)", xparser.Text(ctx.ExpressionList()))
+	case ctx.ExpressionList() != nil:
+		p, err := v.eval.Params(ctx.ExpressionList())
+		if err != nil {
+			return err
+		}
+
+		params = p
+	}
+
+	if g, ok := v.env.GetGate(gate); ok && len(ctx.AllGateModifier()) == 0 && unbound == "" && v.Expands(gate) {
+		return v.ExpandGate(g, params, operands)
+	}
+
 	// ctrl(n) @ h q0, q1,...;
+	// negctrl(n) @ h q0, q1,...;
+	// inv @ pow(k) @ h q;
 	var cursor int
-	var ctrls []int
+	var ctrls, negs []int
+	var mods []Modifier
 	for _, mod := range ctx.AllGateModifier() {
 		switch {
+		case mod.INV() != nil:
+			mods = append(mods, Modifier{Name: "inv"})
+		case mod.POW() != nil:
+			p, err := value.New(v.eval.Visit(mod)).Float64()
+			if err != nil {
+				return fmt.Errorf("apply %q: %w", mod.GetText(), err)
+			}
+
+			mods = append(mods, Modifier{Name: "pow", Exponent: p.Value().(float64)})
 		case mod.CTRL() != nil:
 			n, err := cast[int64](v.Visit(mod))
 			if err != nil {
@@ -237,43 +856,68 @@ func (v *Visitor) VisitGateCallStatement(ctx *parser.GateCallStatementContext) a
 			}
 
 			for range n {
-				ctrls = append(ctrls, qargs[cursor])
+				if cursor >= len(operands) {
+					return fmt.Errorf("apply %q: too few operands", mod.GetText())
+				}
+
+				ctrls = append(ctrls, cursor)
+				cursor++
+			}
+		case mod.NEGCTRL() != nil:
+			n, err := cast[int64](v.Visit(mod))
+			if err != nil {
+				return err
+			}
+
+			for range n {
+				if cursor >= len(operands) {
+					return fmt.Errorf("apply %q: too few operands", mod.GetText())
+				}
+
+				negs = append(negs, cursor)
 				cursor++
 			}
 		}
 	}
 
 	// cccx
-	var g strings.Builder
-	for _, s := range gate {
-		if s == 'c' {
-			ctrls = append(ctrls, qargs[cursor])
-			cursor++
-			continue
-		}
-
-		g.WriteString(string(s))
+	name := gate
+	for strings.HasPrefix(name, "c") && len(name) > 1 && cursor < len(operands)-1 {
+		ctrls = append(ctrls, cursor)
+		name = name[1:]
+		cursor++
 	}
 
-	ctrlSet := make(map[int]struct{})
-	for _, c := range ctrls {
-		ctrlSet[c] = struct{}{}
+	// h q; is broadcast to h q[0]; h q[1]; ...
+	size := 1
+	for _, o := range operands {
+		size = max(size, len(o))
 	}
 
-	var targets []int
-	for i := range qargs {
-		if _, ok := ctrlSet[qargs[i]]; ok {
-			continue
+	at := func(list []int, k int) []int {
+		ids := make([]int, len(list))
+		for i, o := range list {
+			ids[i] = operands[o][min(k, len(operands[o])-1)]
 		}
 
-		targets = append(targets, qargs[i])
+		return ids
 	}
 
-	v.circuit.Ops = append(v.circuit.Ops, &Gate{
-		Name:    strings.ToUpper(g.String()),
-		Control: ctrls,
-		Target:  targets,
-	})
+	targets := make([]int, 0, len(operands)-cursor)
+	for i := cursor; i < len(operands); i++ {
+		targets = append(targets, i)
+	}
+
+	for k := range size {
+		v.circuit.Ops = append(v.circuit.Ops, &Gate{
+			Name:       strings.ToUpper(name) + unbound,
+			Params:     params,
+			Modifiers:  mods,
+			Control:    at(ctrls, k),
+			NegControl: at(negs, k),
+			Target:     at(targets, k),
+		})
+	}
 
 	return nil
 }
@@ -293,6 +937,17 @@ func (v *Visitor) VisitGateOperandList(ctx *parser.GateOperandListContext) any {
 }
 
 func (v *Visitor) VisitGateOperand(ctx *parser.GateOperandContext) any {
+	if ctx.HardwareQubit() != nil {
+		// $0, $1, ...
+		id := ctx.HardwareQubit().GetText()
+		wireIDs, ok := v.GetWire(id)
+		if !ok {
+			return fmt.Errorf("undefined %q", id)
+		}
+
+		return wireIDs
+	}
+
 	qargs, err := cast[string](v.Visit(ctx.IndexedIdentifier().Identifier()))
 	if err != nil {
 		return err
@@ -321,9 +976,10 @@ func (v *Visitor) VisitGateModifier(ctx *parser.GateModifierContext) any {
 }
 
 func (v *Visitor) VisitIndexOperator(ctx *parser.IndexOperatorContext) any {
+	// the index such as q[i+1] is evaluated as the simulator does.
 	var list []any
 	for _, x := range ctx.AllExpression() {
-		list = append(list, v.Visit(x))
+		list = append(list, v.eval.Visit(x))
 	}
 
 	return list
@@ -392,49 +1048,50 @@ func (v *Visitor) VisitQubitType(ctx *parser.QubitTypeContext) any {
 }
 
 func (v *Visitor) VisitClassicalDeclarationStatement(ctx *parser.ClassicalDeclarationStatementContext) any {
-	switch {
-	case ctx.ScalarType().INT() != nil:
-		id := v.Visit(ctx.Identifier()).(string)
-		if _, ok := v.env.GetVariable(id); ok {
-			return fmt.Errorf("%q redeclared", id)
-		}
-
+	if ctx.ScalarType() == nil || ctx.ScalarType().BIT() == nil {
+		var x antlr.Tree
 		if ctx.DeclarationExpression() != nil {
-			v.env.SetVariable(id, v.Visit(ctx.DeclarationExpression()))
-			return nil
+			x = ctx.DeclarationExpression()
 		}
 
-		v.env.SetVariable(id, int(0))
-		return nil
-	case ctx.ScalarType().BIT() != nil:
-		wireID, err := cast[string](v.Visit(ctx.Identifier()))
+		return v.Evaluate(ctx, ctx.Identifier().GetText(), x)
+	}
+
+	wireID, err := cast[string](v.Visit(ctx.Identifier()))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case ctx.ScalarType().Designator() != nil:
+		size, err := cast[int64](v.Visit(ctx.ScalarType()))
 		if err != nil {
 			return err
 		}
 
-		switch {
-		case ctx.ScalarType().Designator() != nil:
-			size, err := cast[int64](v.Visit(ctx.ScalarType()))
-			if err != nil {
+		for i := range size {
+			if err := v.AddBitWire(fmt.Sprintf("%s[%d]", wireID, i)); err != nil {
 				return err
 			}
+		}
+	default:
+		if err := v.AddBitWire(wireID); err != nil {
+			return err
+		}
+	}
 
-			for i := range size {
-				if err := v.AddWire(fmt.Sprintf("%s[%d]", wireID, i)); err != nil {
-					return err
-				}
-			}
-
-			return nil
-		default:
-			if err := v.AddWire(wireID); err != nil {
-				return err
-			}
+	if ctx.DeclarationExpression() == nil || ctx.DeclarationExpression().MeasureExpression() == nil {
+		return nil
+	}
 
-			return nil
-		}
+	// bit c = measure q;
+	wireIDs, err := cast[[]int](v.Visit(ctx.DeclarationExpression()))
+	if err != nil {
+		return err
 	}
 
+	targetIDs, _ := v.GetWire(wireID)
+	v.Measure(wireIDs, targetIDs)
 	return nil
 }
 
@@ -462,6 +1119,10 @@ func (v *Visitor) VisitLiteralExpression(ctx *parser.LiteralExpressionContext) a
 			return lit
 		}
 
+		if lit, ok := v.env.GetVariable(s); ok {
+			return lit
+		}
+
 		if _, ok := v.GetWire(s); ok {
 			return s
 		}
@@ -520,28 +1181,312 @@ func (v *Visitor) VisitCallExpression(ctx *parser.CallExpressionContext) any {
 		return err
 	}
 
-	qargs, err := cast[[]any](v.Visit(ctx.ExpressionList()))
-	if err != nil {
-		return err
+	// the qubit arguments are the wires and the others are the values.
+	var args [][]int
+	var values []any
+	if ctx.ExpressionList() != nil {
+		for _, x := range ctx.ExpressionList().AllExpression() {
+			wireIDs, ok := v.Operand(x)
+			if ok {
+				args, values = append(args, wireIDs), append(values, nil)
+				continue
+			}
+
+			val := v.eval.Visit(x)
+			if err, ok := val.(error); ok {
+				return err
+			}
+
+			args, values = append(args, nil), append(values, val)
+		}
+	}
+
+	if s, ok := v.env.GetSubroutine(id); ok && v.Expands(id) {
+		if len(s.QArgs) != len(args) {
+			return fmt.Errorf("call %q: %d arguments, want %d", id, len(args), len(s.QArgs))
+		}
+
+		return v.Expand(id, func() error {
+			for i, name := range s.QArgs {
+				if args[i] == nil {
+					v.env.SetVariable(name, values[i])
+					continue
+				}
+
+				v.Bind(name, args[i])
+			}
+
+			for _, st := range s.Body.AllStatementOrScope() {
+				if err := v.Body(st); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
 	}
 
 	var wireIDs []int
-	for i := range qargs {
-		qarg, err := cast[string](qargs[i])
+	for _, a := range args {
+		wireIDs = append(wireIDs, a...)
+	}
+
+	if len(wireIDs) == 0 {
+		// the calls without qubits are not drawn.
+		return nil
+	}
+
+	v.circuit.Ops = append(v.circuit.Ops, &Subroutine{
+		Name: strings.ToUpper(id),
+		Wire: wireIDs,
+	})
+
+	return nil
+}
+
+// Operand returns the wires of the qubit argument such as q or q[i].
+func (v *Visitor) Operand(x parser.IExpressionContext) ([]int, bool) {
+	switch x := x.(type) {
+	case *parser.LiteralExpressionContext:
+		if x.Identifier() == nil {
+			return nil, false
+		}
+
+		return v.GetWire(x.Identifier().GetText())
+	case *parser.IndexExpressionContext:
+		lit, ok := x.Expression().(*parser.LiteralExpressionContext)
+		if !ok || lit.Identifier() == nil {
+			return nil, false
+		}
+
+		if _, ok := v.GetWire(lit.Identifier().GetText()); !ok {
+			return nil, false
+		}
+
+		index, err := cast[[]any](v.Visit(x.IndexOperator()))
+		if err != nil || len(index) != 1 {
+			return nil, false
+		}
+
+		idx, err := value.New(index[0]).Int64()
 		if err != nil {
+			return nil, false
+		}
+
+		return v.GetWire(lit.Identifier().GetText(), idx.Value().(int64))
+	default:
+		return nil, false
+	}
+}
+
+// Expands returns true if the call of the gate or subroutine is expanded inline.
+func (v *Visitor) Expands(name string) bool {
+	return v.level < v.depth || v.expand[name]
+}
+
+// Expand calls f in the scope of the body of the gate or subroutine.
+// The wires of the scope are bound by f to the arguments with Bind.
+func (v *Visitor) Expand(name string, f func() error) error {
+	if v.level >= MaxDepth {
+		return fmt.Errorf("expand %q: deeper than %d", name, MaxDepth)
+	}
+
+	wire := v.wire
+	defer func() {
+		v.wire = wire
+		v.level--
+	}()
+
+	// the physical qubits are global.
+	v.wire = make(map[string]int)
+	for id, w := range wire {
+		if strings.HasPrefix(id, "$") {
+			v.wire[id] = w
+		}
+	}
+
+	v.level++
+	return v.Enclosed(f)
+}
+
+// Bind binds the name of the argument to the wires in the scope.
+func (v *Visitor) Bind(name string, wireIDs []int) {
+	if len(wireIDs) == 1 {
+		v.wire[name] = wireIDs[0]
+		return
+	}
+
+	for i, w := range wireIDs {
+		v.wire[fmt.Sprintf("%s[%d]", name, i)] = w
+	}
+}
+
+// ExpandGate expands the call of the user-defined gate inline.
+// The register operands are broadcast as in the gate call.
+func (v *Visitor) ExpandGate(g *environ.Gate, params []float64, operands [][]int) error {
+	if len(params) != len(g.Params) || len(operands) != len(g.QArgs) {
+		return fmt.Errorf("apply %q: %d params and %d qubits, want %d and %d", g.Name, len(params), len(operands), len(g.Params), len(g.QArgs))
+	}
+
+	size := 1
+	for _, o := range operands {
+		size = max(size, len(o))
+	}
+
+	for k := range size {
+		if err := v.Expand(g.Name, func() error {
+			for i, p := range g.Params {
+				v.env.SetVariable(p, params[i])
+			}
+
+			for i, q := range g.QArgs {
+				v.Bind(q, []int{operands[i][min(k, len(operands[i])-1)]})
+			}
+
+			for _, s := range g.Body.AllStatementOrScope() {
+				if err := v.Body(s); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}); err != nil {
 			return err
 		}
+	}
 
-		ids, ok := v.GetWire(qarg)
-		if !ok {
-			return fmt.Errorf("undefined %q", qarg)
+	return nil
+}
+
+// Evaluate evaluates the declaration or the assignment of the classical variable as the simulator does,
+// so the loop bounds and the conditions refer to its current value.
+// The variable of the value that depends on the classical bits or the unbound params is known only in the run,
+// and it is kept symbolic.
+func (v *Visitor) Evaluate(ctx antlr.ParserRuleContext, id string, x antlr.Tree) any {
+	delete(v.symbolic, id)
+	if x != nil && (len(v.Bits(x)) > 0 || v.Symbolic(x)) {
+		// int n = c;
+		v.symbolic[id] = true
+		return nil
+	}
+
+	return v.eval.Visit(ctx)
+}
+
+// Symbolic returns true if the tree refers to the unbound params of the definition
+// or the classical variables known only in the run.
+func (v *Visitor) Symbolic(tree antlr.Tree) bool {
+	if len(v.symbolic) == 0 {
+		return false
+	}
+
+	if x, ok := tree.(*parser.LiteralExpressionContext); ok && x.Identifier() != nil {
+		return v.symbolic[x.Identifier().GetText()]
+	}
+
+	for _, c := range tree.GetChildren() {
+		if v.Symbolic(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *Visitor) VisitGateStatement(ctx *parser.GateStatementContext) any {
+	// the definitions are kept in the environment for the expansion.
+	return v.eval.Visit(ctx)
+}
+
+func (v *Visitor) VisitDefStatement(ctx *parser.DefStatementContext) any {
+	return v.eval.Visit(ctx)
+}
+
+// Define builds the circuit of the body of the gate or subroutine definition.
+// The wires are the qubit arguments, and the params and the classical arguments are unbound.
+func (v *Visitor) Define(ctx antlr.ParserRuleContext) (*Circuit, error) {
+	var body parser.IScopeContext
+	switch x := ctx.(type) {
+	case *parser.GateStatementContext:
+		lists := x.AllIdentifierList()
+		if len(lists) == 2 {
+			for _, p := range lists[0].AllIdentifier() {
+				v.symbolic[p.GetText()] = true
+			}
+		}
+
+		for _, q := range lists[len(lists)-1].AllIdentifier() {
+			if err := v.AddWire(q.GetText()); err != nil {
+				return nil, err
+			}
 		}
 
-		wireIDs = append(wireIDs, ids...)
+		body = x.Scope()
+	case *parser.DefStatementContext:
+		if x.ArgumentDefinitionList() != nil {
+			for _, a := range x.ArgumentDefinitionList().AllArgumentDefinition() {
+				id := a.Identifier().GetText()
+
+				var size antlr.ParseTree
+				switch {
+				case a.QubitType() != nil:
+					size = a.QubitType()
+				case a.QREG() != nil && a.Designator() != nil:
+					size = a.Designator()
+				case a.QREG() != nil:
+					// qreg q;
+				default:
+					v.symbolic[id] = true
+					continue
+				}
+
+				n := int64(1)
+				if size != nil {
+					val, err := cast[int64](v.Visit(size))
+					if err != nil {
+						return nil, err
+					}
+
+					n = val
+				}
+
+				ids := []string{id}
+				if n > 1 {
+					ids = ids[:0]
+					for i := range n {
+						ids = append(ids, fmt.Sprintf("%s[%d]", id, i))
+					}
+				}
+
+				for _, wireID := range ids {
+					if err := v.AddWire(wireID); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		body = x.Scope()
+	default:
+		return nil, fmt.Errorf("unsupported definition %q", ctx.GetText())
 	}
 
-	v.circuit.Ops = append(v.circuit.Ops, &Subroutine{
-		Name: strings.ToUpper(id),
+	for _, s := range body.AllStatementOrScope() {
+		if err := v.Body(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return v.circuit, nil
+}
+
+func (v *Visitor) VisitResetStatement(ctx *parser.ResetStatementContext) any {
+	wireIDs, err := cast[[]int](v.Visit(ctx.GateOperand()))
+	if err != nil {
+		return err
+	}
+
+	v.circuit.Ops = append(v.circuit.Ops, &Reset{
 		Wire: wireIDs,
 	})
 
@@ -567,7 +1512,8 @@ func (v *Visitor) VisitConstDeclarationStatement(ctx *parser.ConstDeclarationSta
 		return fmt.Errorf("%q redeclared", id)
 	}
 
-	v.env.Const[id] = v.Visit(ctx.DeclarationExpression())
+	// the classical expression is evaluated as the simulator does.
+	v.env.Const[id] = v.eval.Visit(ctx.DeclarationExpression())
 	return nil
 }
 
@@ -585,3 +1531,12 @@ func cast[T any](result any) (T, error) {
 
 	return resultT, nil
 }
+
+func set(list []int) map[int]bool {
+	s := make(map[int]bool)
+	for _, v := range list {
+		s[v] = true
+	}
+
+	return s
+}
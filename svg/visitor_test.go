@@ -24,6 +24,389 @@ func ExampleVisitor_AddWire() {
 	// "q" redeclared
 }
 
+func ExampleBuild_physical() {
+	program, err := xparser.Parse(`qubit q; cx $2, $0; h q;`)
+	if err != nil {
+		panic(err)
+	}
+
+	c, err := svg.Build(program)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(c.Wires)
+
+	// Output:
+	// [{$0 false} {$2 false} {q false}]
+}
+
+func ExampleBuild_conditional() {
+	program, err := xparser.Parse(`
+	qubit[2] q;
+	bit[2] c;
+	bit m = measure q[0];
+	c = measure q;
+	if (c[1] == 1) { x q[0]; } else { z q[0]; }
+	if (m && !c[0]) { if (c[1]) { y q[1]; } }
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	circuit, err := svg.Build(program)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, w := range circuit.Wires {
+		fmt.Println(w.Name, w.Classical)
+	}
+
+	for _, op := range circuit.Ops {
+		switch o := op.(type) {
+		case *svg.Measurement:
+			fmt.Println("measure", o.Wire, o.Target)
+		case *svg.Gate:
+			fmt.Println(o.Name, o.Target, o.Bit, o.Cond)
+		}
+	}
+
+	// Output:
+	// q[0] false
+	// q[1] false
+	// c[0] true
+	// c[1] true
+	// m true
+	// measure [0] [4]
+	// measure [0] [2]
+	// measure [1] [3]
+	// X [0] [3] c[1] == 1
+	// Z [0] [3] !(c[1] == 1)
+	// Y [1] [2 3 4] (m && !c[0]) && (c[1])
+}
+
+func ExampleBuild_conditionUnroll() {
+	program, err := xparser.Parse(`
+	qubit[2] q;
+	bit[2] c;
+	c = measure q;
+	def f(qubit a, bit b, int k) { if (b == k) { x a; } }
+	for int i in [0:1] { if (c[i]) { x q[1 - i]; } }
+	f(q[0], c[1], 1);
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	circuit, err := svg.Build(program, svg.WithMode(svg.ModeUnroll), svg.WithDepth(1))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, op := range circuit.Ops {
+		if o, ok := op.(*svg.Gate); ok {
+			fmt.Println(o.Name, o.Target, o.Bit, o.Cond)
+		}
+	}
+
+	// Output:
+	// X [1] [2] c[0]
+	// X [0] [3] c[1]
+	// X [0] [3] c[1] == 1
+}
+
+func ExampleBuild_conditionEvaluated() {
+	program, err := xparser.Parse(`
+	qubit[2] q;
+	bit c;
+	int n = 1;
+	int m = 0;
+	c = measure q[0];
+	m = c;
+	if (n == 1) { x q[0]; } else { z q[0]; }
+	if (m == 1) { y q[1]; }
+	if (c) { reset q[1]; x q[1]; }
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	circuit, err := svg.Build(program)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, op := range circuit.Ops {
+		switch o := op.(type) {
+		case *svg.Measurement:
+			fmt.Println("measure", o.Wire, o.Target)
+		case *svg.Gate:
+			fmt.Printf("%s %v %v %q\n", o.Name, o.Target, o.Bit, o.Cond)
+		case *svg.Group:
+			fmt.Println(o.Label, len(o.Ops))
+		}
+	}
+
+	// Output:
+	// measure [0] [2]
+	// X [0] [] ""
+	// Y [1] [] "m == 1"
+	// if (c) 2
+}
+
+func ExampleBuild_params() {
+	program, err := xparser.Parse(`
+	const int n = 2;
+	qubit[2] q;
+	U(pi/2, 0, pi) q[0];
+	inv @ s q[0];
+	pow(1.0/n) @ x q[1];
+	ctrl @ inv @ rz(0.25) q[0], q[1];
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	circuit, err := svg.Build(program)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, op := range circuit.Ops {
+		fmt.Println(op.(*svg.Gate).Label(2))
+	}
+
+	// Output:
+	// U(π/2, 0, π)
+	// S†
+	// X^0.5
+	// RZ(0.25)†
+}
+
+func ExampleBuild_symbols() {
+	program, err := xparser.Parse(`
+	gate g a, b { U(pi, 0, pi) a; }
+	qubit[3] q;
+	reset q[0];
+	h q;
+	swap q[0], q[1];
+	cz q[0], q[2];
+	ctrl @ gphase(pi) q[1];
+	g q[0], q[2];
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	circuit, err := svg.Build(program)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, op := range circuit.Ops {
+		switch o := op.(type) {
+		case *svg.Reset:
+			fmt.Println("reset", o.Wire)
+		case *svg.Gate:
+			fmt.Println(o.Label(2), o.Control, o.Target, svg.Swap(o), svg.CZ(o))
+		}
+	}
+
+	// Output:
+	// reset [0]
+	// H [] [0] false false
+	// H [] [1] false false
+	// H [] [2] false false
+	// SWAP [] [0 1] true false
+	// Z [0] [2] false true
+	// GPHASE(π) [1] [] false false
+	// G [] [0 2] false false
+}
+
+func ExampleBuild_group() {
+	program, err := xparser.Parse(`
+	qubit[3] q;
+	bit c;
+	for int i in [0:1] { h q[i]; cx q[i], q[i+1]; }
+	c = measure q[0];
+	while (c) { x q[0]; c = measure q[0]; }
+	switch (c) { case 0 { x q[2]; } default { z q[2]; } }
+	box { h q; }
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	circuit, err := svg.Build(program)
+	if err != nil {
+		panic(err)
+	}
+
+	var print func(ops []svg.Op, indent string)
+	print = func(ops []svg.Op, indent string) {
+		for _, op := range ops {
+			switch o := op.(type) {
+			case *svg.Group:
+				fmt.Printf("%s%s %v\n", indent, o.Label, o.Wires())
+				print(o.Ops, indent+"  ")
+			case *svg.Gate:
+				fmt.Printf("%s%s %v %v\n", indent, o.Name, o.Control, o.Target)
+			case *svg.Measurement:
+				fmt.Printf("%smeasure %v %v\n", indent, o.Wire, o.Target)
+			}
+		}
+	}
+
+	print(circuit.Ops, "")
+
+	// Output:
+	// for i in [0:1] [0 1]
+	//   H [] [0]
+	//   X [0] [1]
+	// measure [0] [3]
+	// while (c) [0 3]
+	//   X [] [0]
+	//   measure [0] [3]
+	// switch (c) [2]
+	//   case 0 [2]
+	//     X [] [2]
+	//   default [2]
+	//     Z [] [2]
+	// box [0 1 2]
+	//   H [] [0]
+	//   H [] [1]
+	//   H [] [2]
+}
+
+func ExampleWithMode() {
+	program, err := xparser.Parse(`
+	qubit[3] q;
+	for int i in [0:2:2] { h q[i]; }
+	for int i in {1, 0} { x q[i]; }
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	circuit, err := svg.Build(program, svg.WithMode(svg.ModeUnroll))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, op := range circuit.Ops {
+		g := op.(*svg.Gate)
+		fmt.Println(g.Name, g.Target)
+	}
+
+	// Output:
+	// H [0]
+	// H [2]
+	// X [1]
+	// X [0]
+}
+
+func ExampleWithDepth() {
+	program, err := xparser.Parse(`
+	gate x q { U(pi, 0, pi) q; }
+	gate bell a, b { U(pi/2, 0, pi) a; ctrl @ x a, b; }
+	def f(qubit[2] r, int n) { bell r[0], r[1]; x r[n]; }
+	qubit[2] q;
+	f(q, 1);
+	bell q[1], q[0];
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, depth := range []int{0, 1, 2} {
+		circuit, err := svg.Build(program, svg.WithDepth(depth))
+		if err != nil {
+			panic(err)
+		}
+
+		var ops []string
+		for _, op := range circuit.Ops {
+			switch o := op.(type) {
+			case *svg.Subroutine:
+				ops = append(ops, fmt.Sprintf("%s%v", o.Name, o.Wire))
+			case *svg.Gate:
+				ops = append(ops, fmt.Sprintf("%s%v", o.Label(2), o.Wires()))
+			}
+		}
+
+		fmt.Println(depth, ops)
+	}
+
+	// Output:
+	// 0 [F[0 1] BELL[1 0]]
+	// 1 [BELL[0 1] X[1] U(π/2, 0, π)[1] X[1 0]]
+	// 2 [U(π/2, 0, π)[0] X[0 1] U(π, 0, π)[1] U(π/2, 0, π)[1] X[1 0]]
+}
+
+func ExampleWithExpand() {
+	program, err := xparser.Parse(`
+	gate x q { U(pi, 0, pi) q; }
+	gate bell a, b { U(pi/2, 0, pi) a; ctrl @ x a, b; }
+	qubit[2] q;
+	bell q[0], q[1];
+	inv @ bell q[0], q[1];
+	x q;
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	circuit, err := svg.Build(program, svg.WithExpand("bell"))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, op := range circuit.Ops {
+		g := op.(*svg.Gate)
+		fmt.Println(g.Label(2), g.Control, g.Target)
+	}
+
+	// Output:
+	// U(π/2, 0, π) [] [0]
+	// X [0] [1]
+	// BELL† [] [0 1]
+	// X [] [0]
+	// X [] [1]
+}
+
+func ExampleBuild_classicalCall() {
+	program, err := xparser.Parse(`
+	def f(int k) {}
+	def g() {}
+	qubit q;
+	f(1);
+	g();
+	U(pi, 0, pi) q;
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	circuit, err := svg.Build(program)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, op := range circuit.Ops {
+		fmt.Printf("%T\n", op)
+	}
+
+	layout := svg.NewLayout(circuit)
+	fmt.Print(svg.RenderText(layout, 0))
+
+	// Output:
+	// *svg.Gate
+	//     ┌────────────┐
+	// q: ─┤ U(π, 0, π) ├─
+	//     └────────────┘
+}
+
 func TestVisitor_Build(t *testing.T) {
 	cases := []struct {
 		text   string
@@ -70,6 +453,62 @@ func TestVisitor_Build(t *testing.T) {
 			text:   `const int n = 3; qubit[n] q;`,
 			hasErr: false,
 		},
+		{
+			text:   `h $1; cx $1, $0; measure $2;`,
+			hasErr: false,
+		},
+		{
+			text:   `qubit q; cx q, $0;`,
+			hasErr: false,
+		},
+		{
+			text:   `qubit q; bit c; c = measure q; if (c == 1) x q;`,
+			hasErr: false,
+		},
+		{
+			text:   `qubit[2] q; reset q; gphase(pi); ctrl @ gphase(pi) q[0], q[1];`,
+			hasErr: false,
+		},
+		{
+			text:   `qubit[2] q; bit c; c = measure q[0]; if (c) { gphase(pi); }`,
+			hasErr: false,
+		},
+		{
+			text:   `qubit[2] q; int n = 2; for int i in [0:n-1] { h q[i]; } for int i in [1:0] { x q[i]; }`,
+			hasErr: false,
+		},
+		{
+			text:   `def f(qubit a) { x a; } qubit q; f(q, q);`,
+			hasErr: false,
+		},
+		{
+			text:   `qubit q; for int i in [0:1] { x a; }`,
+			hasErr: true,
+			errMsg: `undefined "a"`,
+		},
+		{
+			text:   `qubit q; for int i in [0:0:1] { x q; }`,
+			hasErr: true,
+			errMsg: `invalid step "0:0:1"`,
+		},
+		{
+			text:   `qubit q; bit c; if (c) { for int i in [0:1] { x q; } }`,
+			hasErr: false,
+		},
+		{
+			text:   `qubit q; bit c; if (c) { measure q; } else { reset q; }`,
+			hasErr: false,
+		},
+		{
+			text:   `qubit q; int n = 1; if (n) { x q; }`,
+			hasErr: true,
+			errMsg: `condition must be a bool "n"`,
+		},
+		{
+			text:   `qubit q; bit c; if (c) { x a; }`,
+			hasErr: true,
+			errMsg: `undefined "a"`,
+		},
 		{
 			text:   `int x = 1; int x = 2;`,
 			hasErr: true,
@@ -148,6 +587,71 @@ func TestVisitor_Build(t *testing.T) {
 	}
 }
 
+func TestBuild_iterations(t *testing.T) {
+	cases := []struct {
+		text   string
+		mode   svg.Mode
+		ops    int
+		errMsg string
+	}{
+		{
+			text: `qubit q; for int i in [0:4000000000] { U(pi, 0, pi) q; }`,
+			mode: svg.ModeGroup,
+			ops:  1,
+		},
+		{
+			text:   `qubit q; for int i in [0:4000000000] { U(pi, 0, pi) q; }`,
+			mode:   svg.ModeUnroll,
+			errMsg: "iterations=65537, max=65536: too many iterations",
+		},
+		{
+			text: `qubit q; for int i in [9223372036854775806:9223372036854775807] { U(pi, 0, pi) q; }`,
+			mode: svg.ModeUnroll,
+			ops:  2,
+		},
+		{
+			text: `qubit q; for int i in [-9223372036854775807:-1:-9223372036854775807 - 1] { U(pi, 0, pi) q; }`,
+			mode: svg.ModeUnroll,
+			ops:  2,
+		},
+		{
+			text: `qubit q; int n = 1; n = 3; for int i in [0:n] { U(pi, 0, pi) q; }`,
+			mode: svg.ModeUnroll,
+			ops:  4,
+		},
+		{
+			text: `qubit q; bit c; c = 1; int n = 0; for int i in [0:2] { n = n + i; } for int i in [0:n] { U(pi, 0, pi) q; }`,
+			mode: svg.ModeUnroll,
+			ops:  4,
+		},
+	}
+
+	for _, c := range cases {
+		program, err := xparser.Parse(c.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		circuit, err := svg.Build(program, svg.WithMode(c.mode))
+		if err != nil {
+			if err.Error() != c.errMsg {
+				t.Errorf("%s: got=%v, want=%v", c.text, err, c.errMsg)
+			}
+
+			continue
+		}
+
+		if c.errMsg != "" {
+			t.Errorf("%s: got=nil, want=%v", c.text, c.errMsg)
+			continue
+		}
+
+		if len(circuit.Ops) != c.ops {
+			t.Errorf("%s: got=%d ops, want=%d", c.text, len(circuit.Ops), c.ops)
+		}
+	}
+}
+
 func Test_cast(t *testing.T) {
 	cases := []struct {
 		result any
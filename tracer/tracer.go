@@ -0,0 +1,122 @@
+package tracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/itsubaki/q/math/matrix"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+// Tracer is an observer that writes each event of the execution as a line of JSON.
+// The event field is one of enter, exit, gate, measure, reset, assign, push and pop.
+type Tracer struct {
+	enc *json.Encoder
+}
+
+// New returns a new tracer that writes to w.
+func New(w io.Writer) *Tracer {
+	return &Tracer{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// EnterStatement writes the statement before it is executed.
+func (t *Tracer) EnterStatement(s visitor.Statement) error {
+	return t.write(struct {
+		Event string `json:"event"`
+		visitor.Statement
+	}{"enter", s})
+}
+
+// ExitStatement writes the statement and the error of it after it is executed.
+func (t *Tracer) ExitStatement(s visitor.Statement, err error) error {
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	}
+
+	return t.write(struct {
+		Event string `json:"event"`
+		visitor.Statement
+		Error string `json:"error,omitempty"`
+	}{"exit", s, msg})
+}
+
+// Gate writes the gate with the matrix as the rows of [real, imag] pairs.
+func (t *Tracer) Gate(g visitor.Gate) error {
+	return t.write(struct {
+		Event string `json:"event"`
+		visitor.Gate
+		Matrix [][][2]float64 `json:"matrix"`
+	}{"gate", g, Matrix(g.Matrix)})
+}
+
+// Measure writes the measured qubits and the outcome.
+func (t *Tracer) Measure(m visitor.Measurement) error {
+	return t.write(struct {
+		Event string `json:"event"`
+		visitor.Measurement
+	}{"measure", m})
+}
+
+// Reset writes the reset qubits.
+func (t *Tracer) Reset(r visitor.Reset) error {
+	return t.write(struct {
+		Event string `json:"event"`
+		visitor.Reset
+	}{"reset", r})
+}
+
+// Assign writes the name and the assigned value.
+func (t *Tracer) Assign(a visitor.Assignment) error {
+	return t.write(struct {
+		Event string `json:"event"`
+		visitor.Assignment
+	}{"assign", a})
+}
+
+// PushScope writes the depth of the pushed scope.
+func (t *Tracer) PushScope(s visitor.Scope) error {
+	return t.write(struct {
+		Event string `json:"event"`
+		visitor.Scope
+	}{"push", s})
+}
+
+// PopScope writes the depth of the popped scope.
+func (t *Tracer) PopScope(s visitor.Scope) error {
+	return t.write(struct {
+		Event string `json:"event"`
+		visitor.Scope
+	}{"pop", s})
+}
+
+func (t *Tracer) write(event any) error {
+	if err := t.enc.Encode(event); err != nil {
+		return fmt.Errorf("write trace: %w", err)
+	}
+
+	return nil
+}
+
+// Matrix returns the rows of the matrix as [real, imag] pairs.
+func Matrix(m *matrix.Matrix) [][][2]float64 {
+	if m == nil {
+		return nil
+	}
+
+	rows, cols := m.Dimension()
+	out := make([][][2]float64, rows)
+	for i := range rows {
+		out[i] = make([][2]float64, cols)
+		for j := range cols {
+			v := m.At(i, j)
+			// +0 instead of -0
+			out[i][j] = [2]float64{real(v) + 0, imag(v) + 0}
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,99 @@
+package tracer_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/itsubaki/q"
+	"github.com/itsubaki/qasm/environ"
+	"github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/tracer"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+func ExampleTracer() {
+	program, err := parser.Parse(`qubit q;
+bit c;
+U(0, 0, 0) q;
+c = measure q;
+reset q;`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	v := visitor.New(q.New(), environ.New(), visitor.WithObserver(tracer.New(os.Stdout)))
+	if err := v.Run(program); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"event":"enter","text":"qubit q;","depth":0,"position":{"line":1,"column":0}}
+	// {"event":"exit","text":"qubit q;","depth":0,"position":{"line":1,"column":0}}
+	// {"event":"enter","text":"bit c;","depth":0,"position":{"line":2,"column":0}}
+	// {"event":"exit","text":"bit c;","depth":0,"position":{"line":2,"column":0}}
+	// {"event":"enter","text":"U(0, 0, 0) q;","depth":0,"position":{"line":3,"column":0}}
+	// {"event":"gate","name":"U","target":[0],"position":{"line":3,"column":0},"matrix":[[[1,0],[0,0]],[[0,0],[1,0]]]}
+	// {"event":"exit","text":"U(0, 0, 0) q;","depth":0,"position":{"line":3,"column":0}}
+	// {"event":"enter","text":"c = measure q;","depth":0,"position":{"line":4,"column":0}}
+	// {"event":"measure","qubit":[0],"outcome":[false],"position":{"line":4,"column":4}}
+	// {"event":"assign","name":"c","value":false,"position":{"line":4,"column":0}}
+	// {"event":"exit","text":"c = measure q;","depth":0,"position":{"line":4,"column":0}}
+	// {"event":"enter","text":"reset q;","depth":0,"position":{"line":5,"column":0}}
+	// {"event":"reset","qubit":[0],"position":{"line":5,"column":0}}
+	// {"event":"exit","text":"reset q;","depth":0,"position":{"line":5,"column":0}}
+}
+
+func ExampleTracer_error() {
+	program, err := parser.Parse(`def f(qubit q) { return measure q; }
+qubit q;
+x q;`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	v := visitor.New(q.New(), environ.New(), visitor.WithObserver(tracer.New(os.Stdout)))
+	if err := v.Run(program); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"event":"enter","text":"def f(qubit q) { return measure q; }","depth":0,"position":{"line":1,"column":0}}
+	// {"event":"exit","text":"def f(qubit q) { return measure q; }","depth":0,"position":{"line":1,"column":0}}
+	// {"event":"enter","text":"qubit q;","depth":0,"position":{"line":2,"column":0}}
+	// {"event":"exit","text":"qubit q;","depth":0,"position":{"line":2,"column":0}}
+	// {"event":"enter","text":"x q;","depth":0,"position":{"line":3,"column":0}}
+	// {"event":"exit","text":"x q;","depth":0,"position":{"line":3,"column":0},"error":"undefined \"x\""}
+	// undefined "x"
+}
+
+type writer struct{}
+
+func (writer) Write(p []byte) (int, error) {
+	return 0, os.ErrClosed
+}
+
+func TestTracer_write(t *testing.T) {
+	program, err := parser.Parse(`qubit q; U(pi, 0, pi) q;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := environ.New()
+	v := visitor.New(q.New(), env, visitor.WithObserver(tracer.New(writer{})))
+	if err := v.Run(program); err == nil || err.Error() != "write trace: file already closed" {
+		t.Errorf("got=%v, want=write trace: file already closed", err)
+	}
+
+	if _, ok := env.GetQubit("q"); ok {
+		t.Errorf("the statement is executed after the error")
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	if got := tracer.Matrix(nil); got != nil {
+		t.Errorf("got=%v, want=nil", got)
+	}
+}
@@ -0,0 +1,51 @@
+package transpile
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/itsubaki/q/math/matrix"
+	"github.com/itsubaki/q/quantum/gate"
+)
+
+// Gate is a gate of the basis.
+type Gate struct {
+	Name       string
+	Params     int
+	Qubits     int
+	Definition string
+}
+
+// Gates are the supported basis gates.
+// The definitions follow the OpenQASM 3 standard library including the global phase.
+var Gates = map[string]Gate{
+	"u3": {Name: "u3", Params: 3, Qubits: 1, Definition: "gate u3(theta, phi, lambda) q { U(theta, phi, lambda) q; }"},
+	"u":  {Name: "u", Params: 3, Qubits: 1, Definition: "gate u(theta, phi, lambda) q { U(theta, phi, lambda) q; }"},
+	"rz": {Name: "rz", Params: 1, Qubits: 1, Definition: "gate rz(theta) q { gphase(-theta/2); U(0, 0, theta) q; }"},
+	"ry": {Name: "ry", Params: 1, Qubits: 1, Definition: "gate ry(theta) q { U(theta, 0, 0) q; }"},
+	"rx": {Name: "rx", Params: 1, Qubits: 1, Definition: "gate rx(theta) q { U(theta, -pi/2, pi/2) q; }"},
+	"sx": {Name: "sx", Params: 0, Qubits: 1, Definition: "gate sx q { gphase(pi/4); U(pi/2, -pi/2, pi/2) q; }"},
+	"x":  {Name: "x", Params: 0, Qubits: 1, Definition: "gate x q { U(pi, 0, pi) q; }"},
+	"cx": {Name: "cx", Params: 0, Qubits: 2, Definition: "gate cx c, t { ctrl @ U(pi, 0, pi) c, t; }"},
+	"cz": {Name: "cz", Params: 0, Qubits: 2, Definition: "gate cz c, t { ctrl @ U(0, 0, pi) c, t; }"},
+}
+
+// Matrix returns the 2x2 unitary of the single-qubit basis gate.
+func Matrix(name string, params ...float64) *matrix.Matrix {
+	switch name {
+	case "u3", "u":
+		return gate.U(params[0], params[1], params[2])
+	case "rz":
+		return gate.U(0, 0, params[0]).Mul(cmplx.Exp(complex(0, -params[0]/2)))
+	case "ry":
+		return gate.U(params[0], 0, 0)
+	case "rx":
+		return gate.U(params[0], -math.Pi/2, math.Pi/2)
+	case "sx":
+		return gate.U(math.Pi/2, -math.Pi/2, math.Pi/2).Mul(cmplx.Exp(complex(0, math.Pi/4)))
+	case "x":
+		return gate.U(math.Pi, 0, math.Pi)
+	default:
+		return nil
+	}
+}
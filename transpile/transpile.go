@@ -0,0 +1,366 @@
+package transpile
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"slices"
+
+	"github.com/itsubaki/q/math/epsilon"
+	"github.com/itsubaki/q/math/matrix"
+	"github.com/itsubaki/q/quantum/gate"
+	"github.com/itsubaki/qasm/flatten"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+var ErrUnsupportedBasis = errors.New("unsupported basis")
+
+// Transpiler decomposes a straight-line program into the basis gates.
+type Transpiler struct {
+	basis   []string
+	single  string
+	entangl string
+	phase   bool
+}
+
+// Option is a function that modifies the Transpiler.
+type Option func(*Transpiler)
+
+// WithGlobalPhase tracks the global phase exactly with gphase statements.
+func WithGlobalPhase() Option {
+	return func(t *Transpiler) {
+		t.phase = true
+	}
+}
+
+// New returns a new Transpiler for the basis such as {rz, sx, x, cx} or {u3, cz}.
+func New(basis []string, opts ...Option) (*Transpiler, error) {
+	has := make(map[string]bool)
+	for _, name := range basis {
+		if _, ok := Gates[name]; !ok {
+			return nil, fmt.Errorf("gate %q: %w", name, ErrUnsupportedBasis)
+		}
+
+		has[name] = true
+	}
+
+	t := &Transpiler{
+		basis: basis,
+	}
+
+	switch {
+	case has["u3"]:
+		t.single = "u3"
+	case has["u"]:
+		t.single = "u"
+	case has["rz"] && has["sx"]:
+		t.single = "zsx"
+	case has["rz"] && has["ry"]:
+		t.single = "zyz"
+	case has["rz"] && has["rx"]:
+		t.single = "zxz"
+	default:
+		return nil, fmt.Errorf("%v has no universal single-qubit gates: %w", basis, ErrUnsupportedBasis)
+	}
+
+	switch {
+	case has["cx"]:
+		t.entangl = "cx"
+	case has["cz"]:
+		t.entangl = "cz"
+	}
+
+	if t.single == "zsx" && has["x"] {
+		// x is used for U(pi, phi, lambda).
+		t.single = "zsxx"
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t, nil
+}
+
+// Transpile returns the program decomposed into the basis gates.
+func Transpile(p *flatten.Program, basis []string, opts ...Option) (*flatten.Program, error) {
+	t, err := New(basis, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Transpile(p)
+}
+
+// Transpile returns the program decomposed into the basis gates.
+func (t *Transpiler) Transpile(p *flatten.Program) (*flatten.Program, error) {
+	out := &flatten.Program{
+		Qubits: p.Qubits,
+		Bits:   p.Bits,
+	}
+
+	var phase float64
+	used := make(map[string]bool)
+	for _, op := range p.Ops {
+		if _, ok := Gates[op.Name]; ok {
+			// already in the basis. e.g. transpiled and then routed.
+			used[op.Name] = true
+		}
+
+		if op.Name != flatten.U && op.Name != flatten.GPhase && op.Name != "swap" {
+			out.Ops = append(out.Ops, op)
+			continue
+		}
+
+		ops, gamma, err := t.Decompose(op)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range ops {
+			ops[i].Cond = op.Cond
+			used[ops[i].Name] = true
+		}
+
+		out.Ops = append(out.Ops, ops...)
+		if !t.phase || epsilon.IsZeroF64(flatten.Wrap(gamma)) {
+			continue
+		}
+
+		if op.Cond != "" {
+			// the phase is applied only if the condition holds.
+			out.Ops = append(out.Ops, flatten.Op{
+				Name:   flatten.GPhase,
+				Params: []float64{flatten.Wrap(gamma)},
+				Cond:   op.Cond,
+			})
+
+			continue
+		}
+
+		phase += gamma
+	}
+
+	if t.phase && !epsilon.IsZeroF64(flatten.Wrap(phase)) {
+		out.Ops = append([]flatten.Op{{
+			Name:   flatten.GPhase,
+			Params: []float64{flatten.Wrap(phase)},
+		}}, out.Ops...)
+	}
+
+	for _, name := range t.basis {
+		if used[name] {
+			out.Gates = append(out.Gates, Gates[name].Definition)
+		}
+	}
+
+	return out, nil
+}
+
+// Decompose returns the basis gates and the global phase gamma of the U, gphase, swap, cx or cz op,
+// such that the op is exp(i*gamma) times the basis gates.
+func (t *Transpiler) Decompose(op flatten.Op) ([]flatten.Op, float64, error) {
+	switch op.Name {
+	case flatten.GPhase:
+		return nil, op.Params[0], nil
+	case flatten.U:
+		u := gate.U(op.Params[0], op.Params[1], op.Params[2])
+		switch len(op.Control) {
+		case 0:
+			ops, gamma := t.Single(u, op.Target[0])
+			return ops, gamma, nil
+		case 1:
+			return t.decompose(t.Controlled(u, op.Control[0], op.Target[0]))
+		default:
+			return t.decompose(t.MultiControlled(u, op.Control, op.Target[0]))
+		}
+	case "swap":
+		a, b := op.Target[0], op.Target[1]
+		return t.decompose([]flatten.Op{
+			{Name: "cx", Control: []int{a}, Target: []int{b}},
+			{Name: "cx", Control: []int{b}, Target: []int{a}},
+			{Name: "cx", Control: []int{a}, Target: []int{b}},
+		})
+	case "cx", "cz":
+		if t.entangl == "" {
+			return nil, 0, fmt.Errorf("%v has no two-qubit gates: %w", t.basis, ErrUnsupportedBasis)
+		}
+
+		if op.Name == t.entangl {
+			return []flatten.Op{op}, 0, nil
+		}
+
+		// cx = (I x H) cz (I x H), cz = (I x H) cx (I x H)
+		h := flatten.Op{Name: flatten.U, Params: []float64{math.Pi / 2, 0, math.Pi}, Target: op.Target}
+		return t.decompose([]flatten.Op{h, {Name: t.entangl, Control: op.Control, Target: op.Target}, h})
+	default:
+		return nil, 0, fmt.Errorf("decompose %q: %w", op.Name, visitor.ErrNotImplemented)
+	}
+}
+
+func (t *Transpiler) decompose(ops []flatten.Op) ([]flatten.Op, float64, error) {
+	var out []flatten.Op
+	var phase float64
+	for _, op := range ops {
+		d, gamma, err := t.Decompose(op)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		out = append(out, d...)
+		phase += gamma
+	}
+
+	return out, phase, nil
+}
+
+// Single returns the basis gates and the global phase of the single-qubit unitary.
+func (t *Transpiler) Single(u *matrix.Matrix, target int) ([]flatten.Op, float64) {
+	theta, phi, lambda, _ := flatten.Euler(u)
+
+	var seq []flatten.Op
+	op := func(name string, params ...float64) {
+		if name == "rz" && epsilon.IsZeroF64(flatten.Wrap(params[0])) {
+			return
+		}
+
+		seq = append(seq, flatten.Op{
+			Name:   name,
+			Params: params,
+			Target: []int{target},
+		})
+	}
+
+	rz := func(radian float64) {
+		op("rz", flatten.Wrap(radian))
+	}
+
+	switch {
+	case t.single == "u3" || t.single == "u":
+		if !epsilon.IsZeroF64(theta) || !epsilon.IsZeroF64(flatten.Wrap(phi+lambda)) {
+			op(t.single, theta, phi, lambda)
+		}
+	case epsilon.IsZeroF64(theta):
+		rz(phi + lambda)
+	case t.single == "zsxx" && epsilon.IsZeroF64(theta-math.Pi):
+		rz(lambda + math.Pi)
+		op("x")
+		rz(phi)
+	case t.single == "zsx" || t.single == "zsxx":
+		if epsilon.IsZeroF64(theta - math.Pi/2) {
+			rz(lambda - math.Pi/2)
+			op("sx")
+			rz(phi + math.Pi/2)
+			break
+		}
+
+		rz(lambda)
+		op("sx")
+		rz(theta + math.Pi)
+		op("sx")
+		rz(phi + math.Pi)
+	case t.single == "zyz":
+		rz(lambda)
+		op("ry", theta)
+		rz(phi)
+	case t.single == "zxz":
+		rz(lambda - math.Pi/2)
+		op("rx", theta)
+		rz(phi + math.Pi/2)
+	}
+
+	return seq, Phase(u, seq)
+}
+
+// Controlled returns the CNOT decomposition of the controlled unitary.
+// See https://arxiv.org/abs/quant-ph/9503016, Lemma 5.1.
+func (t *Transpiler) Controlled(u *matrix.Matrix, ctrl, target int) []flatten.Op {
+	switch {
+	case u.Equal(gate.X()):
+		return []flatten.Op{{Name: "cx", Control: []int{ctrl}, Target: []int{target}}}
+	case u.Equal(gate.Z()):
+		return []flatten.Op{{Name: "cz", Control: []int{ctrl}, Target: []int{target}}}
+	}
+
+	theta, phi, lambda, gamma := flatten.Euler(u)
+	U := func(q int, theta, phi, lambda float64) flatten.Op {
+		return flatten.Op{Name: flatten.U, Params: []float64{theta, phi, lambda}, Target: []int{q}}
+	}
+
+	cx := flatten.Op{Name: "cx", Control: []int{ctrl}, Target: []int{target}}
+	return []flatten.Op{
+		U(ctrl, 0, 0, gamma+(lambda+phi)/2),
+		U(target, 0, 0, (lambda-phi)/2),
+		cx,
+		U(target, -theta/2, 0, -(phi+lambda)/2),
+		cx,
+		U(target, theta/2, phi, 0),
+	}
+}
+
+// MultiControlled returns the decomposition of the multi-controlled unitary into fewer controls.
+// See https://arxiv.org/abs/quant-ph/9503016, Lemma 7.5.
+func (t *Transpiler) MultiControlled(u *matrix.Matrix, ctrl []int, target int) []flatten.Op {
+	if len(ctrl) == 2 && u.Equal(gate.X()) {
+		return Toffoli(ctrl[0], ctrl[1], target)
+	}
+
+	// V^2 = U
+	theta, phi, lambda, gamma := flatten.Euler(visitor.Pow2x2(u, 0.5))
+	v := []flatten.Op{
+		{Name: flatten.GPhase, Params: []float64{gamma}},
+		{Name: flatten.U, Params: []float64{theta, phi, lambda}, Target: []int{target}},
+	}
+
+	last, rest := ctrl[len(ctrl)-1:], slices.Clone(ctrl[:len(ctrl)-1])
+
+	var out []flatten.Op
+	out = append(out, flatten.Controlled(v, last)...)
+	out = append(out, flatten.Controlled(flatten.X(last[0]), rest)...)
+	out = append(out, flatten.Controlled(flatten.Inverse(v), last)...)
+	out = append(out, flatten.Controlled(flatten.X(last[0]), rest)...)
+	out = append(out, flatten.Controlled(v, rest)...)
+	return out
+}
+
+// Toffoli returns the CNOT decomposition of the Toffoli gate.
+func Toffoli(a, b, c int) []flatten.Op {
+	U := func(q int, theta, phi, lambda float64) flatten.Op {
+		return flatten.Op{Name: flatten.U, Params: []float64{theta, phi, lambda}, Target: []int{q}}
+	}
+
+	h := func(q int) flatten.Op { return U(q, math.Pi/2, 0, math.Pi) }
+	tg := func(q int) flatten.Op { return U(q, 0, 0, math.Pi/4) }
+	tdg := func(q int) flatten.Op { return U(q, 0, 0, -math.Pi/4) }
+	cx := func(c, t int) flatten.Op { return flatten.Op{Name: "cx", Control: []int{c}, Target: []int{t}} }
+
+	return []flatten.Op{
+		h(c),
+		cx(b, c), tdg(c),
+		cx(a, c), tg(c),
+		cx(b, c), tdg(c),
+		cx(a, c), tg(b), tg(c), h(c),
+		cx(a, b), tg(a), tdg(b),
+		cx(a, b),
+	}
+}
+
+// Phase returns gamma such that u = exp(i*gamma) times the product of the single-qubit basis gates.
+func Phase(u *matrix.Matrix, seq []flatten.Op) float64 {
+	m := matrix.Identity(2)
+	for _, op := range seq {
+		m = Matrix(op.Name, op.Params...).MatMul(m)
+	}
+
+	var i, j int
+	for r := range 2 {
+		for c := range 2 {
+			if cmplx.Abs(m.At(r, c)) > cmplx.Abs(m.At(i, j)) {
+				i, j = r, c
+			}
+		}
+	}
+
+	return cmplx.Phase(u.At(i, j) / m.At(i, j))
+}
@@ -0,0 +1,242 @@
+package transpile_test
+
+import (
+	"errors"
+	"fmt"
+	"math/cmplx"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/itsubaki/q/math/epsilon"
+	"github.com/itsubaki/qasm/flatten"
+	"github.com/itsubaki/qasm/transpile"
+	"github.com/itsubaki/qasm/visitor"
+)
+
+func ExampleTranspile() {
+	p, err := flatten.Flatten(`
+	qubit[2] q;
+	U(pi/2.0, 0, pi) q[0];
+	ctrl @ U(pi, 0, pi) q[0], q[1];
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	out, err := transpile.Transpile(p, []string{"rz", "sx", "x", "cz"})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(out)
+
+	// Output:
+	// OPENQASM 3.0;
+	// gate rz(theta) q { gphase(-theta/2); U(0, 0, theta) q; }
+	// gate sx q { gphase(pi/4); U(pi/2, -pi/2, pi/2) q; }
+	// gate cz c, t { ctrl @ U(0, 0, pi) c, t; }
+	// qubit[2] q;
+	// rz(1.5707963267948966) q[0];
+	// sx q[0];
+	// rz(1.5707963267948966) q[0];
+	// rz(1.5707963267948966) q[1];
+	// sx q[1];
+	// rz(1.5707963267948966) q[1];
+	// cz q[0], q[1];
+	// rz(1.5707963267948966) q[1];
+	// sx q[1];
+	// rz(1.5707963267948966) q[1];
+}
+
+func ExampleWithGlobalPhase() {
+	p, err := flatten.Flatten(`
+	qubit q;
+	U(pi/2.0, 0, pi) q;
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	out, err := transpile.Transpile(p, []string{"rz", "sx"}, transpile.WithGlobalPhase())
+	if err != nil {
+		panic(err)
+	}
+
+	for _, op := range out.Ops {
+		fmt.Println(out.Statement(op))
+	}
+
+	// Output:
+	// gphase(0.7853981633974483);
+	// rz(1.5707963267948966) q;
+	// sx q;
+	// rz(1.5707963267948966) q;
+}
+
+func TestTranspile(t *testing.T) {
+	bases := [][]string{
+		{"rz", "sx", "x", "cx"},
+		{"rz", "sx", "cz"},
+		{"u3", "cz"},
+		{"u", "cx"},
+		{"rz", "ry", "cx"},
+		{"rz", "rx", "cz"},
+	}
+
+	cases := []string{
+		"../testdata/deutsch_jozsa_constant.qasm",
+		"../testdata/deutsch_jozsa_balanced.qasm",
+		"../testdata/grover.qasm",
+		"../testdata/qft.qasm",
+		"../testdata/qsp.qasm",
+		"../testdata/quantum_counting.qasm",
+		`
+		qubit[4] q;
+		U(0.1, 0.2, 0.3) q;
+		ctrl @ U(1.1, -0.4, 2.3) q[0], q[1];
+		ctrl(2) @ U(pi, 0, pi) q[1], q[2], q[3];
+		ctrl(2) @ U(0.7, 0.3, -1.2) q[0], q[3], q[1];
+		ctrl(3) @ U(pi, 0, pi) q[0], q[1], q[2], q[3];
+		negctrl @ ctrl @ U(0.5, 1.5, 2.5) q[3], q[0], q[2];
+		ctrl @ gphase(0.3) q[2];
+		pow(0.25) @ U(pi, 0, pi) q[1];
+		U(pi, 0.4, 0.2) q[2];
+		U(pi/2.0, 0.4, 0.2) q[3];
+		`,
+	}
+
+	for _, basis := range bases {
+		for _, c := range cases {
+			text := c
+			if b, err := os.ReadFile(c); err == nil {
+				text = string(b)
+			}
+
+			p, err := flatten.Flatten(text)
+			if err != nil {
+				t.Fatalf("%s: %v", c, err)
+			}
+
+			out, err := transpile.Transpile(p, basis)
+			if err != nil {
+				t.Fatalf("%v %s: %v", basis, c, err)
+			}
+
+			for _, op := range out.Ops {
+				if op.Name == flatten.Measure || op.Name == flatten.Reset || op.Name == flatten.Barrier {
+					continue
+				}
+
+				if !slices.Contains(basis, op.Name) {
+					t.Errorf("%v: unexpected %s", basis, out.Statement(op))
+				}
+			}
+
+			want, _, err := visitor.Run(p.String())
+			if err != nil {
+				t.Fatalf("%s: %v", c, err)
+			}
+
+			got, _, err := visitor.Run(out.String())
+			if err != nil {
+				t.Fatalf("%s: %v", out, err)
+			}
+
+			// equal up to global phase
+			var inner complex128
+			for i, a := range want.Amplitude() {
+				inner += cmplx.Conj(a) * got.Amplitude()[i]
+			}
+
+			if !epsilon.IsZeroF64(cmplx.Abs(inner)-1, 1e-8) {
+				t.Errorf("%v %s: |<want|got>|=%v", basis, c, cmplx.Abs(inner))
+			}
+		}
+	}
+}
+
+func TestWithGlobalPhase(t *testing.T) {
+	bases := [][]string{
+		{"rz", "sx", "x"},
+		{"rz", "sx"},
+		{"u3"},
+		{"rz", "ry"},
+		{"rz", "rx"},
+	}
+
+	cases := []string{
+		`qubit q; U(0.1, 0.2, 0.3) q;`,
+		`qubit q; U(pi, 0.2, 0.3) q;`,
+		`qubit q; U(pi/2.0, 0.2, 0.3) q;`,
+		`qubit q; U(0, 0.2, 0.3) q; gphase(1.2);`,
+		`qubit q; pow(0.5) @ U(pi, 0, pi) q;`,
+		`qubit q; U(0.1, 0.2, 0.3) q; inv @ U(0.1, 0.2, 0.3) q;`,
+	}
+
+	for _, basis := range bases {
+		for _, c := range cases {
+			p, err := flatten.Flatten(c)
+			if err != nil {
+				t.Fatalf("%s: %v", c, err)
+			}
+
+			out, err := transpile.Transpile(p, basis, transpile.WithGlobalPhase())
+			if err != nil {
+				t.Fatalf("%v %s: %v", basis, c, err)
+			}
+
+			want, _, err := visitor.Run(p.String())
+			if err != nil {
+				t.Fatalf("%s: %v", c, err)
+			}
+
+			got, _, err := visitor.Run(out.String())
+			if err != nil {
+				t.Fatalf("%s: %v", out, err)
+			}
+
+			for i, a := range want.Amplitude() {
+				if !epsilon.IsClose(a, got.Amplitude()[i], 1e-8) {
+					t.Errorf("%v %s: got=%v, want=%v", basis, c, got.Amplitude(), want.Amplitude())
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestTranspile_error(t *testing.T) {
+	cases := []struct {
+		basis  []string
+		text   string
+		target error
+	}{
+		{
+			basis:  []string{"rz", "foo"},
+			text:   `qubit q;`,
+			target: transpile.ErrUnsupportedBasis,
+		},
+		{
+			basis:  []string{"rz", "cx"},
+			text:   `qubit q;`,
+			target: transpile.ErrUnsupportedBasis,
+		},
+		{
+			basis:  []string{"u3"},
+			text:   `qubit[2] q; ctrl @ U(pi, 0, pi) q[0], q[1];`,
+			target: transpile.ErrUnsupportedBasis,
+		},
+	}
+
+	for _, c := range cases {
+		p, err := flatten.Flatten(c.text)
+		if err != nil {
+			t.Fatalf("%s: %v", c.text, err)
+		}
+
+		if _, err := transpile.Transpile(p, c.basis); !errors.Is(err, c.target) {
+			t.Errorf("got=%v, want=%v", err, c.target)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package visitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// Check returns an error if the execution is stopped, the context is done or the time is over.
+// The execution is stopped with the error.
+func (v *Visitor) Check() error {
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	if err := v.ctx.Err(); err != nil {
+		return v.stop(err)
+	}
+
+	if !v.deadline.IsZero() && time.Now().After(v.deadline) {
+		return v.stop(fmt.Errorf("timeout=%v: %w", v.timeout, ErrTimeout))
+	}
+
+	return nil
+}
+
+// Count counts the statement to be executed and checks the limits.
+func (v *Visitor) Count() error {
+	if err := v.Check(); err != nil {
+		return err
+	}
+
+	*v.statements++
+	if v.maxStatements > 0 && *v.statements > v.maxStatements {
+		return v.stop(fmt.Errorf("statements=%d, max=%d: %w", *v.statements, v.maxStatements, ErrTooManyStatements))
+	}
+
+	return nil
+}
+
+// Iterate checks the limits before the nth iteration of the loop.
+func (v *Visitor) Iterate(n int) error {
+	if err := v.Check(); err != nil {
+		return err
+	}
+
+	if v.maxIterations > 0 && n > v.maxIterations {
+		return v.stop(fmt.Errorf("iterations=%d, max=%d: %w", n, v.maxIterations, ErrTooManyIterations))
+	}
+
+	return nil
+}
+
+// Deepen checks the depth of the calls after it is incremented.
+func (v *Visitor) Deepen() error {
+	if v.maxDepth > 0 && v.depth > v.maxDepth {
+		return v.stop(fmt.Errorf("depth=%d, max=%d: %w", v.depth, v.maxDepth, ErrTooDeep))
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package visitor
+
+import (
+	"github.com/antlr4-go/antlr/v4"
+	"github.com/itsubaki/q"
+	"github.com/itsubaki/q/math/matrix"
+	"github.com/itsubaki/qasm/environ"
+	"github.com/itsubaki/qasm/gen/parser"
+	xparser "github.com/itsubaki/qasm/parser"
+)
+
+// Observer is notified of the execution of the visitor.
+// The execution is canceled if a method returns an error, and the visitor returns the error.
+type Observer interface {
+	EnterStatement(s Statement) error
+	ExitStatement(s Statement, err error) error
+	Gate(g Gate) error
+	Measure(m Measurement) error
+	Reset(r Reset) error
+	Assign(a Assignment) error
+	PushScope(s Scope) error
+	PopScope(s Scope) error
+}
+
+// Position is the line and the column of the source.
+// The line starts at 1 and the column starts at 0.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Statement is the statement executed in the depth of the gate and subroutine calls.
+type Statement struct {
+	Context  *parser.StatementContext `json:"-"`
+	Text     string                   `json:"text"`
+	Depth    int                      `json:"depth"`
+	Position Position                 `json:"position"`
+}
+
+// Gate is the builtin gate applied to the state.
+// Control contains the negated controls, which are flipped before and after the gate.
+// Target is the qubits the matrix is applied to one by one without the controls.
+type Gate struct {
+	Name       string         `json:"name"`
+	Matrix     *matrix.Matrix `json:"-"`
+	Control    []q.Qubit      `json:"control,omitempty"`
+	NegControl []q.Qubit      `json:"negcontrol,omitempty"`
+	Target     []q.Qubit      `json:"target"`
+	Position   Position       `json:"position"`
+}
+
+// Measurement is the measurement of the qubits and the outcome of each qubit.
+type Measurement struct {
+	Qubit    []q.Qubit `json:"qubit"`
+	Outcome  []bool    `json:"outcome"`
+	Position Position  `json:"position"`
+}
+
+// Reset is the reset of the qubits.
+type Reset struct {
+	Qubit    []q.Qubit `json:"qubit"`
+	Position Position  `json:"position"`
+}
+
+// Assignment is the value assigned to the variable or the bits.
+type Assignment struct {
+	Name     string   `json:"name"`
+	Value    any      `json:"value"`
+	Position Position `json:"position"`
+}
+
+// Scope is the scope pushed for a block, a gate call or a subroutine call.
+type Scope struct {
+	Env   *environ.Environ `json:"-"`
+	Depth int              `json:"depth"`
+}
+
+// NopObserver is an observer that does nothing.
+// It is embedded to implement only some of the methods.
+type NopObserver struct{}
+
+func (NopObserver) EnterStatement(s Statement) error           { return nil }
+func (NopObserver) ExitStatement(s Statement, err error) error { return nil }
+func (NopObserver) Gate(g Gate) error                          { return nil }
+func (NopObserver) Measure(m Measurement) error                { return nil }
+func (NopObserver) Reset(r Reset) error                        { return nil }
+func (NopObserver) Assign(a Assignment) error                  { return nil }
+func (NopObserver) PushScope(s Scope) error                    { return nil }
+func (NopObserver) PopScope(s Scope) error                     { return nil }
+
+func position(ctx antlr.ParserRuleContext) Position {
+	return Position{
+		Line:   ctx.GetStart().GetLine(),
+		Column: ctx.GetStart().GetColumn(),
+	}
+}
+
+func (v *Visitor) statement(ctx *parser.StatementContext) Statement {
+	return Statement{
+		Context:  ctx,
+		Text:     xparser.Text(ctx),
+		Depth:    v.depth,
+		Position: position(ctx),
+	}
+}
+
+// notify calls the observer if any, and stops the execution if it returns an error.
+func (v *Visitor) notify(f func(o Observer) error) error {
+	if v.observer == nil {
+		return nil
+	}
+
+	if err := f(v.observer); err != nil {
+		return v.stop(err)
+	}
+
+	return nil
+}
+
+// stop stops the execution with the error.
+// The statements after it are not executed and return the first error.
+func (v *Visitor) stop(err error) error {
+	if *v.err == nil {
+		*v.err = err
+	}
+
+	return *v.err
+}
+
+// Err returns the error the execution is stopped with.
+func (v *Visitor) Err() error {
+	return *v.err
+}
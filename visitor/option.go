@@ -1,5 +1,13 @@
 package visitor
 
+import (
+	"context"
+	"time"
+
+	"github.com/itsubaki/qasm/environ"
+	"github.com/itsubaki/qasm/gen/parser"
+)
+
 // Option is a function that modifies the Visitor.
 type Option func(*Visitor)
 
@@ -9,3 +17,65 @@ func WithMaxQubits(n int) Option {
 		v.maxQubits = n
 	}
 }
+
+// WithPhysicalQubits sets the number of physical qubits of the device.
+// All the physical qubits $0, $1, ... are allocated on the first use of any of them.
+func WithPhysicalQubits(n int) Option {
+	return func(v *Visitor) {
+		v.physicalQubits = n
+	}
+}
+
+// Hook is called before each statement with the environment of the statement
+// and the depth of the gate and subroutine calls. The statement is not executed if the hook returns an error.
+type Hook func(ctx *parser.StatementContext, env *environ.Environ, depth int) error
+
+// WithHook sets the hook called before each statement.
+func WithHook(hook Hook) Option {
+	return func(v *Visitor) {
+		v.hook = hook
+	}
+}
+
+// WithObserver sets the observer notified of the execution.
+func WithObserver(o Observer) Option {
+	return func(v *Visitor) {
+		v.observer = o
+	}
+}
+
+// WithContext sets the context checked before each statement and each iteration of the loops.
+func WithContext(ctx context.Context) Option {
+	return func(v *Visitor) {
+		v.ctx = ctx
+	}
+}
+
+// WithMaxIterations sets the maximum number of iterations of each loop.
+func WithMaxIterations(n int) Option {
+	return func(v *Visitor) {
+		v.maxIterations = n
+	}
+}
+
+// WithMaxStatements sets the maximum number of statements executed in total.
+// The statements in the bodies of the gates, the subroutines and the loops are counted each time.
+func WithMaxStatements(n int) Option {
+	return func(v *Visitor) {
+		v.maxStatements = n
+	}
+}
+
+// WithMaxDepth sets the maximum depth of the gate and subroutine calls.
+func WithMaxDepth(n int) Option {
+	return func(v *Visitor) {
+		v.maxDepth = n
+	}
+}
+
+// WithTimeout sets the wall-clock time of the execution from the creation of the visitor.
+func WithTimeout(d time.Duration) Option {
+	return func(v *Visitor) {
+		v.timeout = d
+	}
+}
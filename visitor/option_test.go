@@ -1,11 +1,15 @@
 package visitor_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/itsubaki/q"
 	"github.com/itsubaki/qasm/environ"
-	"github.com/itsubaki/qasm/parser"
+	"github.com/itsubaki/qasm/gen/parser"
+	xparser "github.com/itsubaki/qasm/parser"
 	"github.com/itsubaki/qasm/visitor"
 )
 
@@ -16,7 +20,7 @@ func ExampleWithMaxQubits() {
 		visitor.WithMaxQubits(5),
 	)
 
-	program, err := parser.Parse(`qubit[10] q;`)
+	program, err := xparser.Parse(`qubit[10] q;`)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -37,7 +41,7 @@ func ExampleWithMaxQubits_oldstyle() {
 		visitor.WithMaxQubits(5),
 	)
 
-	program, err := parser.Parse(`qreg q[10];`)
+	program, err := xparser.Parse(`qreg q[10];`)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -59,7 +63,7 @@ func ExampleWithMaxQubits_unlimited() {
 		visitor.WithMaxQubits(0),
 	)
 
-	program, err := parser.Parse(`qubit[10] q;`)
+	program, err := xparser.Parse(`qubit[10] q;`)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -74,3 +78,245 @@ func ExampleWithMaxQubits_unlimited() {
 	// Output:
 	// map[q:[0 1 2 3 4 5 6 7 8 9]]
 }
+
+func ExampleWithPhysicalQubits() {
+	env := environ.New()
+	v := visitor.New(
+		q.New(),
+		env,
+		visitor.WithPhysicalQubits(3),
+	)
+
+	program, err := xparser.Parse(`U(pi, 0, pi) $2;`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := v.Run(program); err != nil {
+		fmt.Println(err)
+	}
+
+	fmt.Println(env.QubitOrder)
+
+	program, err = xparser.Parse(`U(pi, 0, pi) $3;`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := v.Run(program); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// [$0 $1 $2]
+	// "$3" out of 3 physical qubits
+}
+
+func ExampleWithHook() {
+	v := visitor.New(
+		q.New(),
+		environ.New(),
+		visitor.WithHook(func(ctx *parser.StatementContext, env *environ.Environ, depth int) error {
+			fmt.Println(ctx.GetStart().GetLine(), depth, ctx.GetText())
+			if ctx.GetText() == "end;" {
+				return errors.New("stopped")
+			}
+
+			return nil
+		}),
+	)
+
+	program, err := xparser.Parse(`gate x q { U(pi, 0, pi) q; }
+def f(qubit q) { x q; }
+qubit q;
+f(q);
+end;
+x q;`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := v.Run(program); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// 1 0 gatexq{U(pi,0,pi)q;}
+	// 2 0 deff(qubitq){xq;}
+	// 3 0 qubitq;
+	// 4 0 f(q);
+	// 2 1 xq;
+	// 1 2 U(pi,0,pi)q;
+	// 5 0 end;
+	// stopped
+}
+
+type counter struct {
+	visitor.NopObserver
+	gates int
+}
+
+func (c *counter) Gate(g visitor.Gate) error {
+	c.gates++
+	fmt.Println(g.Position.Line, g.Name, g.Control, g.Target)
+	if c.gates == 3 {
+		return errors.New("canceled")
+	}
+
+	return nil
+}
+
+func ExampleWithObserver() {
+	c := &counter{}
+	v := visitor.New(
+		q.New(),
+		environ.New(),
+		visitor.WithObserver(c),
+	)
+
+	program, err := xparser.Parse(`
+qubit[2] q;
+while (true) {
+	U(pi/2, 0, pi) q[0];
+	ctrl @ U(pi, 0, pi) q[0], q[1];
+}`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := v.Run(program); err != nil {
+		fmt.Println(err)
+	}
+
+	fmt.Println(c.gates)
+
+	// Output:
+	// 4 U [] [0]
+	// 5 U [0] [1]
+	// 4 U [] [0]
+	// canceled
+	// 3
+}
+
+func ExampleWithContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	v := visitor.New(
+		q.New(),
+		environ.New(),
+		visitor.WithContext(ctx),
+	)
+
+	program, err := xparser.Parse(`while (true) { }`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := v.Run(program); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// context canceled
+}
+
+func ExampleWithMaxIterations() {
+	v := visitor.New(
+		q.New(),
+		environ.New(),
+		visitor.WithMaxIterations(10),
+	)
+
+	program, err := xparser.Parse(`
+int n = 0;
+while (true) {
+	n = n + 1;
+}`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := v.Run(program); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// iterations=11, max=10: too many iterations
+}
+
+func ExampleWithMaxStatements() {
+	v := visitor.New(
+		q.New(),
+		environ.New(),
+		visitor.WithMaxStatements(10),
+	)
+
+	program, err := xparser.Parse(`
+qubit q;
+for int i in [0:10] {
+	U(pi, 0, pi) q;
+}`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := v.Run(program); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// statements=11, max=10: too many statements
+}
+
+func ExampleWithMaxDepth() {
+	v := visitor.New(
+		q.New(),
+		environ.New(),
+		visitor.WithMaxDepth(8),
+	)
+
+	program, err := xparser.Parse(`
+def f(qubit q) { f(q); }
+qubit q;
+f(q);`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := v.Run(program); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// depth=9, max=8: too deep calls
+}
+
+func ExampleWithTimeout() {
+	v := visitor.New(
+		q.New(),
+		environ.New(),
+		visitor.WithTimeout(10*time.Millisecond),
+	)
+
+	program, err := xparser.Parse(`while (true) { }`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := v.Run(program); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// timeout=10ms: timeout
+}
@@ -1,13 +1,16 @@
 package visitor
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
 	"math/cmplx"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/antlr4-go/antlr/v4"
 	"github.com/itsubaki/q"
@@ -22,15 +25,31 @@ import (
 )
 
 var (
-	ErrTooManyQubits  = errors.New("too many qubits")
-	ErrNotImplemented = errors.New("not implemented")
+	ErrTooManyQubits     = errors.New("too many qubits")
+	ErrTooManyIterations = errors.New("too many iterations")
+	ErrTooManyStatements = errors.New("too many statements")
+	ErrTooDeep           = errors.New("too deep calls")
+	ErrTimeout           = errors.New("timeout")
+	ErrNotImplemented    = errors.New("not implemented")
 )
 
 type Visitor struct {
 	*parser.Baseqasm3ParserVisitor
-	qsim      *q.Q
-	env       *environ.Environ
-	maxQubits int
+	qsim           *q.Q
+	env            *environ.Environ
+	maxQubits      int
+	physicalQubits int
+	hook           Hook
+	observer       Observer
+	depth          int
+	err            *error
+	ctx            context.Context
+	maxIterations  int
+	maxStatements  int
+	maxDepth       int
+	timeout        time.Duration
+	deadline       time.Time
+	statements     *int
 }
 
 func New(qsim *q.Q, env *environ.Environ, opt ...Option) *Visitor {
@@ -38,12 +57,19 @@ func New(qsim *q.Q, env *environ.Environ, opt ...Option) *Visitor {
 		Baseqasm3ParserVisitor: &parser.Baseqasm3ParserVisitor{},
 		qsim:                   qsim,
 		env:                    env,
+		err:                    new(error),
+		ctx:                    context.Background(),
+		statements:             new(int),
 	}
 
 	for _, f := range opt {
 		f(v)
 	}
 
+	if v.timeout > 0 {
+		v.deadline = time.Now().Add(v.timeout)
+	}
+
 	return v
 }
 
@@ -77,12 +103,21 @@ func Visit(text string) (any, error) {
 	return result, nil
 }
 
+// Enclosed returns a new visitor of the enclosed environment.
+// The options, the limits and the error the execution is stopped with are shared.
 func (v *Visitor) Enclosed() *Visitor {
-	return New(v.qsim, v.env.NewEnclosed())
+	enclosed := *v
+	enclosed.env = v.env.NewEnclosed()
+	return &enclosed
 }
 
 func (v *Visitor) Run(tree antlr.ParseTree) error {
-	if err, ok := v.Visit(tree).(error); ok && err != nil {
+	result := v.Visit(tree)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	if err, ok := result.(error); ok && err != nil {
 		return err
 	}
 
@@ -128,6 +163,32 @@ func (v *Visitor) VisitStatementOrScope(ctx *parser.StatementOrScopeContext) any
 }
 
 func (v *Visitor) VisitStatement(ctx *parser.StatementContext) any {
+	if err := v.Count(); err != nil {
+		return err
+	}
+
+	if v.hook != nil {
+		if err := v.hook(ctx, v.env, v.depth); err != nil {
+			return v.stop(err)
+		}
+	}
+
+	s := v.statement(ctx)
+	if err := v.notify(func(o Observer) error { return o.EnterStatement(s) }); err != nil {
+		return err
+	}
+
+	result := v.Execute(ctx)
+	err, _ := result.(error)
+	if err := v.notify(func(o Observer) error { return o.ExitStatement(s, err) }); err != nil {
+		return err
+	}
+
+	return result
+}
+
+// Execute executes the statement without the hook and the observer.
+func (v *Visitor) Execute(ctx *parser.StatementContext) any {
 	statements := []antlr.ParseTree{
 		ctx.Pragma(),
 		ctx.AliasDeclarationStatement(),
@@ -174,16 +235,24 @@ func (v *Visitor) VisitStatement(ctx *parser.StatementContext) any {
 
 func (v *Visitor) VisitScope(ctx *parser.ScopeContext) any {
 	enclosed := v.Enclosed()
+	scope := Scope{Env: enclosed.env, Depth: enclosed.depth}
+	if err := v.notify(func(o Observer) error { return o.PushScope(scope) }); err != nil {
+		return []any{err}
+	}
 
 	var list []any
 	for _, s := range ctx.AllStatementOrScope() {
 		result := enclosed.Visit(s)
 		list = append(list, result)
 		if contains(result, Break, Continue) {
-			return list
+			break
 		}
 	}
 
+	if err := v.notify(func(o Observer) error { return o.PopScope(scope) }); err != nil {
+		return append(list, err)
+	}
+
 	return list
 }
 
@@ -229,8 +298,18 @@ func (v *Visitor) VisitIfStatement(ctx *parser.IfStatementContext) any {
 		return v
 	}
 
+	cond := v.Visit(ctx.Expression())
+	if err, ok := cond.(error); ok {
+		return err
+	}
+
+	b, ok := cond.(bool)
+	if !ok {
+		return fmt.Errorf("condition must be a bool %q", ctx.Expression().GetText())
+	}
+
 	enclosed := v.Enclosed()
-	if v.Visit(ctx.Expression()).(bool) {
+	if b {
 		return unwrap(enclosed.Visit(ctx.GetIf_body()))
 	}
 
@@ -247,6 +326,10 @@ func (v *Visitor) VisitForStatement(ctx *parser.ForStatementContext) any {
 
 	enclosed := v.Enclosed()
 	for i := rx[0]; i <= rx[1]; i++ {
+		if err := v.Iterate(int(i-rx[0]) + 1); err != nil {
+			return err
+		}
+
 		enclosed.env.SetVariable(id, i)
 		result := enclosed.Visit(ctx.StatementOrScope())
 		if contains(result, Break) {
@@ -259,11 +342,29 @@ func (v *Visitor) VisitForStatement(ctx *parser.ForStatementContext) any {
 
 func (v *Visitor) VisitWhileStatement(ctx *parser.WhileStatementContext) any {
 	enclosed := v.Enclosed()
-	for {
-		if !v.Visit(ctx.Expression()).(bool) {
+	for n := 1; ; n++ {
+		if err := v.Check(); err != nil {
+			return err
+		}
+
+		cond := v.Visit(ctx.Expression())
+		if err, ok := cond.(error); ok {
+			return err
+		}
+
+		b, ok := cond.(bool)
+		if !ok {
+			return fmt.Errorf("condition must be a bool %q", ctx.Expression().GetText())
+		}
+
+		if !b {
 			return nil
 		}
 
+		if err := v.Iterate(n); err != nil {
+			return err
+		}
+
 		result := enclosed.Visit(ctx.GetBody())
 		if contains(result, Break) {
 			return nil
@@ -420,15 +521,45 @@ func (v *Visitor) UserDefinedGateCall(ctx *parser.GateCallStatementContext) erro
 	}
 
 	// call body
+	enclosed.depth++
+	if err := enclosed.Deepen(); err != nil {
+		return err
+	}
+
+	scope := Scope{Env: enclosed.env, Depth: enclosed.depth}
+	if err := v.notify(func(o Observer) error { return o.PushScope(scope) }); err != nil {
+		return err
+	}
+
 	for i, s := range g.Body.AllStatementOrScope() {
-		call := s.Statement().GateCallStatement().(*parser.GateCallStatementContext)
-		result := enclosed.VisitGateCallStatement(call)
-		if err, ok := result.(error); ok && err != nil {
+		if err := v.Count(); err != nil {
+			return err
+		}
+
+		ctx := s.Statement().(*parser.StatementContext)
+		if enclosed.hook != nil {
+			if err := enclosed.hook(ctx, enclosed.env, enclosed.depth); err != nil {
+				return v.stop(err)
+			}
+		}
+
+		statement := enclosed.statement(ctx)
+		if err := v.notify(func(o Observer) error { return o.EnterStatement(statement) }); err != nil {
+			return err
+		}
+
+		result := enclosed.VisitGateCallStatement(ctx.GateCallStatement().(*parser.GateCallStatementContext))
+		err, _ := result.(error)
+		if err := v.notify(func(o Observer) error { return o.ExitStatement(statement, err) }); err != nil {
+			return err
+		}
+
+		if err != nil {
 			return fmt.Errorf("gate call[%d]: %w", i, err)
 		}
 	}
 
-	return nil
+	return v.notify(func(o Observer) error { return o.PopScope(scope) })
 }
 
 func (v *Visitor) VisitGateCallStatement(ctx *parser.GateCallStatementContext) any {
@@ -509,12 +640,21 @@ func (v *Visitor) VisitGateCallStatement(ctx *parser.GateCallStatementContext) a
 			}
 		}
 
-		v.qsim.X(neg...)
-		defer v.qsim.X(neg...)
-
 		target := qargs[len(qargs)-1]
+		v.qsim.X(neg...)
 		v.qsim.Controlled(u, ctrl, target)
-		return nil
+		v.qsim.X(neg...)
+
+		return v.notify(func(o Observer) error {
+			return o.Gate(Gate{
+				Name:       v.GateName(ctx),
+				Matrix:     u,
+				Control:    ctrl,
+				NegControl: neg,
+				Target:     target,
+				Position:   position(ctx),
+			})
+		})
 	}
 
 	// qargs
@@ -539,11 +679,31 @@ func (v *Visitor) VisitGateCallStatement(ctx *parser.GateCallStatementContext) a
 	}
 
 	v.qsim.G(u, qargs...)
-	return nil
+	return v.notify(func(o Observer) error {
+		return o.Gate(Gate{
+			Name:     v.GateName(ctx),
+			Matrix:   u,
+			Target:   qargs,
+			Position: position(ctx),
+		})
+	})
+}
+
+// GateName returns the name of the gate call such as U and gphase.
+func (v *Visitor) GateName(ctx *parser.GateCallStatementContext) string {
+	if ctx.GPHASE() != nil {
+		return ctx.GPHASE().GetText()
+	}
+
+	return v.Visit(ctx.Identifier()).(string)
 }
 
 func (v *Visitor) MeasureAssignment(id parser.IIndexedIdentifierContext, measure parser.IMeasureExpressionContext) error {
 	measured := v.Visit(measure)
+	if err, ok := measured.(error); ok && err != nil {
+		return err
+	}
+
 	if id == nil {
 		return nil
 	}
@@ -586,10 +746,51 @@ func (v *Visitor) MeasureAssignment(id parser.IIndexedIdentifierContext, measure
 }
 
 func (v *Visitor) VisitMeasureArrowAssignmentStatement(ctx *parser.MeasureArrowAssignmentStatementContext) any {
-	return v.MeasureAssignment(ctx.IndexedIdentifier(), ctx.MeasureExpression())
+	if err := v.MeasureAssignment(ctx.IndexedIdentifier(), ctx.MeasureExpression()); err != nil {
+		return err
+	}
+
+	return v.Assigned(ctx, ctx.IndexedIdentifier())
 }
 
 func (v *Visitor) VisitAssignmentStatement(ctx *parser.AssignmentStatementContext) any {
+	if err := v.Assign(ctx); err != nil {
+		return err
+	}
+
+	return v.Assigned(ctx, ctx.IndexedIdentifier())
+}
+
+// Assigned notifies the observer of the value assigned to the identifier.
+func (v *Visitor) Assigned(ctx antlr.ParserRuleContext, id parser.IIndexedIdentifierContext) error {
+	if v.observer == nil || id == nil {
+		return nil
+	}
+
+	name := v.Visit(id.Identifier()).(string)
+	value, ok := v.env.GetVariable(name)
+	if bit, found := v.env.GetBit(name); !ok && found {
+		value, ok = bit, true
+	}
+
+	if bits, found := v.env.GetBitArray(name); !ok && found {
+		value, ok = slices.Clone(bits), true
+	}
+
+	if !ok {
+		return nil
+	}
+
+	return v.notify(func(o Observer) error {
+		return o.Assign(Assignment{
+			Name:     name,
+			Value:    value,
+			Position: position(ctx),
+		})
+	})
+}
+
+func (v *Visitor) Assign(ctx *parser.AssignmentStatementContext) error {
 	if ctx.MeasureExpression() != nil {
 		return v.MeasureAssignment(ctx.IndexedIdentifier(), ctx.MeasureExpression())
 	}
@@ -644,8 +845,14 @@ func (v *Visitor) VisitResetStatement(ctx *parser.ResetStatementContext) any {
 		return err
 	}
 
-	v.qsim.Reset(result.([]q.Qubit)...)
-	return nil
+	qargs := result.([]q.Qubit)
+	v.qsim.Reset(qargs...)
+	return v.notify(func(o Observer) error {
+		return o.Reset(Reset{
+			Qubit:    qargs,
+			Position: position(ctx),
+		})
+	})
 }
 
 func (v *Visitor) VisitConstDeclarationStatement(ctx *parser.ConstDeclarationStatementContext) any {
@@ -845,10 +1052,12 @@ func (v *Visitor) VisitDefStatement(ctx *parser.DefStatementContext) any {
 		return fmt.Errorf("%q redeclared", name)
 	}
 
-	args := v.Visit(ctx.ArgumentDefinitionList()).([]any)
 	var qargs []string
-	for _, a := range args {
-		qargs = append(qargs, a.(string))
+	if ctx.ArgumentDefinitionList() != nil {
+		// def f() {}
+		for _, a := range v.Visit(ctx.ArgumentDefinitionList()).([]any) {
+			qargs = append(qargs, a.(string))
+		}
 	}
 
 	var retType any
@@ -1310,7 +1519,12 @@ func (v *Visitor) VisitDeclarationExpression(ctx *parser.DeclarationExpressionCo
 }
 
 func (v *Visitor) VisitCallExpression(ctx *parser.CallExpressionContext) any {
-	args := v.Visit(ctx.ExpressionList()).([]any)
+	var args []any
+	if ctx.ExpressionList() != nil {
+		// f();
+		args = v.Visit(ctx.ExpressionList()).([]any)
+	}
+
 	id := v.Visit(ctx.Identifier()).(string)
 	switch id {
 	case "sin":
@@ -1344,11 +1558,34 @@ func (v *Visitor) VisitCallExpression(ctx *parser.CallExpressionContext) any {
 		}
 
 		enclosed := v.Enclosed()
+		enclosed.depth++
+		if err := enclosed.Deepen(); err != nil {
+			return err
+		}
+
+		if len(args) != len(routine.QArgs) {
+			return fmt.Errorf("call %q: %d arguments, want %d", id, len(args), len(routine.QArgs))
+		}
+
 		for i, p := range routine.QArgs {
-			enclosed.env.Qubit[p] = args[i].([]q.Qubit)
+			if err, ok := args[i].(error); ok {
+				return err
+			}
+
+			if qargs, ok := args[i].([]q.Qubit); ok {
+				enclosed.env.Qubit[p] = qargs
+				continue
+			}
+
+			enclosed.env.SetVariable(p, args[i])
 		}
 
 		result := enclosed.Visit(routine.Body).([]any)
+		if len(result) == 0 {
+			// def f() {}
+			return nil
+		}
+
 		return result[len(result)-1]
 	}
 }
@@ -1412,6 +1649,16 @@ func (v *Visitor) VisitMeasureExpression(ctx *parser.MeasureExpressionContext) a
 		bits = append(bits, intv == 1)
 	}
 
+	if err := v.notify(func(o Observer) error {
+		return o.Measure(Measurement{
+			Qubit:    qargs,
+			Outcome:  bits,
+			Position: position(ctx),
+		})
+	}); err != nil {
+		return err
+	}
+
 	if len(bits) == 1 {
 		return bits[0]
 	}
@@ -1560,6 +1807,16 @@ func (v *Visitor) VisitArgumentDefinition(ctx *parser.ArgumentDefinitionContext)
 }
 
 func (v *Visitor) VisitGateOperand(ctx *parser.GateOperandContext) any {
+	if ctx.HardwareQubit() != nil {
+		// $0, $1, ...
+		qb, err := v.PhysicalQubit(ctx.HardwareQubit().GetText())
+		if err != nil {
+			return err
+		}
+
+		return qb
+	}
+
 	operand := v.Visit(ctx.IndexedIdentifier().Identifier()).(string)
 	qb, ok := v.env.GetQubit(operand)
 	if !ok {
@@ -1584,6 +1841,61 @@ func (v *Visitor) VisitGateOperand(ctx *parser.GateOperandContext) any {
 	return list
 }
 
+// PhysicalQubit returns the physical qubit such as $0.
+// The physical qubit is allocated in the outermost environment on the first use.
+// Without the number of the physical qubits, the first use of $n allocates $0, $1, ..., $n not allocated yet in ascending order.
+func (v *Visitor) PhysicalQubit(id string) ([]q.Qubit, error) {
+	if qb, ok := v.env.GetQubit(id); ok {
+		return qb, nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(id, "$"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid physical qubit %q", id)
+	}
+
+	root := v.env
+	for root.Outer != nil {
+		root = root.Outer
+	}
+
+	if v.physicalQubits == 0 {
+		// $0, $1, ..., $n are allocated in ascending order.
+		var ids []string
+		for i := range n + 1 {
+			if _, ok := root.Qubit[fmt.Sprintf("$%d", i)]; !ok {
+				ids = append(ids, fmt.Sprintf("$%d", i))
+			}
+		}
+
+		need := v.qsim.NumQubits() + len(ids)
+		if v.maxQubits > 0 && need > v.maxQubits {
+			return nil, fmt.Errorf("need=%d, max=%d: %w", need, v.maxQubits, ErrTooManyQubits)
+		}
+
+		for _, id := range ids {
+			root.SetQubit(id, v.qsim.Zeros(1))
+		}
+
+		return root.Qubit[fmt.Sprintf("$%d", n)], nil
+	}
+
+	if n >= v.physicalQubits {
+		return nil, fmt.Errorf("%q out of %d physical qubits", id, v.physicalQubits)
+	}
+
+	need := v.qsim.NumQubits() + v.physicalQubits
+	if v.maxQubits > 0 && need > v.maxQubits {
+		return nil, fmt.Errorf("need=%d, max=%d: %w", need, v.maxQubits, ErrTooManyQubits)
+	}
+
+	for i := range v.physicalQubits {
+		root.SetQubit(fmt.Sprintf("$%d", i), v.qsim.Zeros(1))
+	}
+
+	return root.Qubit[id], nil
+}
+
 func (v *Visitor) VisitArgumentDefinitionList(ctx *parser.ArgumentDefinitionListContext) any {
 	var list []any
 	for _, def := range ctx.AllArgumentDefinition() {
@@ -7,11 +7,13 @@ import (
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/antlr4-go/antlr/v4"
 	"github.com/itsubaki/q"
 	"github.com/itsubaki/qasm/environ"
 	"github.com/itsubaki/qasm/gen/parser"
+	xparser "github.com/itsubaki/qasm/parser"
 	"github.com/itsubaki/qasm/visitor"
 )
 
@@ -910,6 +912,71 @@ func TestVisitor_VisitResetStatement(t *testing.T) {
 	}
 }
 
+func TestVisitor_VisitGateOperand_physical(t *testing.T) {
+	cases := []struct {
+		text   string
+		order  []string
+		want   []string
+		errMsg string
+	}{
+		{
+			text: `
+				U(pi/2, 0, pi) $1;
+				ctrl @ U(pi, 0, pi) $1, $0;
+			`,
+			order: []string{"$0", "$1"},
+			want: []string{
+				"[00] ( 0.7071 0.0000i): 0.5000",
+				"[11] ( 0.7071 0.0000i): 0.5000",
+			},
+		},
+		{
+			text: `
+				qubit q;
+				def f(qubit a) { U(pi, 0, pi) $0; }
+				f(q);
+				bit c = measure $0;
+				reset $0;
+			`,
+			order: []string{"q", "$0"},
+			want: []string{
+				"[00] ( 1.0000 0.0000i): 1.0000",
+			},
+		},
+		{
+			text: `
+				U(pi, 0, pi) $2;
+				U(pi, 0, pi) $0;
+			`,
+			order: []string{"$0", "$1", "$2"},
+			want: []string{
+				"[101] ( 1.0000 0.0000i): 1.0000",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		qsim, env, err := visitor.Run(c.text)
+		if err != nil {
+			if err.Error() != c.errMsg {
+				t.Fatalf("got=%v, want=%v", err, c.errMsg)
+			}
+
+			continue
+		}
+
+		if !slices.Equal(env.QubitOrder, c.order) {
+			t.Fatalf("got=%v, want=%v", env.QubitOrder, c.order)
+		}
+
+		for i, s := range qsim.State() {
+			if s.String() != c.want[i] {
+				t.Fatalf("got=%v, want=%v", s.String(), c.want[i])
+			}
+		}
+	}
+}
+
 func TestVisitor_VisitAdditiveExpression(t *testing.T) {
 	cases := []struct {
 		text   string
@@ -2259,6 +2326,18 @@ func TestVisitor_VisitDefStatement(t *testing.T) {
 			text:   "def f(qubit q) -> bit { return 1; } def f(qubit q) -> bit { return 0; }",
 			errMsg: `"f" redeclared`,
 		},
+		{
+			text: `
+				def f(int k) {}
+				def g() {}
+				f(1);
+				g();
+			`,
+		},
+		{
+			text:   "def f(int k) {} f();",
+			errMsg: `call "f": 0 arguments, want 1`,
+		},
 	}
 
 	for _, c := range cases {
@@ -2315,6 +2394,28 @@ func TestVisitor_VisitIfStatement(t *testing.T) {
 	}
 }
 
+func TestVisitor_VisitIfStatement_error(t *testing.T) {
+	cases := []struct {
+		text   string
+		errMsg string
+	}{
+		{
+			text:   `bit c; if (c == 1) { c = 0; }`,
+			errMsg: "false==1: unexpected bool and int64",
+		},
+		{
+			text:   `int n = 1; if (n) { n = 0; }`,
+			errMsg: `condition must be a bool "n"`,
+		},
+	}
+
+	for _, c := range cases {
+		if _, _, err := visitor.Run(c.text); err == nil || err.Error() != c.errMsg {
+			t.Errorf("got=%v, want=%v", err, c.errMsg)
+		}
+	}
+}
+
 func TestVisitor_VisitForStatement(t *testing.T) {
 	cases := []struct {
 		text string
@@ -2519,6 +2620,28 @@ func TestVisitor_VisitWhileStatement(t *testing.T) {
 	}
 }
 
+func TestVisitor_VisitWhileStatement_error(t *testing.T) {
+	cases := []struct {
+		text   string
+		errMsg string
+	}{
+		{
+			text:   `int n = 1; while (n) { n = 0; }`,
+			errMsg: `condition must be a bool "n"`,
+		},
+		{
+			text:   `bit c; while (c == 1) { c = 0; }`,
+			errMsg: "false==1: unexpected bool and int64",
+		},
+	}
+
+	for _, c := range cases {
+		if _, _, err := visitor.Run(c.text); err == nil || err.Error() != c.errMsg {
+			t.Errorf("got=%v, want=%v", err, c.errMsg)
+		}
+	}
+}
+
 func TestVisitor_VisitSwitchStatement(t *testing.T) {
 	cases := []struct {
 		text string
@@ -3154,3 +3277,96 @@ func TestVisitor_unimplemented(t *testing.T) {
 		}
 	}
 }
+
+func TestVisitor_limits(t *testing.T) {
+	cases := []struct {
+		text string
+		opt  []visitor.Option
+		err  error
+	}{
+		{
+			text: `int n = 0; while (true) { if (n > 5) { n = 0; } n = n + 1; }`,
+			opt:  []visitor.Option{visitor.WithMaxIterations(100)},
+			err:  visitor.ErrTooManyIterations,
+		},
+		{
+			text: `for int i in [0:1000] { for int j in [0:1000] { } }`,
+			opt:  []visitor.Option{visitor.WithMaxIterations(100)},
+			err:  visitor.ErrTooManyIterations,
+		},
+		{
+			text: `int n = 0; while (true) { n = n + 1; }`,
+			opt:  []visitor.Option{visitor.WithMaxStatements(100)},
+			err:  visitor.ErrTooManyStatements,
+		},
+		{
+			text: `gate x q { U(pi, 0, pi) q; } qubit q; x q; x q;`,
+			opt:  []visitor.Option{visitor.WithMaxStatements(4)},
+			err:  visitor.ErrTooManyStatements,
+		},
+		{
+			text: `def f(qubit q) { U(pi, 0, pi) q; f(q); } qubit q; f(q);`,
+			opt:  []visitor.Option{visitor.WithMaxDepth(64)},
+			err:  visitor.ErrTooDeep,
+		},
+		{
+			text: `gate x q { U(pi, 0, pi) q; } gate y q { x q; } qubit q; y q;`,
+			opt:  []visitor.Option{visitor.WithMaxDepth(1)},
+			err:  visitor.ErrTooDeep,
+		},
+		{
+			text: `int n = 0; while (true) { n = n + 1; }`,
+			opt:  []visitor.Option{visitor.WithTimeout(time.Millisecond)},
+			err:  visitor.ErrTimeout,
+		},
+	}
+
+	for _, c := range cases {
+		program, err := xparser.Parse(c.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v := visitor.New(q.New(), environ.New(), c.opt...)
+		if err := v.Run(program); !errors.Is(err, c.err) {
+			t.Errorf("%s: got=%v, want=%v", c.text, err, c.err)
+		}
+
+		// the visitor is stopped with the error.
+		if err := v.Run(program); !errors.Is(err, c.err) {
+			t.Errorf("%s: got=%v, want=%v", c.text, err, c.err)
+		}
+	}
+}
+
+func TestVisitor_limits_unlimited(t *testing.T) {
+	text := `
+	def f(qubit q) { U(pi, 0, pi) q; }
+	qubit q;
+	int n = 0;
+	while (n < 100) {
+		f(q);
+		n = n + 1;
+	}`
+
+	program, err := xparser.Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := environ.New()
+	v := visitor.New(q.New(), env,
+		visitor.WithMaxIterations(100),
+		visitor.WithMaxStatements(1000),
+		visitor.WithMaxDepth(1),
+		visitor.WithTimeout(time.Minute),
+	)
+
+	if err := v.Run(program); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := env.GetVariable("n"); got != int64(100) {
+		t.Errorf("got=%v, want=100", got)
+	}
+}